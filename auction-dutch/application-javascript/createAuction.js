@@ -13,7 +13,7 @@ const { buildCCPOrg1, buildCCPOrg2, buildWallet, prettyJSONString } = require('.
 const myChannel = 'mychannel';
 const myChaincodeName = 'auction';
 
-async function createAuction (ccp, wallet, user, auctionID, item, quantity, auditor) {
+async function createAuction (ccp, wallet, user, auctionID, item, quantity, auditor, allocationRule, endorsementMode, endorsementThreshold) {
 	try {
 		const gateway = new Gateway();
 		// connect using Discovery enabled
@@ -27,7 +27,7 @@ async function createAuction (ccp, wallet, user, auctionID, item, quantity, audi
 		const statefulTxn = contract.createTransaction('CreateAuction');
 
 		console.log('\n--> Submit Transaction: Propose a new auction');
-		await statefulTxn.submit(auctionID, item, parseInt(quantity), auditor);
+		await statefulTxn.submit(auctionID, item, parseInt(quantity), auditor, allocationRule, endorsementMode, endorsementThreshold.toString());
 		console.log('*** Result: committed');
 
 		console.log('\n--> Evaluate Transaction: query the auction that was just created');
@@ -45,7 +45,7 @@ async function main () {
 		if (process.argv[2] === undefined || process.argv[3] === undefined ||
             process.argv[4] === undefined || process.argv[5] === undefined ||
             process.argv[6] === undefined) {
-			console.log('Usage: node createAuction.js org userID auctionID item quantity');
+			console.log('Usage: node createAuction.js org userID auctionID item quantity auditorMSP|noAuditor [smallestFirst|proRata] [all|majority|N]');
 			process.exit(1);
 		}
 
@@ -56,18 +56,27 @@ async function main () {
 		const quantity = process.argv[6];
 		const auditor = process.argv[7];
 
+		// by default, bids at the clearing price are filled smallest first
+		const allocationRule = process.argv[8] === undefined ? 'smallestFirst' : process.argv[8];
+
+		// by default every participating organization endorses updates to the auction,
+		// a number N requires N organizations including the seller's organization
+		const endorsement = process.argv[9] === undefined ? 'all' : process.argv[9];
+		const endorsementMode = isNaN(parseInt(endorsement)) ? endorsement : 'nOfM';
+		const endorsementThreshold = isNaN(parseInt(endorsement)) ? 0 : parseInt(endorsement);
+
 		if (org === 'Org1' || org === 'org1') {
 			const ccp = buildCCPOrg1();
 			const walletPath = path.join(__dirname, 'wallet/org1');
 			const wallet = await buildWallet(Wallets, walletPath);
-			await createAuction(ccp, wallet, user, auctionID, item, quantity, auditor);
+			await createAuction(ccp, wallet, user, auctionID, item, quantity, auditor, allocationRule, endorsementMode, endorsementThreshold);
 		} else if (org === 'Org2' || org === 'org2') {
 			const ccp = buildCCPOrg2();
 			const walletPath = path.join(__dirname, 'wallet/org2');
 			const wallet = await buildWallet(Wallets, walletPath);
-			await createAuction(ccp, wallet, user, auctionID, item, quantity, auditor);
+			await createAuction(ccp, wallet, user, auctionID, item, quantity, auditor, allocationRule, endorsementMode, endorsementThreshold);
 		} else {
-			console.log('Usage: node createAuction.js org userID auctionID item quantity');
+			console.log('Usage: node createAuction.js org userID auctionID item quantity auditorMSP|noAuditor [smallestFirst|proRata] [all|majority|N]');
 			console.log('Org must be Org1 or Org2');
 		}
 	} catch (error) {
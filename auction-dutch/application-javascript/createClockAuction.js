@@ -0,0 +1,90 @@
+/*
+ * Copyright IBM Corp. All Rights Reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+'use strict';
+
+const { Gateway, Wallets } = require('fabric-network');
+const path = require('path');
+const { buildCCPOrg1, buildCCPOrg2, buildWallet, prettyJSONString } = require('../../test-application/javascript/AppUtil.js');
+
+const myChannel = 'mychannel';
+const myChaincodeName = 'auction';
+
+async function createClockAuction (ccp, wallet, user, auctionID, item, quantity, startPrice, floorPrice, decrement, stepSeconds, auditor, endorsementMode, endorsementThreshold) {
+	try {
+		const gateway = new Gateway();
+		// connect using Discovery enabled
+
+		await gateway.connect(ccp,
+			{ wallet: wallet, identity: user, discovery: { enabled: true, asLocalhost: true } });
+
+		const network = await gateway.getNetwork(myChannel);
+		const contract = network.getContract(myChaincodeName);
+
+		const statefulTxn = contract.createTransaction('CreateClockAuction');
+
+		console.log('\n--> Submit Transaction: Propose a new clock auction');
+		await statefulTxn.submit(auctionID, item, parseInt(quantity), parseInt(startPrice), parseInt(floorPrice), parseInt(decrement), parseInt(stepSeconds), auditor, endorsementMode, endorsementThreshold.toString());
+		console.log('*** Result: committed');
+
+		console.log('\n--> Evaluate Transaction: query the auction that was just created');
+		const result = await contract.evaluateTransaction('QueryAuction', auctionID);
+		console.log('*** Result: Auction: ' + prettyJSONString(result.toString()));
+
+		gateway.disconnect();
+	} catch (error) {
+		console.error(`******** FAILED to create auction: ${error}`);
+	}
+}
+
+async function main () {
+	try {
+		if (process.argv[2] === undefined || process.argv[3] === undefined ||
+            process.argv[4] === undefined || process.argv[5] === undefined ||
+            process.argv[6] === undefined || process.argv[7] === undefined ||
+            process.argv[8] === undefined || process.argv[9] === undefined ||
+            process.argv[10] === undefined) {
+			console.log('Usage: node createClockAuction.js org userID auctionID item quantity startPrice floorPrice decrement stepSeconds auditorMSP|noAuditor [all|majority|N]');
+			process.exit(1);
+		}
+
+		const org = process.argv[2];
+		const user = process.argv[3];
+		const auctionID = process.argv[4];
+		const item = process.argv[5];
+		const quantity = process.argv[6];
+		const startPrice = process.argv[7];
+		const floorPrice = process.argv[8];
+		const decrement = process.argv[9];
+		const stepSeconds = process.argv[10];
+		const auditor = process.argv[11];
+
+		// by default every participating organization endorses updates to the auction,
+		// a number N requires N organizations including the seller's organization
+		const endorsement = process.argv[12] === undefined ? 'all' : process.argv[12];
+		const endorsementMode = isNaN(parseInt(endorsement)) ? endorsement : 'nOfM';
+		const endorsementThreshold = isNaN(parseInt(endorsement)) ? 0 : parseInt(endorsement);
+
+		if (org === 'Org1' || org === 'org1') {
+			const ccp = buildCCPOrg1();
+			const walletPath = path.join(__dirname, 'wallet/org1');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await createClockAuction(ccp, wallet, user, auctionID, item, quantity, startPrice, floorPrice, decrement, stepSeconds, auditor, endorsementMode, endorsementThreshold);
+		} else if (org === 'Org2' || org === 'org2') {
+			const ccp = buildCCPOrg2();
+			const walletPath = path.join(__dirname, 'wallet/org2');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await createClockAuction(ccp, wallet, user, auctionID, item, quantity, startPrice, floorPrice, decrement, stepSeconds, auditor, endorsementMode, endorsementThreshold);
+		} else {
+			console.log('Usage: node createClockAuction.js org userID auctionID item quantity startPrice floorPrice decrement stepSeconds auditorMSP|noAuditor [all|majority|N]');
+			console.log('Org must be Org1 or Org2');
+		}
+	} catch (error) {
+		console.error(`******** FAILED to run the application: ${error}`);
+	}
+}
+
+main();
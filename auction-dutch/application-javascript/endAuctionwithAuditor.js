@@ -26,7 +26,10 @@ async function endAuction (ccp, wallet, org, user, auctionID) {
 
 		const statefulTxn = contract.createTransaction('EndAuction');
 
-		statefulTxn.setEndorsingOrganizations(org, 'Org3MSP');
+		// the auditor of the auction endorses the transaction together with the organization of the client
+		const auctionString = await contract.evaluateTransaction('QueryAuction', auctionID);
+		const auctionJSON = JSON.parse(auctionString);
+		statefulTxn.setEndorsingOrganizations(org, auctionJSON.auditorOrg);
 
 		console.log('\n--> Submit the transaction to end the auction');
 		await statefulTxn.submit(auctionID);
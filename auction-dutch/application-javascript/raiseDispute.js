@@ -0,0 +1,100 @@
+/*
+ * Copyright IBM Corp. All Rights Reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+'use strict';
+
+const { Gateway, Wallets } = require('fabric-network');
+const path = require('path');
+const { buildCCPOrg1, buildCCPOrg2, buildWallet, prettyJSONString } = require('../../test-application/javascript/AppUtil.js');
+
+const myChannel = 'mychannel';
+const myChaincodeName = 'auction';
+
+async function raiseDispute (ccp, wallet, org, user, auctionID, reason, bidID) {
+	try {
+		const gateway = new Gateway();
+		// connect using Discovery enabled
+
+		await gateway.connect(ccp,
+			{ wallet: wallet, identity: user, discovery: { enabled: true, asLocalhost: true } });
+
+		const network = await gateway.getNetwork(myChannel);
+		const contract = network.getContract(myChaincodeName);
+
+		const statefulTxn = contract.createTransaction('RaiseDispute');
+
+		// a bidder whose bid has not been revealed passes the bid to prove that they joined the auction
+		if (bidID !== undefined) {
+			console.log('\n--> Evaluate Transaction: read your bid');
+			const bidString = await contract.evaluateTransaction('QueryBid', auctionID, bidID);
+			const bidJSON = JSON.parse(bidString);
+
+			const bidData = { objectType: 'bid', quantity: parseInt(bidJSON.quantity), price: parseInt(bidJSON.price), org: bidJSON.org, buyer: bidJSON.buyer };
+			statefulTxn.setTransient({
+				bid: Buffer.from(JSON.stringify(bidData))
+			});
+		}
+
+		// the auditor of the auction endorses the dispute together with the organization of the client
+		const auctionString = await contract.evaluateTransaction('QueryAuction', auctionID);
+		const auctionJSON = JSON.parse(auctionString);
+		statefulTxn.setEndorsingOrganizations(org, auctionJSON.auditorOrg);
+
+		console.log('\n--> Submit the transaction to raise a dispute');
+		await statefulTxn.submit(auctionID, reason);
+		console.log('*** Result: committed');
+
+		console.log('\n--> Evaluate Transaction: query the updated auction');
+		const result = await contract.evaluateTransaction('QueryAuction', auctionID);
+		console.log('*** Result: Auction: ' + prettyJSONString(result.toString()));
+
+		gateway.disconnect();
+	} catch (error) {
+		console.error(`******** FAILED to raise dispute: ${error}`);
+		process.exit(1);
+	}
+}
+
+async function main () {
+	try {
+		if (process.argv[2] === undefined || process.argv[3] === undefined ||
+            process.argv[4] === undefined || process.argv[5] === undefined) {
+			console.log('Usage: node raiseDispute.js org userID auctionID reason [bidID]');
+			process.exit(1);
+		}
+
+		const org = process.argv[2];
+		const user = process.argv[3];
+		const auctionID = process.argv[4];
+		const reason = process.argv[5];
+		const bidID = process.argv[6];
+
+		if (org === 'Org1' || org === 'org1') {
+			const orgMSP = 'Org1MSP';
+			const ccp = buildCCPOrg1();
+			const walletPath = path.join(__dirname, 'wallet/org1');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await raiseDispute(ccp, wallet, orgMSP, user, auctionID, reason, bidID);
+		} else if (org === 'Org2' || org === 'org2') {
+			const orgMSP = 'Org2MSP';
+			const ccp = buildCCPOrg2();
+			const walletPath = path.join(__dirname, 'wallet/org2');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await raiseDispute(ccp, wallet, orgMSP, user, auctionID, reason, bidID);
+		} else {
+			console.log('Usage: node raiseDispute.js org userID auctionID reason [bidID]');
+			console.log('Org must be Org1 or Org2');
+		}
+	} catch (error) {
+		console.error(`******** FAILED to run the application: ${error}`);
+		if (error.stack) {
+			console.error(error.stack);
+		}
+		process.exit(1);
+	}
+}
+
+main();
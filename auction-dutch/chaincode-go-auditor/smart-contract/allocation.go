@@ -0,0 +1,202 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// Allocation rules for the bids at the price that clears the auction. The smallest first
+// rule fills smaller bids first, while the pro rata rule shares the remaining quantity
+// between the bids in proportion to their quantities
+const smallestFirstAllocation = "smallestFirst"
+const proRataAllocation = "proRata"
+
+// Allocation explains how the quantity of a winning bid was computed
+type Allocation struct {
+	BidKey      string `json:"bidKey"`
+	Buyer       string `json:"buyer"`
+	BidPrice    int    `json:"bidPrice"`
+	BidQuantity int    `json:"bidQuantity"`
+	Quantity    int    `json:"quantity"`
+	Explanation string `json:"explanation"`
+}
+
+// rankedBid is a revealed bid together with its key in the auction
+type rankedBid struct {
+	Key string
+	Bid FullBid
+}
+
+// allocateBids is an internal function that calculates the quantity allocated to each
+// winning bid of a sealed bid auction using the allocation rule of the auction, and the
+// price that clears the auction
+func allocateBids(auction *Auction) ([]Allocation, int) {
+
+	// sort the revealed bids from the highest to the lowest price. Bids with the same
+	// price are ordered by the allocation rule, and then by bid key so that every peer
+	// calculates the same winners
+	var bids []rankedBid
+	for bidKey, bid := range auction.RevealedBids {
+		bids = append(bids, rankedBid{Key: bidKey, Bid: bid})
+	}
+
+	proRata := auction.AllocationRule == proRataAllocation
+
+	sort.Slice(bids, func(p, q int) bool {
+		if bids[p].Bid.Price != bids[q].Bid.Price {
+			return bids[p].Bid.Price > bids[q].Bid.Price
+		}
+		if !proRata && bids[p].Bid.Quantity != bids[q].Bid.Quantity {
+			return bids[p].Bid.Quantity < bids[q].Bid.Quantity
+		}
+		return bids[p].Key < bids[q].Key
+	})
+
+	if len(bids) == 0 {
+		return nil, 0
+	}
+
+	// the clearing price is the price of the bid that sells the last unit, or of the
+	// lowest bid if the bids do not cover the quantity for sale
+	price := 0
+	demand := 0
+	for _, bid := range bids {
+		price = bid.Bid.Price
+		demand = demand + bid.Bid.Quantity
+		if demand >= auction.Quantity {
+			break
+		}
+	}
+
+	if proRata {
+		return allocateProRata(bids, auction.Quantity, price), price
+	}
+	return allocateSmallestFirst(bids, auction.Quantity, price), price
+}
+
+// allocateSmallestFirst fills the bids in order until the quantity runs out. The last
+// winning bid gets the remaining quantity
+func allocateSmallestFirst(bids []rankedBid, quantity int, price int) []Allocation {
+
+	var allocations []Allocation
+	remainingQuantity := quantity
+
+	for _, bid := range bids {
+		if remainingQuantity == 0 {
+			break
+		}
+
+		allocation := newAllocation(bid)
+		if remainingQuantity >= bid.Bid.Quantity {
+			allocation.Quantity = bid.Bid.Quantity
+			allocation.Explanation = fmt.Sprintf("bid filled in full, %d units remained", remainingQuantity)
+		} else {
+			allocation.Quantity = remainingQuantity
+			allocation.Explanation = fmt.Sprintf("bid at the clearing price of %d allocated the last %d units, bids at the same price are filled smallest first", price, remainingQuantity)
+		}
+
+		remainingQuantity = remainingQuantity - allocation.Quantity
+		allocations = append(allocations, allocation)
+	}
+
+	return allocations
+}
+
+// allocateProRata fills the bids above the clearing price in full. The bids at the clearing
+// price share the remaining quantity in proportion to their quantities. Shares are rounded
+// down, and the units left over are given one at a time to the bids with the largest
+// remainders, and then to the bids with the lowest bid keys
+func allocateProRata(bids []rankedBid, quantity int, price int) []Allocation {
+
+	var allocations []Allocation
+	remainingQuantity := quantity
+
+	var tiedBids []rankedBid
+	tiedQuantity := 0
+
+	for _, bid := range bids {
+		if bid.Bid.Price > price {
+			allocation := newAllocation(bid)
+			allocation.Quantity = bid.Bid.Quantity
+			allocation.Explanation = fmt.Sprintf("bid above the clearing price of %d filled in full", price)
+			allocations = append(allocations, allocation)
+			remainingQuantity = remainingQuantity - bid.Bid.Quantity
+		} else if bid.Bid.Price == price {
+			tiedBids = append(tiedBids, bid)
+			tiedQuantity = tiedQuantity + bid.Bid.Quantity
+		}
+	}
+
+	// fill every bid at the clearing price if there is enough quantity left
+	if tiedQuantity <= remainingQuantity {
+		for _, bid := range tiedBids {
+			allocation := newAllocation(bid)
+			allocation.Quantity = bid.Bid.Quantity
+			allocation.Explanation = fmt.Sprintf("bid at the clearing price of %d filled in full, %d units were bid at that price for %d remaining units", price, tiedQuantity, remainingQuantity)
+			allocations = append(allocations, allocation)
+		}
+		return allocations
+	}
+
+	// share = remainingQuantity * bidQuantity / tiedQuantity, computed with big integers
+	// since the product can exceed an int
+	shares := make([]int, len(tiedBids))
+	remainders := make([]*big.Int, len(tiedBids))
+	leftover := remainingQuantity
+	for i, bid := range tiedBids {
+		share, remainder := new(big.Int).QuoRem(
+			new(big.Int).Mul(big.NewInt(int64(remainingQuantity)), big.NewInt(int64(bid.Bid.Quantity))),
+			big.NewInt(int64(tiedQuantity)),
+			new(big.Int),
+		)
+		shares[i] = int(share.Int64())
+		remainders[i] = remainder
+		leftover = leftover - shares[i]
+	}
+
+	// hand out the units left over by rounding down
+	order := make([]int, len(tiedBids))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(p, q int) bool {
+		cmp := remainders[order[p]].Cmp(remainders[order[q]])
+		if cmp != 0 {
+			return cmp > 0
+		}
+		return tiedBids[order[p]].Key < tiedBids[order[q]].Key
+	})
+	extra := make([]int, len(tiedBids))
+	for i := 0; i < leftover; i++ {
+		extra[order[i]] = 1
+	}
+
+	for i, bid := range tiedBids {
+		if shares[i]+extra[i] == 0 {
+			continue
+		}
+
+		allocation := newAllocation(bid)
+		allocation.Quantity = shares[i] + extra[i]
+		allocation.Explanation = fmt.Sprintf("bid at the clearing price of %d shares %d remaining units pro rata: %d * %d / %d rounds down to %d, plus %d for the largest remainders",
+			price, remainingQuantity, remainingQuantity, bid.Bid.Quantity, tiedQuantity, shares[i], extra[i])
+		allocations = append(allocations, allocation)
+	}
+
+	return allocations
+}
+
+// newAllocation creates the allocation of a bid before its quantity is computed
+func newAllocation(bid rankedBid) Allocation {
+	return Allocation{
+		BidKey:      bid.Key,
+		Buyer:       bid.Bid.Buyer,
+		BidPrice:    bid.Bid.Price,
+		BidQuantity: bid.Bid.Quantity,
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"sort"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
@@ -19,18 +18,37 @@ type SmartContract struct {
 }
 
 // Auction data
+// The start price, floor price, decrement, time step in seconds and start time are only
+// used by descending clock auctions. A disputed auction cannot be ended until the auditor
+// resolves the dispute, and History records every step of its disputes. AuditorOrg is
+// the MSP ID of the auditor organization of an auction created with an auditor. AllocationRule
+// decides how the bids at the clearing price of a sealed bid auction share the quantity.
+// EndorsementMode and EndorsementThreshold decide how many participating organizations
+// need to endorse an update to the auction
 type Auction struct {
-	Type         string             `json:"objectType"`
-	ItemSold     string             `json:"item"`
-	Seller       string             `json:"seller"`
-	Quantity     int                `json:"quantity"`
-	Orgs         []string           `json:"organizations"`
-	PrivateBids  map[string]BidHash `json:"privateBids"`
-	RevealedBids map[string]FullBid `json:"revealedBids"`
-	Winners      []Winners          `json:"winners"`
-	Price        int                `json:"price"`
-	Status       string             `json:"status"`
-	Auditor      bool               `json:"auditor"`
+	Type                 string             `json:"objectType"`
+	ItemSold             string             `json:"item"`
+	Seller               string             `json:"seller"`
+	Quantity             int                `json:"quantity"`
+	Orgs                 []string           `json:"organizations"`
+	PrivateBids          map[string]BidHash `json:"privateBids"`
+	RevealedBids         map[string]FullBid `json:"revealedBids"`
+	Winners              []Winners          `json:"winners"`
+	Price                int                `json:"price"`
+	Status               string             `json:"status"`
+	Auditor              bool               `json:"auditor"`
+	AuditorOrg           string             `json:"auditorOrg"`
+	AuctionType          string             `json:"auctionType"`
+	StartPrice           int                `json:"startPrice"`
+	FloorPrice           int                `json:"floorPrice"`
+	Decrement            int                `json:"decrement"`
+	StepSeconds          int64              `json:"stepSeconds"`
+	StartTime            int64              `json:"startTime"`
+	Disputed             bool               `json:"disputed"`
+	History              []HistoryEntry     `json:"history"`
+	AllocationRule       string             `json:"allocationRule"`
+	EndorsementMode      string             `json:"endorsementMode"`
+	EndorsementThreshold int                `json:"endorsementThreshold"`
 }
 
 // FullBid is the structure of a revealed bid
@@ -48,13 +66,111 @@ type BidHash struct {
 	Hash string `json:"hash"`
 }
 
-// Winners stores the winners of the auction
+// Winners stores the winners of the auction and the price they pay per unit
 type Winners struct {
 	Buyer    string `json:"buyer"`
 	Quantity int    `json:"quantity"`
+	Price    int    `json:"price"`
 }
 
 const bidKeyType = "bid"
+const closedAuctionKeyType = "closedAuction"
+
+// Auction types. A sealed bid auction sells every unit at the price that clears the
+// auction, while a clock auction sells units at a price that drops over time
+const sealedBidAuction = "sealedBid"
+const clockAuction = "clock"
+
+// AcceptPrice is used by a buyer to buy units of an open clock auction at the current
+// price. If fewer units remain than the buyer asks for, the buyer gets the remaining
+// units and the auction ends. The buyer's organization joins the organizations that
+// endorse updates to the auction. The function returns the quantity bought
+func (s *SmartContract) AcceptPrice(ctx contractapi.TransactionContextInterface, auctionID string, quantity int) (int, error) {
+
+	// get ID of submitting client
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get the MSP ID of the buyer's org
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	// get the auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	if auction.AuctionType != clockAuction {
+		return 0, fmt.Errorf("can only accept the price of a clock auction")
+	}
+
+	status := auction.Status
+	if status != "open" {
+		return 0, fmt.Errorf("cannot accept price of closed or ended auction")
+	}
+
+	if auction.Disputed {
+		return 0, fmt.Errorf("auction is disputed, cannot accept price until the auditor resolves the dispute")
+	}
+
+	if auction.Seller == clientID {
+		return 0, fmt.Errorf("seller cannot buy from their own auction")
+	}
+
+	if quantity <= 0 {
+		return 0, fmt.Errorf("quantity must be a positive integer")
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	price := currentClockPrice(auction, now)
+
+	// the last buyer gets the remaining units
+	remainingQuantity := clockRemainingQuantity(auction)
+	if quantity > remainingQuantity {
+		quantity = remainingQuantity
+	}
+
+	winner := Winners{
+		Buyer:    clientID,
+		Quantity: quantity,
+		Price:    price,
+	}
+	auction.Winners = append(auction.Winners, winner)
+	auction.Price = price
+
+	if quantity == remainingQuantity {
+		auction.Status = string("ended")
+	}
+
+	// Add the buyer's organization to the list of participating organization's if it is not already
+	orgs := auction.Orgs
+	if !(contains(orgs, clientOrgID)) {
+		newOrgs := append(orgs, clientOrgID)
+		auction.Orgs = newOrgs
+
+		err = setAssetStateBasedEndorsement(ctx, auctionID, auction)
+		if err != nil {
+			return 0, fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
+		}
+	}
+
+	auctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, auctionJSON)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	return quantity, nil
+}
 
 // SubmitBid is used by the bidder to add the hash of that bid stored in private data to the
 // auction. Note that this function alters the auction in private state, and needs
@@ -73,12 +189,21 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("failed to get auction from public state %v", err)
 	}
 
+	// buyers accept the current price of a clock auction instead of bidding
+	if auction.AuctionType == clockAuction {
+		return fmt.Errorf("cannot submit bid to clock auction, accept the current price instead")
+	}
+
 	// the auction needs to be open for users to add their bid
 	status := auction.Status
 	if status != "open" {
 		return fmt.Errorf("cannot join closed or ended auction")
 	}
 
+	if auction.Disputed {
+		return fmt.Errorf("auction is disputed, cannot submit bid until the auditor resolves the dispute")
+	}
+
 	// get the inplicit collection name of bidder's org
 	collection, err := getCollectionName(ctx)
 	if err != nil {
@@ -117,7 +242,7 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, a
 		newOrgs := append(orgs, clientOrgID)
 		auction.Orgs = newOrgs
 
-		err = setAssetStateBasedEndorsement(ctx, auctionID, newOrgs, auction.Auditor)
+		err = setAssetStateBasedEndorsement(ctx, auctionID, auction)
 		if err != nil {
 			return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
 		}
@@ -183,7 +308,7 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 	// check that the bidders org is a participant in the auction
 	orgs := auction.Orgs
 	if !(contains(orgs, clientOrgID)) {
-		return fmt.Errorf("Particiant is not a member of the auction", err)
+		return fmt.Errorf("participant is not a member of the auction")
 	}
 
 	// Complete a series of three checks before we add the bid to the auction
@@ -195,6 +320,10 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("cannot reveal bid for open or ended auction")
 	}
 
+	if auction.Disputed {
+		return fmt.Errorf("auction is disputed, cannot reveal bid until the auditor resolves the dispute")
+	}
+
 	// check 2: check that hash of revealed bid matches hash of private bid
 	// on the public ledger. This checks that the bidder is telling the truth
 	// about the value of their bid
@@ -298,7 +427,7 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 	// check that the bidders org is a participant in the auction
 	orgs := auction.Orgs
 	if !(contains(orgs, clientOrgID)) {
-		return fmt.Errorf("Particiant is not a member of the auction", err)
+		return fmt.Errorf("participant is not a member of the auction")
 	}
 
 	// the auction can only be closed by the seller
@@ -319,8 +448,19 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("cannot close auction that is not open")
 	}
 
+	if auction.Disputed {
+		return fmt.Errorf("auction is disputed, cannot close auction until the auditor resolves the dispute")
+	}
+
 	auction.Status = string("closed")
 
+	// every participating organization needs to endorse the check for bids that were
+	// not revealed when the auction is ended
+	err = setClosedAuctionEndorsement(ctx, auctionID, auction)
+	if err != nil {
+		return fmt.Errorf("failed setting state based endorsement for closed auction: %v", err)
+	}
+
 	closedAuctionJSON, _ := json.Marshal(auction)
 
 	err = ctx.GetStub().PutState(auctionID, closedAuctionJSON)
@@ -350,7 +490,7 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 	// check that the bidders org is a participant in the auction
 	orgs := auction.Orgs
 	if !(contains(orgs, clientOrgID)) {
-		return fmt.Errorf("Particiant is not a member of the auction", err)
+		return fmt.Errorf("participant is not a member of the auction")
 	}
 
 	// Check that the auction is being ended by the seller
@@ -366,72 +506,72 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("auction can only be ended by seller: %v", err)
 	}
 
+	if auction.Disputed {
+		return fmt.Errorf("auction is disputed, cannot end auction until the auditor resolves the dispute")
+	}
+
+	// a clock auction has no bids to reveal, the seller can end it at any time to stop
+	// selling the remaining quantity
+	if auction.AuctionType == clockAuction {
+		if auction.Status == "ended" {
+			return fmt.Errorf("auction has already ended")
+		}
+
+		auction.Status = string("ended")
+
+		endedAuctionJSON, _ := json.Marshal(auction)
+
+		err = ctx.GetStub().PutState(auctionID, endedAuctionJSON)
+		if err != nil {
+			return fmt.Errorf("failed to end auction: %v", err)
+		}
+		return nil
+	}
+
 	status := auction.Status
 	if status != "closed" {
 		return fmt.Errorf("Can only end a closed auction")
 	}
 
-	// get the list of revealed bids
+	// check that bids have been revealed
 
-	revealedBidMap := auction.RevealedBids
 	if len(auction.RevealedBids) == 0 {
 		return fmt.Errorf("No bids have been revealed, cannot end auction: %v", err)
 	}
 
-	// sort the map of revealed bids to make it easier to calculate winners
-	// if bids are tied, fill smaller bids first
-	var bidders []FullBid
-
-	for _, bid := range revealedBidMap {
-		bidders = append(bidders, bid)
-	}
-
-	sort.Slice(bidders, func(p, q int) bool {
-		if bidders[p].Price > bidders[q].Price {
-			return true
-		}
-		if bidders[p].Price < bidders[q].Price {
-			return false
-		}
-		return bidders[p].Quantity < bidders[q].Quantity
-	})
+	// calculate the winners using the allocation rule of the auction. All winners
+	// pay the price that clears the auction
+	allocations, price := allocateBids(auction)
 
-	i := 0
-	remainingQuantity := auction.Quantity
-
-	// calculate the winners
-	for remainingQuantity > 0 {
-
-		// create the next winning bid
+	auction.Price = price
+	for _, allocation := range allocations {
 		winner := Winners{
-			Buyer:    bidders[i].Buyer,
-			Quantity: bidders[i].Quantity,
+			Buyer:    allocation.Buyer,
+			Quantity: allocation.Quantity,
+			Price:    price,
 		}
-
-		// add them to the list of winners and change the winning price
 		auction.Winners = append(auction.Winners, winner)
-		auction.Price = bidders[i].Price
+	}
 
-		// Calculate the quantity that goes to the winner
-		// if there is sufficient quantity to give them the full bid
-		if remainingQuantity > bidders[i].Quantity {
-			remainingQuantity = remainingQuantity - bidders[i].Quantity
+	// under the pro rata rule, an unrevealed bid at the clearing price would also change
+	// the allocation, so it has to be revealed as well
+	higherBidPrice := auction.Price
+	if auction.AllocationRule == proRataAllocation {
+		higherBidPrice = auction.Price - 1
+	}
 
-			// if there is not, give the remainder
-		} else {
-			auction.Winners[i].Quantity = remainingQuantity
-			remainingQuantity = 0
-		}
-		i++
-		if i == len(bidders) {
-			remainingQuantity = 0
+	// check if there is a winning bid that has yet to be revealed. Every participating
+	// organization needs to endorse the check
+	if len(auction.RevealedBids) < len(auction.PrivateBids) {
+		err = checkForHigherBid(ctx, higherBidPrice, auction.RevealedBids, auction.PrivateBids)
+		if err != nil {
+			return fmt.Errorf("Cannot end auction: %v", err)
 		}
-	}
 
-	// check if there is a winning bid that has yet to be revealed
-	err = checkForHigherBid(ctx, auction.Price, auction.RevealedBids, auction.PrivateBids)
-	if err != nil {
-		return fmt.Errorf("Cannot end auction: %v", err)
+		err = deleteClosedAuctionKey(ctx, auctionID)
+		if err != nil {
+			return err
+		}
 	}
 
 	auction.Status = string("ended")
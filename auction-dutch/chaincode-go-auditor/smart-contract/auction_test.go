@@ -0,0 +1,391 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/common"
+)
+
+const testAuctionID = "auction1"
+
+func TestCurrentClockPrice(t *testing.T) {
+	auction := &Auction{
+		AuctionType: clockAuction,
+		StartPrice:  100,
+		FloorPrice:  35,
+		Decrement:   10,
+		StepSeconds: 60,
+		StartTime:   1000,
+	}
+
+	tests := []struct {
+		now      int64
+		expected int
+	}{
+		{900, 100},
+		{1000, 100},
+		{1060, 90},
+		{1000 + 7*60, 35},
+		{1 << 62, 35},
+	}
+
+	for _, test := range tests {
+		price := currentClockPrice(auction, test.now)
+		if price != test.expected {
+			t.Errorf("at %d: expected price %d, got %d", test.now, test.expected, price)
+		}
+	}
+}
+
+func TestEndAuctionWithAuditor(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	putTestAuction(t, stub, &Auction{AuctionType: sealedBidAuction, Quantity: 10, AllocationRule: smallestFirstAllocation})
+
+	bidID1, bidJSON1 := submitTestBid(t, stub, "buyer1", "Org2MSP", 6, 100)
+	bidID2, bidJSON2 := submitTestBid(t, stub, "buyer2", "Org4MSP", 6, 90)
+
+	// the auditor can update the auction with any one participant
+	checkAuctionPolicy(t, stub, []string{"Org2MSP", "Org3MSP"}, true)
+	checkAuctionPolicy(t, stub, []string{"Org3MSP"}, false)
+
+	ctx := stub.startTransaction("buyer1", "Org2MSP", 100)
+	err := contract.CloseAuction(ctx, testAuctionID)
+	expectError(t, err, "auction can only be closed by seller")
+
+	ctx = stub.startTransaction("seller", "Org3MSP", 100)
+	err = contract.CloseAuction(ctx, testAuctionID)
+	expectError(t, err, "participant is not a member of the auction")
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 100)
+	err = contract.CloseAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx = stub.startTransaction("buyer2", "Org4MSP", 110)
+	stub.transient["bid"] = bidJSON1
+	err = contract.RevealBid(ctx, testAuctionID, bidID1)
+	expectError(t, err, "bid hash does not exist")
+
+	revealTestBid(t, stub, "buyer1", "Org2MSP", bidID1, bidJSON1)
+
+	// the auditor peer cannot read the unrevealed bid of Org4, it checks that its hash exists
+	os.Setenv("CORE_PEER_LOCALMSPID", "Org3MSP")
+	ctx = stub.startTransaction("seller", "Org1MSP", 120)
+	err = contract.EndAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Status != "ended" || auction.Price != 100 || len(auction.Winners) != 1 || auction.Winners[0].Quantity != 6 {
+		t.Fatalf("unexpected auction result %s %d %v", auction.Status, auction.Price, auction.Winners)
+	}
+
+	ctx = stub.startTransaction("buyer2", "Org4MSP", 130)
+	stub.transient["bid"] = bidJSON2
+	err = contract.RevealBid(ctx, testAuctionID, bidID2)
+	expectError(t, err, "cannot reveal bid for open or ended auction")
+}
+
+func TestAcceptPriceWithAuditor(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	putTestAuction(t, stub, &Auction{
+		AuctionType: clockAuction,
+		Quantity:    10,
+		StartPrice:  100,
+		FloorPrice:  50,
+		Decrement:   10,
+		StepSeconds: 60,
+		StartTime:   50,
+	})
+
+	// the auditor calculates the same price as the participants
+	ctx := stub.startTransaction("buyer1", "Org2MSP", 170)
+	quantity, err := contract.AcceptPrice(ctx, testAuctionID, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if quantity != 4 {
+		t.Fatalf("expected to buy 4 units, got %d", quantity)
+	}
+
+	ctx = stub.startTransaction("buyer2", "Org4MSP", 300)
+	quantity, err = contract.AcceptPrice(ctx, testAuctionID, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if quantity != 6 {
+		t.Fatalf("expected to buy the remaining 6 units, got %d", quantity)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Status != "ended" || len(auction.Winners) != 2 || auction.Winners[0].Price != 80 || auction.Winners[1].Price != 60 {
+		t.Fatalf("unexpected auction result %s %v", auction.Status, auction.Winners)
+	}
+	if strings.Join(auction.Orgs, ",") != "Org1MSP,Org2MSP,Org4MSP" {
+		t.Fatalf("unexpected participating organizations %v", auction.Orgs)
+	}
+	checkAuctionPolicy(t, stub, []string{"Org3MSP", "Org4MSP"}, true)
+}
+
+func TestEndAuctionWithoutOneOrg(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	putTestAuction(t, stub, &Auction{AuctionType: sealedBidAuction, Quantity: 10, AllocationRule: smallestFirstAllocation, EndorsementMode: endorseMajority})
+
+	bidOrgs := []string{"Org2MSP", "Org4MSP", "Org5MSP", "Org6MSP", "Org7MSP"}
+	everyOrg := append([]string{"Org1MSP"}, bidOrgs...)
+
+	var bidIDs []string
+	var bidJSONs [][]byte
+	for i, org := range bidOrgs {
+		bidID, bidJSON := submitTestBid(t, stub, fmt.Sprintf("buyer%d", i+1), org, 3, 100-10*i)
+		bidIDs = append(bidIDs, bidID)
+		bidJSONs = append(bidJSONs, bidJSON)
+	}
+
+	// the key of the closed auction requires every participating organization, or the
+	// auditor with any one of them
+	closeTestAuction(t, stub)
+	closedAuctionKey, err := stub.CreateCompositeKey(closedAuctionKeyType, []string{testAuctionID})
+	if err != nil {
+		t.Fatalf("failed to create composite key: %v", err)
+	}
+	checkKeyPolicy(t, stub, closedAuctionKey, everyOrg[:5], false)
+	checkKeyPolicy(t, stub, closedAuctionKey, []string{"Org3MSP", "Org7MSP"}, true)
+
+	for i, org := range bidOrgs {
+		revealTestBid(t, stub, fmt.Sprintf("buyer%d", i+1), org, bidIDs[i], bidJSONs[i])
+	}
+
+	// once every bid is revealed, the auction is ended with the policy of its endorsement
+	// mode, and Org7 can be left out
+	ctx := stub.startTransaction("seller", "Org1MSP", 120)
+	err = contract.EndAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := stub.State[closedAuctionKey]; !ok {
+		t.Fatal("expected the key of the closed auction to be left as it is")
+	}
+	checkAuctionPolicy(t, stub, everyOrg[:5], true)
+	checkAuctionPolicy(t, stub, everyOrg[:3], false)
+
+	auction := queryTestAuction(t, stub)
+	if auction.Status != "ended" || auction.Price != 70 || len(auction.Winners) != 4 {
+		t.Fatalf("unexpected auction result %s %d %v", auction.Status, auction.Price, auction.Winners)
+	}
+}
+
+// testStub adds the transient map and private data hashes to the shim mock stub. Each
+// transaction is started with startTransaction
+type testStub struct {
+	*shimtest.MockStub
+	transient map[string][]byte
+	txCount   int
+}
+
+func newTestStub(t *testing.T) *testStub {
+	t.Cleanup(func() { os.Unsetenv("CORE_PEER_LOCALMSPID") })
+	return &testStub{MockStub: shimtest.NewMockStub("auction", nil)}
+}
+
+// startTransaction starts a new transaction submitted by the client at the given time.
+// The organization of the peer is set separately, as the auditor peer endorses the
+// transactions of clients of other organizations
+func (stub *testStub) startTransaction(clientID string, mspID string, now int64) *contractapi.TransactionContext {
+	stub.txCount++
+	stub.MockTransactionStart(fmt.Sprintf("tx%d", stub.txCount))
+	stub.TxTimestamp = &timestamp.Timestamp{Seconds: now}
+	stub.transient = map[string][]byte{}
+
+	ctx := &contractapi.TransactionContext{}
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(&testClientIdentity{id: clientID, mspID: mspID})
+
+	return ctx
+}
+
+func (stub *testStub) GetTransient() (map[string][]byte, error) {
+	return stub.transient, nil
+}
+
+func (stub *testStub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value := stub.PvtState[collection][key]
+	if value == nil {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+// testClientIdentity is a client identity with a fixed MSP ID. Its ID is base64 encoded
+// like the IDs returned by the client identity library
+type testClientIdentity struct {
+	id    string
+	mspID string
+}
+
+func (identity *testClientIdentity) GetID() (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(identity.id)), nil
+}
+
+func (identity *testClientIdentity) GetMSPID() (string, error) {
+	return identity.mspID, nil
+}
+
+func (identity *testClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (identity *testClientIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	return nil
+}
+
+func (identity *testClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+// putTestAuction stores an open auction of the seller of Org1 in the same way as the
+// participants' smart contract creates it. Org3 is the auditor and every organization
+// endorses updates unless another auditor or endorsement mode is given
+func putTestAuction(t *testing.T, stub *testStub, auction *Auction) {
+	auction.Type = "auction"
+	auction.ItemSold = "tickets"
+	auction.Seller = "seller"
+	auction.Orgs = []string{"Org1MSP"}
+	auction.PrivateBids = make(map[string]BidHash)
+	auction.RevealedBids = make(map[string]FullBid)
+	auction.Winners = []Winners{}
+	auction.History = []HistoryEntry{}
+	auction.Status = "open"
+	auction.Auditor = true
+	if auction.AuditorOrg == "" {
+		auction.AuditorOrg = "Org3MSP"
+	}
+	if auction.EndorsementMode == "" {
+		auction.EndorsementMode = endorseAll
+	}
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 50)
+	auctionJSON, err := json.Marshal(auction)
+	if err != nil {
+		t.Fatalf("failed to marshal auction: %v", err)
+	}
+	err = ctx.GetStub().PutState(testAuctionID, auctionJSON)
+	if err != nil {
+		t.Fatalf("failed to put auction: %v", err)
+	}
+	err = setAssetStateBasedEndorsement(ctx, testAuctionID, auction)
+	if err != nil {
+		t.Fatalf("failed to set auction policy: %v", err)
+	}
+}
+
+// submitTestBid stores a bid in the implicit collection of the buyer's organization and
+// adds it to the auction, and returns the bid ID and the bid JSON
+func submitTestBid(t *testing.T, stub *testStub, buyer string, org string, quantity int, price int) (string, []byte) {
+	contract := SmartContract{}
+	bidJSON := []byte(fmt.Sprintf(`{"objectType":"bid","quantity":%d,"price":%d,"org":"%s","buyer":"%s"}`, quantity, price, org, buyer))
+
+	ctx := stub.startTransaction(buyer, org, 60)
+	bidID := ctx.GetStub().GetTxID()
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{testAuctionID, bidID})
+	if err != nil {
+		t.Fatalf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutPrivateData("_implicit_org_"+org, bidKey, bidJSON)
+	if err != nil {
+		t.Fatalf("failed to put bid: %v", err)
+	}
+
+	ctx = stub.startTransaction(buyer, org, 60)
+	err = contract.SubmitBid(ctx, testAuctionID, bidID)
+	if err != nil {
+		t.Fatalf("failed to submit bid: %v", err)
+	}
+
+	return bidID, bidJSON
+}
+
+// closeTestAuction closes the auction as the seller
+func closeTestAuction(t *testing.T, stub *testStub) {
+	contract := SmartContract{}
+	ctx := stub.startTransaction("seller", "Org1MSP", 100)
+	err := contract.CloseAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("failed to close auction: %v", err)
+	}
+}
+
+// revealTestBid reveals the bid of a buyer
+func revealTestBid(t *testing.T, stub *testStub, buyer string, org string, bidID string, bidJSON []byte) {
+	contract := SmartContract{}
+	ctx := stub.startTransaction(buyer, org, 110)
+	stub.transient["bid"] = bidJSON
+	err := contract.RevealBid(ctx, testAuctionID, bidID)
+	if err != nil {
+		t.Fatalf("failed to reveal bid: %v", err)
+	}
+}
+
+// queryTestAuction reads the auction from the world state
+func queryTestAuction(t *testing.T, stub *testStub) *Auction {
+	contract := SmartContract{}
+	auction, err := contract.QueryAuction(stub.startTransaction("seller", "Org1MSP", 0), testAuctionID)
+	if err != nil {
+		t.Fatalf("failed to query auction: %v", err)
+	}
+	return auction
+}
+
+// checkAuctionPolicy checks whether peers of the endorsing organizations satisfy the
+// endorsement policy of the auction
+func checkAuctionPolicy(t *testing.T, stub *testStub, endorsers []string, expected bool) {
+	t.Helper()
+	checkKeyPolicy(t, stub, testAuctionID, endorsers, expected)
+}
+
+// checkKeyPolicy checks whether peers of the endorsing organizations satisfy the
+// endorsement policy of a key
+func checkKeyPolicy(t *testing.T, stub *testStub, key string, endorsers []string, expected bool) {
+	t.Helper()
+
+	policyBytes, err := stub.GetStateValidationParameter(key)
+	if err != nil {
+		t.Fatalf("failed to get validation parameter: %v", err)
+	}
+	policy := &common.SignaturePolicyEnvelope{}
+	err = proto.Unmarshal(policyBytes, policy)
+	if err != nil {
+		t.Fatalf("failed to unmarshal policy: %v", err)
+	}
+
+	checkPolicy(t, policy, endorsers, expected)
+}
+
+// expectError fails the test unless the error contains the message
+func expectError(t *testing.T, err error, message string) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), message) {
+		t.Fatalf("expected an error containing %q, got %v", message, err)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"os"
+	"testing"
+)
+
+func TestResolveDispute(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	putTestAuction(t, stub, &Auction{AuctionType: sealedBidAuction, Quantity: 10, AllocationRule: smallestFirstAllocation})
+
+	bidID1, _ := submitTestBid(t, stub, "buyer1", "Org2MSP", 5, 100)
+	bidID2, bidJSON2 := submitTestBid(t, stub, "buyer2", "Org4MSP", 10, 90)
+
+	ctx := stub.startTransaction("buyer3", "Org2MSP", 70)
+	err := contract.RaiseDispute(ctx, testAuctionID, "wrong item")
+	expectError(t, err, "dispute can only be raised by the seller or a bidder of the auction")
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 70)
+	err = contract.RaiseDispute(ctx, testAuctionID, "bid of buyer1 submitted by mistake")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 80)
+	err = contract.CloseAuction(ctx, testAuctionID)
+	expectError(t, err, "auction is disputed, cannot close auction")
+
+	// only the auditor organization stored on the auction resolves the dispute
+	ctx = stub.startTransaction("auditor", "Org2MSP", 90)
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: dismissDispute})
+	expectError(t, err, "dispute can only be resolved by the auditor organization")
+
+	ctx = stub.startTransaction("auditor", "Org3MSP", 90)
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: voidBids, BidIDs: []string{bidID1}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Disputed || len(auction.PrivateBids) != 1 {
+		t.Fatalf("expected the bid of buyer1 to be voided, got %v %v", auction.Disputed, auction.PrivateBids)
+	}
+	if len(auction.History) != 2 || auction.History[1].Action != "resolveDispute" || auction.History[1].Org != "Org3MSP" {
+		t.Fatalf("unexpected history %v", auction.History)
+	}
+
+	// the auction goes on without the voided bid
+	closeTestAuction(t, stub)
+	revealTestBid(t, stub, "buyer2", "Org4MSP", bidID2, bidJSON2)
+
+	os.Setenv("CORE_PEER_LOCALMSPID", "Org3MSP")
+	ctx = stub.startTransaction("seller", "Org1MSP", 120)
+	err = contract.EndAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction = queryTestAuction(t, stub)
+	if auction.Status != "ended" || len(auction.Winners) != 1 || auction.Winners[0].Buyer != "buyer2" || auction.Winners[0].Quantity != 10 {
+		t.Fatalf("expected buyer2 to win every unit, got %s %v", auction.Status, auction.Winners)
+	}
+}
+
+func TestResolveDisputeOtherAuditor(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	putTestAuction(t, stub, &Auction{AuctionType: sealedBidAuction, Quantity: 10, AllocationRule: smallestFirstAllocation, AuditorOrg: "Org8MSP"})
+
+	// the auditor can update the auction with any one participant
+	submitTestBid(t, stub, "buyer1", "Org2MSP", 5, 100)
+	checkAuctionPolicy(t, stub, []string{"Org2MSP", "Org8MSP"}, true)
+	checkAuctionPolicy(t, stub, []string{"Org2MSP", "Org3MSP"}, false)
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 70)
+	err := contract.RaiseDispute(ctx, testAuctionID, "wrong item")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx = stub.startTransaction("auditor", "Org3MSP", 80)
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: voidAuction})
+	expectError(t, err, "dispute can only be resolved by the auditor organization")
+
+	ctx = stub.startTransaction("auditor", "Org8MSP", 80)
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: voidAuction})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Status != "void" || auction.Disputed {
+		t.Fatalf("expected a void auction, got %s %v", auction.Status, auction.Disputed)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+)
+
+// Endorsement modes. By default, every participating organization needs to endorse
+// an update to the auction. In the majority mode, a majority of the participating
+// organizations is enough, and in the nOfM mode the number of organizations given by
+// the endorsement threshold is enough. The seller's organization is always required.
+// Whatever the mode, every participating organization needs to endorse the end of a
+// closed auction while a bid that was not revealed could still win, so that the private
+// data collection of each organization is checked for those bids
+const endorseAll = "all"
+const endorseMajority = "majority"
+const endorseNOfM = "nOfM"
+
+// checkEndorsementMode is an internal function used to validate the endorsement mode
+// and threshold of a new auction. The threshold is only used by the nOfM mode
+func checkEndorsementMode(endorsementMode string, endorsementThreshold int) error {
+
+	switch endorsementMode {
+	case endorseAll, endorseMajority:
+		return nil
+	case endorseNOfM:
+		if endorsementThreshold < 1 {
+			return fmt.Errorf("endorsement threshold must be a positive integer")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("endorsement mode must be %s, %s or %s", endorseAll, endorseMajority, endorseNOfM)
+}
+
+// requiredEndorsements returns the number of participating organizations, the seller's
+// organization included, that need to endorse an update to the auction. An auction
+// without an endorsement mode requires every organization
+func requiredEndorsements(endorsementMode string, endorsementThreshold int, orgCount int) int {
+
+	switch endorsementMode {
+	case endorseMajority:
+		return orgCount/2 + 1
+	case endorseNOfM:
+		// the threshold can be above the number of organizations that joined so far
+		if endorsementThreshold < orgCount {
+			return endorsementThreshold
+		}
+	}
+
+	return orgCount
+}
+
+// participantPolicy returns the signature policy that the participating organizations
+// need to satisfy to update the auction. The policy identities must list the seller's
+// organization first, followed by the other participating organizations. For example,
+// a majority of five organizations is equivalent to AND(Org1, OutOf(2, Org2, Org3, Org4, Org5))
+func participantPolicy(orgCount int, endorsementMode string, endorsementThreshold int) *common.SignaturePolicy {
+
+	sellerPolicy := signedBy(0)
+
+	required := requiredEndorsements(endorsementMode, endorsementThreshold, orgCount)
+	if required <= 1 {
+		return sellerPolicy
+	}
+
+	otherPolicies := make([]*common.SignaturePolicy, orgCount-1)
+	for i := range otherPolicies {
+		otherPolicies[i] = signedBy(int32(i + 1))
+	}
+
+	return nOutOf(2, sellerPolicy, nOutOf(int32(required-1), otherPolicies...))
+}
+
+// signedBy returns a signature policy satisfied by the policy identity at the index
+func signedBy(index int32) *common.SignaturePolicy {
+	return &common.SignaturePolicy{
+		Type: &common.SignaturePolicy_SignedBy{
+			SignedBy: index,
+		},
+	}
+}
+
+// nOutOf returns a signature policy satisfied by n of the rules
+func nOutOf(n int32, rules ...*common.SignaturePolicy) *common.SignaturePolicy {
+	return &common.SignaturePolicy{
+		Type: &common.SignaturePolicy_NOutOf_{
+			NOutOf: &common.SignaturePolicy_NOutOf{
+				N:     n,
+				Rules: rules,
+			},
+		},
+	}
+}
@@ -0,0 +1,107 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"testing"
+)
+
+func TestAllocateBidsSmallestFirst(t *testing.T) {
+	auction := &Auction{
+		Quantity:       100,
+		AllocationRule: smallestFirstAllocation,
+		RevealedBids: map[string]FullBid{
+			"bid-a": {Quantity: 50, Price: 80, Buyer: "buyer1"},
+			"bid-b": {Quantity: 40, Price: 60, Buyer: "buyer2"},
+			"bid-c": {Quantity: 30, Price: 60, Buyer: "buyer3"},
+			"bid-d": {Quantity: 20, Price: 40, Buyer: "buyer4"},
+		},
+	}
+
+	allocations, price := allocateBids(auction)
+	if price != 60 {
+		t.Fatalf("expected clearing price 60, got %d", price)
+	}
+
+	expected := map[string]int{"buyer1": 50, "buyer3": 30, "buyer2": 20}
+	checkAllocations(t, allocations, expected)
+}
+
+func TestAllocateBidsProRata(t *testing.T) {
+	auction := &Auction{
+		Quantity:       100,
+		AllocationRule: proRataAllocation,
+		RevealedBids: map[string]FullBid{
+			"bid-a": {Quantity: 40, Price: 80, Buyer: "buyer1"},
+			"bid-b": {Quantity: 30, Price: 60, Buyer: "buyer2"},
+			"bid-c": {Quantity: 30, Price: 60, Buyer: "buyer3"},
+			"bid-d": {Quantity: 30, Price: 60, Buyer: "buyer4"},
+			"bid-e": {Quantity: 20, Price: 40, Buyer: "buyer5"},
+		},
+	}
+
+	// 60 units remain for 90 units bid at the clearing price: each share of 20 is exact
+	allocations, price := allocateBids(auction)
+	if price != 60 {
+		t.Fatalf("expected clearing price 60, got %d", price)
+	}
+	checkAllocations(t, allocations, map[string]int{"buyer1": 40, "buyer2": 20, "buyer3": 20, "buyer4": 20})
+
+	// 61 units remain: the shares round down to 20 and the leftover unit goes to the lowest bid key
+	auction.Quantity = 101
+	allocations, _ = allocateBids(auction)
+	checkAllocations(t, allocations, map[string]int{"buyer1": 40, "buyer2": 21, "buyer3": 20, "buyer4": 20})
+}
+
+func TestAllocateBidsProRataRemainders(t *testing.T) {
+	auction := &Auction{
+		Quantity:       10,
+		AllocationRule: proRataAllocation,
+		RevealedBids: map[string]FullBid{
+			"bid-a": {Quantity: 1, Price: 50, Buyer: "buyer1"},
+			"bid-b": {Quantity: 5, Price: 50, Buyer: "buyer2"},
+			"bid-c": {Quantity: 7, Price: 50, Buyer: "buyer3"},
+		},
+	}
+
+	// shares of 10 units over 13: 0.77, 3.85 and 5.38, the largest remainders get the 2 units left over
+	for i := 0; i < 10; i++ {
+		allocations, _ := allocateBids(auction)
+		checkAllocations(t, allocations, map[string]int{"buyer1": 1, "buyer2": 4, "buyer3": 5})
+	}
+}
+
+func TestAllocateBidsUndersubscribed(t *testing.T) {
+	auction := &Auction{
+		Quantity:       100,
+		AllocationRule: proRataAllocation,
+		RevealedBids: map[string]FullBid{
+			"bid-a": {Quantity: 30, Price: 80, Buyer: "buyer1"},
+			"bid-b": {Quantity: 20, Price: 60, Buyer: "buyer2"},
+		},
+	}
+
+	allocations, price := allocateBids(auction)
+	if price != 60 {
+		t.Fatalf("expected clearing price 60, got %d", price)
+	}
+	checkAllocations(t, allocations, map[string]int{"buyer1": 30, "buyer2": 20})
+}
+
+func checkAllocations(t *testing.T, allocations []Allocation, expected map[string]int) {
+	t.Helper()
+
+	if len(allocations) != len(expected) {
+		t.Fatalf("expected %d allocations, got %d: %v", len(expected), len(allocations), allocations)
+	}
+	for _, allocation := range allocations {
+		if allocation.Quantity != expected[allocation.Buyer] {
+			t.Errorf("expected %d units for %s, got %d", expected[allocation.Buyer], allocation.Buyer, allocation.Quantity)
+		}
+		if allocation.Explanation == "" {
+			t.Errorf("allocation of %s has no explanation", allocation.Buyer)
+		}
+	}
+}
@@ -77,6 +77,62 @@ func (s *SmartContract) QueryBid(ctx contractapi.TransactionContextInterface, au
 	return bid, nil
 }
 
+// QueryCurrentPrice returns the price of a clock auction at the time of the query, and
+// the quantity that is still for sale
+func (s *SmartContract) QueryCurrentPrice(ctx contractapi.TransactionContextInterface, auctionID string) (*ClockPrice, error) {
+
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	if auction.AuctionType != clockAuction {
+		return nil, fmt.Errorf("auction %v is not a clock auction", auctionID)
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClockPrice{
+		Price:             currentClockPrice(auction, now),
+		RemainingQuantity: clockRemainingQuantity(auction),
+	}, nil
+}
+
+// QueryAllocation explains how the quantity of each winner of an ended sealed bid auction
+// was computed from the revealed bids and the allocation rule of the auction
+func (s *SmartContract) QueryAllocation(ctx contractapi.TransactionContextInterface, auctionID string) (*AllocationReport, error) {
+
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	if auction.AuctionType == clockAuction {
+		return nil, fmt.Errorf("auction %v is a clock auction, winners buy at the price they accept", auctionID)
+	}
+
+	if auction.Status != "ended" {
+		return nil, fmt.Errorf("auction %v has not ended", auctionID)
+	}
+
+	allocations, price := allocateBids(auction)
+
+	allocationRule := auction.AllocationRule
+	if allocationRule == "" {
+		allocationRule = smallestFirstAllocation
+	}
+
+	return &AllocationReport{
+		AllocationRule: allocationRule,
+		Quantity:       auction.Quantity,
+		Price:          price,
+		Allocations:    allocations,
+	}, nil
+}
+
 // checkForHigherBid is an internal function that is used to determine if a winning bid has yet to be revealed
 func checkForHigherBid(ctx contractapi.TransactionContextInterface, auctionPrice int, revealedBidders map[string]FullBid, bidders map[string]BidHash) error {
 
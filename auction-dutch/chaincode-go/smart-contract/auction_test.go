@@ -0,0 +1,458 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/common"
+)
+
+const testAuctionID = "auction1"
+
+func TestCurrentClockPrice(t *testing.T) {
+	auction := &Auction{
+		AuctionType: clockAuction,
+		StartPrice:  100,
+		FloorPrice:  35,
+		Decrement:   10,
+		StepSeconds: 60,
+		StartTime:   1000,
+	}
+
+	tests := []struct {
+		now      int64
+		expected int
+	}{
+		{900, 100},
+		{1000, 100},
+		{1059, 100},
+		{1060, 90},
+		{1000 + 6*60, 40},
+		{1000 + 7*60, 35},
+		{1 << 62, 35},
+	}
+
+	for _, test := range tests {
+		price := currentClockPrice(auction, test.now)
+		if price != test.expected {
+			t.Errorf("at %d: expected price %d, got %d", test.now, test.expected, price)
+		}
+	}
+}
+
+func TestClockRemainingQuantity(t *testing.T) {
+	auction := &Auction{
+		Quantity: 100,
+		Winners: []Winners{
+			{Buyer: "buyer1", Quantity: 30, Price: 90},
+			{Buyer: "buyer2", Quantity: 50, Price: 80},
+		},
+	}
+
+	remainingQuantity := clockRemainingQuantity(auction)
+	if remainingQuantity != 20 {
+		t.Errorf("expected remaining quantity 20, got %d", remainingQuantity)
+	}
+}
+
+func TestClockAuctionEndorsement(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 50)
+	err := contract.CreateClockAuction(ctx, testAuctionID, "tickets", 10, 100, 50, 10, 60, "noAuditor", endorseNOfM, 0)
+	expectError(t, err, "endorsement threshold must be a positive integer")
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 50)
+	err = contract.CreateClockAuction(ctx, testAuctionID, "tickets", 10, 100, 50, 10, 60, "noAuditor", endorseMajority, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+
+	// each buyer's organization joins the organizations that endorse the auction
+	for _, buyer := range []struct{ id, org string }{{"buyer1", "Org2MSP"}, {"buyer2", "Org4MSP"}, {"buyer3", "Org2MSP"}} {
+		ctx = stub.startTransaction(buyer.id, buyer.org, 60)
+		_, err = contract.AcceptPrice(ctx, testAuctionID, 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	auction := queryTestAuction(t, stub)
+	if strings.Join(auction.Orgs, ",") != "Org1MSP,Org2MSP,Org4MSP" {
+		t.Fatalf("unexpected participating organizations %v", auction.Orgs)
+	}
+	if auction.EndorsementMode != endorseMajority {
+		t.Fatalf("expected the majority endorsement mode, got %s", auction.EndorsementMode)
+	}
+
+	// a majority of the three organizations, the seller's organization included
+	checkAuctionPolicy(t, stub, []string{"Org1MSP", "Org4MSP"}, true)
+	checkAuctionPolicy(t, stub, []string{"Org2MSP", "Org4MSP"}, false)
+	checkAuctionPolicy(t, stub, []string{"Org1MSP"}, false)
+}
+
+func TestCreateAuctionQuantity(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+
+	for _, quantity := range []int{0, -10} {
+		ctx := stub.startTransaction("seller", "Org1MSP", 50)
+		err := contract.CreateAuction(ctx, testAuctionID, "tickets", quantity, noAuditor, smallestFirstAllocation, endorseAll, 0)
+		expectError(t, err, "quantity must be a positive integer")
+	}
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 50)
+	_, err := contract.QueryAuction(ctx, testAuctionID)
+	expectError(t, err, "does not exist")
+}
+
+func TestEndAuctionTiedBids(t *testing.T) {
+	tests := []struct {
+		allocationRule string
+		expected       map[string]int
+	}{
+		// the smaller bid at the clearing price is filled first
+		{smallestFirstAllocation, map[string]int{"buyer1": 4, "buyer3": 3, "buyer2": 3}},
+		// the bids at the clearing price share the remaining 6 units in proportion to
+		// their quantities
+		{proRataAllocation, map[string]int{"buyer1": 4, "buyer2": 4, "buyer3": 2}},
+	}
+
+	for _, test := range tests {
+		stub := newTestStub(t)
+		contract := SmartContract{}
+
+		ctx := stub.startTransaction("seller", "Org1MSP", 50)
+		err := contract.CreateAuction(ctx, testAuctionID, "tickets", 10, noAuditor, test.allocationRule, endorseAll, 0)
+		if err != nil {
+			t.Fatalf("failed to create auction: %v", err)
+		}
+
+		bidID1, bidJSON1 := submitTestBid(t, stub, "buyer1", "Org2MSP", 4, 100)
+		bidID2, bidJSON2 := submitTestBid(t, stub, "buyer2", "Org4MSP", 6, 90)
+		bidID3, bidJSON3 := submitTestBid(t, stub, "buyer3", "Org2MSP", 3, 90)
+		bidID4, bidJSON4 := submitTestBid(t, stub, "buyer4", "Org4MSP", 5, 80)
+		closeTestAuction(t, stub)
+		revealTestBid(t, stub, "buyer1", "Org2MSP", bidID1, bidJSON1)
+		revealTestBid(t, stub, "buyer2", "Org4MSP", bidID2, bidJSON2)
+		revealTestBid(t, stub, "buyer3", "Org2MSP", bidID3, bidJSON3)
+		revealTestBid(t, stub, "buyer4", "Org4MSP", bidID4, bidJSON4)
+
+		// the allocation of an auction that has not ended cannot be queried
+		ctx = stub.startTransaction("seller", "Org1MSP", 120)
+		_, err = contract.QueryAllocation(ctx, testAuctionID)
+		expectError(t, err, "has not ended")
+
+		err = contract.EndAuction(ctx, testAuctionID)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.allocationRule, err)
+		}
+
+		auction := queryTestAuction(t, stub)
+		if auction.Status != "ended" || auction.Price != 90 {
+			t.Fatalf("%s: expected the auction to end at price 90, got %s %d", test.allocationRule, auction.Status, auction.Price)
+		}
+		winners := map[string]int{}
+		for _, winner := range auction.Winners {
+			if winner.Price != 90 {
+				t.Errorf("%s: expected %s to pay the clearing price, got %d", test.allocationRule, winner.Buyer, winner.Price)
+			}
+			winners[winner.Buyer] = winner.Quantity
+		}
+		if !reflect.DeepEqual(winners, test.expected) {
+			t.Fatalf("%s: expected winners %v, got %v", test.allocationRule, test.expected, winners)
+		}
+
+		// the allocation report explains the same winners
+		ctx = stub.startTransaction("buyer4", "Org4MSP", 130)
+		report, err := contract.QueryAllocation(ctx, testAuctionID)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.allocationRule, err)
+		}
+		if report.AllocationRule != test.allocationRule || report.Quantity != 10 || report.Price != 90 {
+			t.Fatalf("%s: unexpected allocation report %v", test.allocationRule, report)
+		}
+		checkAllocations(t, report.Allocations, test.expected)
+	}
+}
+
+func TestClosedAuctionRequiresEveryOrg(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 50)
+	err := contract.CreateAuction(ctx, testAuctionID, "tickets", 10, noAuditor, smallestFirstAllocation, endorseMajority, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+
+	bidID, bidJSON := submitTestBid(t, stub, "buyer1", "Org2MSP", 5, 100)
+	submitTestBid(t, stub, "buyer2", "Org4MSP", 5, 80)
+	everyOrg := []string{"Org1MSP", "Org2MSP", "Org4MSP"}
+
+	// the auction keeps its endorsement mode once it is closed, while the key of the
+	// closed auction requires every participating organization
+	closeTestAuction(t, stub)
+	closedAuctionKey := testClosedAuctionKey(t, stub)
+	checkAuctionPolicy(t, stub, everyOrg[:2], true)
+	checkKeyPolicy(t, stub, closedAuctionKey, everyOrg[:2], false)
+	checkKeyPolicy(t, stub, closedAuctionKey, everyOrg, true)
+
+	// the organization holding an unrevealed bid cannot be left out of the end of the
+	// auction, as the end of the auction deletes the key
+	revealTestBid(t, stub, "buyer1", "Org2MSP", bidID, bidJSON)
+	ctx = stub.startTransaction("seller", "Org1MSP", 120)
+	err = contract.EndAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := stub.State[closedAuctionKey]; ok {
+		t.Fatal("expected the end of the auction to delete the key of the closed auction")
+	}
+}
+
+func TestEndAuctionWithoutOneOrg(t *testing.T) {
+	bidOrgs := []string{"Org2MSP", "Org4MSP", "Org5MSP", "Org6MSP", "Org7MSP"}
+	everyOrg := append([]string{"Org1MSP"}, bidOrgs...)
+
+	tests := []struct {
+		endorsementMode      string
+		endorsementThreshold int
+	}{
+		{endorseMajority, 0},
+		{endorseNOfM, 4},
+	}
+
+	for _, test := range tests {
+		stub := newTestStub(t)
+		contract := SmartContract{}
+
+		ctx := stub.startTransaction("seller", "Org1MSP", 50)
+		err := contract.CreateAuction(ctx, testAuctionID, "tickets", 10, noAuditor, smallestFirstAllocation, test.endorsementMode, test.endorsementThreshold)
+		if err != nil {
+			t.Fatalf("failed to create auction: %v", err)
+		}
+
+		var bidIDs []string
+		var bidJSONs [][]byte
+		for i, org := range bidOrgs {
+			bidID, bidJSON := submitTestBid(t, stub, fmt.Sprintf("buyer%d", i+1), org, 3, 100-10*i)
+			bidIDs = append(bidIDs, bidID)
+			bidJSONs = append(bidJSONs, bidJSON)
+		}
+		closeTestAuction(t, stub)
+		for i, org := range bidOrgs {
+			revealTestBid(t, stub, fmt.Sprintf("buyer%d", i+1), org, bidIDs[i], bidJSONs[i])
+		}
+
+		ctx = stub.startTransaction("seller", "Org1MSP", 120)
+		err = contract.EndAuction(ctx, testAuctionID)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.endorsementMode, err)
+		}
+
+		auction := queryTestAuction(t, stub)
+		if auction.Status != "ended" || auction.Price != 70 || len(auction.Winners) != 4 {
+			t.Fatalf("%s: unexpected auction result %s %d %v", test.endorsementMode, auction.Status, auction.Price, auction.Winners)
+		}
+
+		// once every bid is revealed, the end of the auction leaves the key of the closed
+		// auction as it is, so only the policy of the endorsement mode applies and Org7
+		// can be left out
+		closedAuctionKey := testClosedAuctionKey(t, stub)
+		if _, ok := stub.State[closedAuctionKey]; !ok {
+			t.Fatalf("%s: expected the key of the closed auction to be left as it is", test.endorsementMode)
+		}
+		checkKeyPolicy(t, stub, closedAuctionKey, everyOrg[:5], false)
+		checkAuctionPolicy(t, stub, everyOrg[:5], true)
+		checkAuctionPolicy(t, stub, everyOrg[:3], false)
+	}
+}
+
+// testStub adds the transient map and private data hashes to the shim mock stub. Each
+// transaction is started with startTransaction
+type testStub struct {
+	*shimtest.MockStub
+	transient map[string][]byte
+	txCount   int
+}
+
+func newTestStub(t *testing.T) *testStub {
+	t.Cleanup(func() { os.Unsetenv("CORE_PEER_LOCALMSPID") })
+	return &testStub{MockStub: shimtest.NewMockStub("auction", nil)}
+}
+
+// startTransaction starts a new transaction submitted by the client at the given time,
+// and sent to a peer of the client's organization
+func (stub *testStub) startTransaction(clientID string, mspID string, now int64) *contractapi.TransactionContext {
+	stub.txCount++
+	stub.MockTransactionStart(fmt.Sprintf("tx%d", stub.txCount))
+	stub.TxTimestamp = &timestamp.Timestamp{Seconds: now}
+	stub.transient = map[string][]byte{}
+	os.Setenv("CORE_PEER_LOCALMSPID", mspID)
+
+	ctx := &contractapi.TransactionContext{}
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(&testClientIdentity{id: clientID, mspID: mspID})
+
+	return ctx
+}
+
+func (stub *testStub) GetTransient() (map[string][]byte, error) {
+	return stub.transient, nil
+}
+
+func (stub *testStub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value := stub.PvtState[collection][key]
+	if value == nil {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+// testClientIdentity is a client identity with a fixed MSP ID. Its ID is base64 encoded
+// like the IDs returned by the client identity library
+type testClientIdentity struct {
+	id    string
+	mspID string
+}
+
+func (identity *testClientIdentity) GetID() (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(identity.id)), nil
+}
+
+func (identity *testClientIdentity) GetMSPID() (string, error) {
+	return identity.mspID, nil
+}
+
+func (identity *testClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (identity *testClientIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	return nil
+}
+
+func (identity *testClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+// createTestAuction creates a sealed bid auction with an auditor, sold by the seller of Org1
+func createTestAuction(t *testing.T, stub *testStub, quantity int) {
+	contract := SmartContract{}
+	ctx := stub.startTransaction("seller", "Org1MSP", 50)
+	err := contract.CreateAuction(ctx, testAuctionID, "tickets", quantity, "Org3MSP", smallestFirstAllocation, endorseAll, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+}
+
+// submitTestBid creates a bid and adds it to the auction, and returns the bid ID and the bid JSON
+func submitTestBid(t *testing.T, stub *testStub, buyer string, org string, quantity int, price int) (string, []byte) {
+	contract := SmartContract{}
+	bidJSON := []byte(fmt.Sprintf(`{"objectType":"bid","quantity":%d,"price":%d,"org":"%s","buyer":"%s"}`, quantity, price, org, buyer))
+
+	ctx := stub.startTransaction(buyer, org, 60)
+	stub.transient["bid"] = bidJSON
+	bidID, err := contract.Bid(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("failed to create bid: %v", err)
+	}
+
+	ctx = stub.startTransaction(buyer, org, 60)
+	err = contract.SubmitBid(ctx, testAuctionID, bidID)
+	if err != nil {
+		t.Fatalf("failed to submit bid: %v", err)
+	}
+
+	return bidID, bidJSON
+}
+
+// closeTestAuction closes the auction as the seller
+func closeTestAuction(t *testing.T, stub *testStub) {
+	contract := SmartContract{}
+	ctx := stub.startTransaction("seller", "Org1MSP", 100)
+	err := contract.CloseAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("failed to close auction: %v", err)
+	}
+}
+
+// revealTestBid reveals the bid of a buyer
+func revealTestBid(t *testing.T, stub *testStub, buyer string, org string, bidID string, bidJSON []byte) {
+	contract := SmartContract{}
+	ctx := stub.startTransaction(buyer, org, 110)
+	stub.transient["bid"] = bidJSON
+	err := contract.RevealBid(ctx, testAuctionID, bidID)
+	if err != nil {
+		t.Fatalf("failed to reveal bid: %v", err)
+	}
+}
+
+// queryTestAuction reads the auction from the world state
+func queryTestAuction(t *testing.T, stub *testStub) *Auction {
+	contract := SmartContract{}
+	auction, err := contract.QueryAuction(stub.startTransaction("seller", "Org1MSP", 0), testAuctionID)
+	if err != nil {
+		t.Fatalf("failed to query auction: %v", err)
+	}
+	return auction
+}
+
+// testClosedAuctionKey returns the key that CloseAuction stores for the auction
+func testClosedAuctionKey(t *testing.T, stub *testStub) string {
+	closedAuctionKey, err := stub.CreateCompositeKey(closedAuctionKeyType, []string{testAuctionID})
+	if err != nil {
+		t.Fatalf("failed to create composite key: %v", err)
+	}
+	return closedAuctionKey
+}
+
+// checkAuctionPolicy checks whether peers of the endorsing organizations satisfy the
+// endorsement policy of the auction
+func checkAuctionPolicy(t *testing.T, stub *testStub, endorsers []string, expected bool) {
+	t.Helper()
+	checkKeyPolicy(t, stub, testAuctionID, endorsers, expected)
+}
+
+// checkKeyPolicy checks whether peers of the endorsing organizations satisfy the
+// endorsement policy of a key
+func checkKeyPolicy(t *testing.T, stub *testStub, key string, endorsers []string, expected bool) {
+	t.Helper()
+
+	policyBytes, err := stub.GetStateValidationParameter(key)
+	if err != nil {
+		t.Fatalf("failed to get validation parameter: %v", err)
+	}
+	policy := &common.SignaturePolicyEnvelope{}
+	err = proto.Unmarshal(policyBytes, policy)
+	if err != nil {
+		t.Fatalf("failed to unmarshal policy: %v", err)
+	}
+
+	checkPolicy(t, policy, endorsers, expected)
+}
+
+// expectError fails the test unless the error contains the message
+func expectError(t *testing.T, err error, message string) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), message) {
+		t.Fatalf("expected an error containing %q, got %v", message, err)
+	}
+}
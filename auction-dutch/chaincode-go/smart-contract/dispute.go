@@ -0,0 +1,267 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// HistoryEntry records a step of a dispute in the history of the auction
+type HistoryEntry struct {
+	TxID      string `json:"txID"`
+	Timestamp int64  `json:"timestamp"`
+	Action    string `json:"action"`
+	Submitter string `json:"submitter"`
+	Org       string `json:"org"`
+	Details   string `json:"details"`
+}
+
+// DisputeDecision is the decision of the auditor on a dispute. The action is one of
+// "dismiss", "voidBids" or "voidAuction". BidIDs are the transaction IDs of the bids
+// that are voided by a "voidBids" decision
+type DisputeDecision struct {
+	Action string   `json:"action"`
+	BidIDs []string `json:"bidIDs" metadata:"bidIDs,optional"`
+}
+
+// Dispute decisions
+const dismissDispute = "dismiss"
+const voidBids = "voidBids"
+const voidAuction = "voidAuction"
+
+// RaiseDispute is used by the seller or a bidder to ask the auditor to intervene in an
+// auction that has not ended. The auction cannot be ended until the auditor resolves
+// the dispute. Bidders whose bids have been revealed or who won units of a clock auction
+// can raise a dispute directly. A bidder whose bid is still private needs to pass the
+// bid in the transient map, in the same way as when the bid is revealed
+func (s *SmartContract) RaiseDispute(ctx contractapi.TransactionContextInterface, auctionID string, reason string) error {
+
+	// get auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	// get ID of submitting client
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if auction.Seller != clientID {
+		bidder, err := isBidder(ctx, auction, clientID)
+		if err != nil {
+			return err
+		}
+		if !bidder {
+			return fmt.Errorf("dispute can only be raised by the seller or a bidder of the auction")
+		}
+	}
+
+	if !auction.Auditor {
+		return fmt.Errorf("auction has no auditor to resolve a dispute")
+	}
+
+	status := auction.Status
+	if status != "open" && status != "closed" {
+		return fmt.Errorf("cannot raise a dispute on an ended or void auction")
+	}
+
+	if auction.Disputed {
+		return fmt.Errorf("auction is already disputed")
+	}
+
+	if reason == "" {
+		return fmt.Errorf("reason for the dispute must not be empty")
+	}
+
+	auction.Disputed = true
+
+	err = addHistoryEntry(ctx, auction, "raiseDispute", clientID, reason)
+	if err != nil {
+		return err
+	}
+
+	disputedAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, disputedAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	return nil
+}
+
+// ResolveDispute is used by the auditor organization to resolve the dispute of an
+// auction. The auditor can dismiss the dispute, void specific bids, or void the whole
+// auction. Voided bids are removed from the auction, and a void auction cannot be
+// ended. The auction can be ended again once the dispute is resolved
+func (s *SmartContract) ResolveDispute(ctx contractapi.TransactionContextInterface, auctionID string, decision DisputeDecision) error {
+
+	// get the MSP ID of the auditor's org
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	// get ID of submitting client
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	if !auction.Auditor || clientOrgID != auction.AuditorOrg {
+		return fmt.Errorf("dispute can only be resolved by the auditor organization")
+	}
+
+	if !auction.Disputed {
+		return fmt.Errorf("auction is not disputed")
+	}
+
+	var details string
+
+	switch decision.Action {
+	case dismissDispute:
+		details = "dispute dismissed"
+
+	case voidBids:
+		if len(decision.BidIDs) == 0 {
+			return fmt.Errorf("no bids to void")
+		}
+
+		for _, txID := range decision.BidIDs {
+			bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, txID})
+			if err != nil {
+				return fmt.Errorf("failed to create composite key: %v", err)
+			}
+
+			if _, bidInAuction := auction.PrivateBids[bidKey]; !bidInAuction {
+				return fmt.Errorf("bid %v is not a bid of the auction", txID)
+			}
+
+			delete(auction.PrivateBids, bidKey)
+			delete(auction.RevealedBids, bidKey)
+		}
+		details = "voided bids " + strings.Join(decision.BidIDs, ", ")
+
+	case voidAuction:
+		auction.Status = string("void")
+		details = "auction voided"
+
+	default:
+		return fmt.Errorf("decision must be %s, %s or %s", dismissDispute, voidBids, voidAuction)
+	}
+
+	auction.Disputed = false
+
+	err = addHistoryEntry(ctx, auction, "resolveDispute", clientID, details)
+	if err != nil {
+		return err
+	}
+
+	resolvedAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, resolvedAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	return nil
+}
+
+// isBidder is an internal function that checks if a client revealed a bid in the
+// auction, won units of the auction, or passed one of the private bids of the auction
+// in the transient map
+func isBidder(ctx contractapi.TransactionContextInterface, auction *Auction, clientID string) (bool, error) {
+	for _, bid := range auction.RevealedBids {
+		if bid.Buyer == clientID {
+			return true, nil
+		}
+	}
+	for _, winner := range auction.Winners {
+		if winner.Buyer == clientID {
+			return true, nil
+		}
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return false, fmt.Errorf("error getting transient: %v", err)
+	}
+
+	transientBidJSON, ok := transientMap["bid"]
+	if !ok {
+		return false, nil
+	}
+
+	// the hash of the bid needs to match a private bid of the auction, and the
+	// hash of the bid stored in the collection of the bidder's organization
+	hash := sha256.New()
+	hash.Write(transientBidJSON)
+	calculatedBidJSONHash := fmt.Sprintf("%x", hash.Sum(nil))
+
+	for bidKey, privateBid := range auction.PrivateBids {
+		if privateBid.Hash != calculatedBidJSONHash {
+			continue
+		}
+
+		collection := "_implicit_org_" + privateBid.Org
+		bidHash, err := ctx.GetStub().GetPrivateDataHash(collection, bidKey)
+		if err != nil {
+			return false, fmt.Errorf("failed to read bid hash from collection: %v", err)
+		}
+		if fmt.Sprintf("%x", bidHash) != calculatedBidJSONHash {
+			return false, fmt.Errorf("hash of bid does not match the hash in the collection")
+		}
+
+		var bid FullBid
+		err = json.Unmarshal(transientBidJSON, &bid)
+		if err != nil {
+			return false, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+
+		return bid.Buyer == clientID, nil
+	}
+
+	return false, nil
+}
+
+// addHistoryEntry is an internal function that records a step of a dispute in the
+// history of the auction
+func addHistoryEntry(ctx contractapi.TransactionContextInterface, auction *Auction, action string, submitter string, details string) error {
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	entry := HistoryEntry{
+		TxID:      ctx.GetStub().GetTxID(),
+		Timestamp: now,
+		Action:    action,
+		Submitter: submitter,
+		Org:       clientOrgID,
+		Details:   details,
+	}
+	auction.History = append(auction.History, entry)
+
+	return nil
+}
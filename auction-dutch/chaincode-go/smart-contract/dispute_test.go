@@ -0,0 +1,267 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"testing"
+)
+
+func TestRaiseDispute(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, 10)
+
+	_, bidJSON := submitTestBid(t, stub, "buyer1", "Org2MSP", 5, 100)
+
+	// a client without a bid cannot raise a dispute, even with the bid of another buyer
+	ctx := stub.startTransaction("buyer2", "Org2MSP", 70)
+	err := contract.RaiseDispute(ctx, testAuctionID, "bid submitted by mistake")
+	expectError(t, err, "dispute can only be raised by the seller or a bidder of the auction")
+
+	ctx = stub.startTransaction("buyer2", "Org2MSP", 70)
+	stub.transient["bid"] = bidJSON
+	err = contract.RaiseDispute(ctx, testAuctionID, "bid submitted by mistake")
+	expectError(t, err, "dispute can only be raised by the seller or a bidder of the auction")
+
+	// the buyer of an unrevealed bid passes the bid in the transient map
+	ctx = stub.startTransaction("buyer1", "Org2MSP", 70)
+	stub.transient["bid"] = bidJSON
+	err = contract.RaiseDispute(ctx, testAuctionID, "")
+	expectError(t, err, "reason for the dispute must not be empty")
+
+	err = contract.RaiseDispute(ctx, testAuctionID, "bid submitted by mistake")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if !auction.Disputed || len(auction.History) != 1 {
+		t.Fatalf("expected a disputed auction with one history entry, got %v %v", auction.Disputed, auction.History)
+	}
+	entry := auction.History[0]
+	if entry.Action != "raiseDispute" || entry.Submitter != "buyer1" || entry.Org != "Org2MSP" || entry.Details != "bid submitted by mistake" || entry.Timestamp != 70 {
+		t.Fatalf("unexpected history entry %v", entry)
+	}
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 80)
+	err = contract.RaiseDispute(ctx, testAuctionID, "another reason")
+	expectError(t, err, "auction is already disputed")
+
+	// the auction cannot change until the auditor resolves the dispute
+	ctx = stub.startTransaction("buyer2", "Org2MSP", 80)
+	stub.transient["bid"] = []byte(`{"objectType":"bid","quantity":5,"price":90,"org":"Org2MSP","buyer":"buyer2"}`)
+	bidID, err := contract.Bid(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx = stub.startTransaction("buyer2", "Org2MSP", 80)
+	err = contract.SubmitBid(ctx, testAuctionID, bidID)
+	expectError(t, err, "auction is disputed, cannot submit bid")
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 90)
+	err = contract.CloseAuction(ctx, testAuctionID)
+	expectError(t, err, "auction is disputed, cannot close auction")
+}
+
+func TestRaiseDisputeOnClockAuction(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 50)
+	err := contract.CreateClockAuction(ctx, testAuctionID, "tickets", 10, 100, 50, 10, 60, "Org3MSP", endorseAll, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+
+	ctx = stub.startTransaction("buyer1", "Org2MSP", 60)
+	_, err = contract.AcceptPrice(ctx, testAuctionID, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a buyer who won units of a clock auction can raise a dispute
+	ctx = stub.startTransaction("buyer1", "Org2MSP", 70)
+	err = contract.RaiseDispute(ctx, testAuctionID, "wrong price")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx = stub.startTransaction("buyer2", "Org2MSP", 80)
+	_, err = contract.AcceptPrice(ctx, testAuctionID, 4)
+	expectError(t, err, "auction is disputed, cannot accept price")
+
+	auction := queryTestAuction(t, stub)
+	if len(auction.Winners) != 1 {
+		t.Fatalf("expected one winner, got %v", auction.Winners)
+	}
+}
+
+func TestResolveDispute(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, 10)
+
+	bidID1, bidJSON1 := submitTestBid(t, stub, "buyer1", "Org2MSP", 5, 100)
+	bidID2, bidJSON2 := submitTestBid(t, stub, "buyer2", "Org2MSP", 10, 90)
+	closeTestAuction(t, stub)
+	revealTestBid(t, stub, "buyer1", "Org2MSP", bidID1, bidJSON1)
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 120)
+	err := contract.RaiseDispute(ctx, testAuctionID, "bid of buyer1 submitted by mistake")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx = stub.startTransaction("buyer2", "Org2MSP", 120)
+	stub.transient["bid"] = bidJSON2
+	err = contract.RevealBid(ctx, testAuctionID, bidID2)
+	expectError(t, err, "auction is disputed, cannot reveal bid")
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 120)
+	err = contract.EndAuction(ctx, testAuctionID)
+	expectError(t, err, "auction is disputed, cannot end auction")
+
+	// only the auditor organization resolves the dispute
+	ctx = stub.startTransaction("seller", "Org1MSP", 130)
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: dismissDispute})
+	expectError(t, err, "dispute can only be resolved by the auditor organization")
+
+	ctx = stub.startTransaction("auditor", "Org3MSP", 130)
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: "unknown"})
+	expectError(t, err, "decision must be dismiss, voidBids or voidAuction")
+
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: voidBids, BidIDs: []string{"unknown"}})
+	expectError(t, err, "bid unknown is not a bid of the auction")
+
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: voidBids, BidIDs: []string{bidID1}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Disputed || len(auction.PrivateBids) != 1 || len(auction.RevealedBids) != 0 {
+		t.Fatalf("expected the bid of buyer1 to be voided, got %v %v", auction.PrivateBids, auction.RevealedBids)
+	}
+	if len(auction.History) != 2 || auction.History[1].Action != "resolveDispute" || auction.History[1].Org != "Org3MSP" {
+		t.Fatalf("unexpected history %v", auction.History)
+	}
+
+	ctx = stub.startTransaction("auditor", "Org3MSP", 140)
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: dismissDispute})
+	expectError(t, err, "auction is not disputed")
+
+	// the auction goes on without the voided bid
+	revealTestBid(t, stub, "buyer2", "Org2MSP", bidID2, bidJSON2)
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 150)
+	err = contract.EndAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction = queryTestAuction(t, stub)
+	if auction.Status != "ended" || len(auction.Winners) != 1 || auction.Winners[0].Buyer != "buyer2" || auction.Winners[0].Quantity != 10 {
+		t.Fatalf("expected buyer2 to win every unit, got %s %v", auction.Status, auction.Winners)
+	}
+}
+
+func TestResolveDisputeVoidAuction(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, 10)
+
+	submitTestBid(t, stub, "buyer1", "Org2MSP", 5, 100)
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 70)
+	err := contract.RaiseDispute(ctx, testAuctionID, "wrong item")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx = stub.startTransaction("auditor", "Org3MSP", 80)
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: voidAuction})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Status != "void" || auction.Disputed {
+		t.Fatalf("expected a void auction, got %s %v", auction.Status, auction.Disputed)
+	}
+
+	// a void auction cannot be disputed, closed or ended
+	ctx = stub.startTransaction("seller", "Org1MSP", 90)
+	err = contract.RaiseDispute(ctx, testAuctionID, "another reason")
+	expectError(t, err, "cannot raise a dispute on an ended or void auction")
+
+	err = contract.CloseAuction(ctx, testAuctionID)
+	expectError(t, err, "cannot close auction that is not open")
+
+	err = contract.EndAuction(ctx, testAuctionID)
+	expectError(t, err, "Can only end a closed auction")
+}
+
+func TestResolveDisputeByAuctionAuditor(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+
+	// the seller picks the auditor organization when the auction is created
+	ctx := stub.startTransaction("seller", "Org1MSP", 50)
+	err := contract.CreateAuction(ctx, testAuctionID, "tickets", 10, "Org8MSP", smallestFirstAllocation, endorseAll, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if !auction.Auditor || auction.AuditorOrg != "Org8MSP" {
+		t.Fatalf("expected Org8MSP to be the auditor, got %v %s", auction.Auditor, auction.AuditorOrg)
+	}
+
+	// the auditor can update the auction with any one participant
+	submitTestBid(t, stub, "buyer1", "Org2MSP", 5, 100)
+	checkAuctionPolicy(t, stub, []string{"Org2MSP", "Org8MSP"}, true)
+	checkAuctionPolicy(t, stub, []string{"Org2MSP", "Org3MSP"}, false)
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 60)
+	err = contract.RaiseDispute(ctx, testAuctionID, "wrong item")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the auditor of another auction cannot resolve the dispute
+	ctx = stub.startTransaction("auditor", "Org3MSP", 70)
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: dismissDispute})
+	expectError(t, err, "dispute can only be resolved by the auditor organization")
+
+	ctx = stub.startTransaction("auditor", "Org8MSP", 70)
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: dismissDispute})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRaiseDisputeWithoutAuditor(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 50)
+	err := contract.CreateAuction(ctx, testAuctionID, "tickets", 10, noAuditor, smallestFirstAllocation, endorseAll, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Auditor || auction.AuditorOrg != "" {
+		t.Fatalf("expected an auction without an auditor, got %v %s", auction.Auditor, auction.AuditorOrg)
+	}
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 60)
+	err = contract.RaiseDispute(ctx, testAuctionID, "wrong item")
+	expectError(t, err, "auction has no auditor to resolve a dispute")
+
+	ctx = stub.startTransaction("auditor", "Org3MSP", 70)
+	err = contract.ResolveDispute(ctx, testAuctionID, DisputeDecision{Action: dismissDispute})
+	expectError(t, err, "dispute can only be resolved by the auditor organization")
+}
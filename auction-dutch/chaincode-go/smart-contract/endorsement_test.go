@@ -0,0 +1,166 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
+)
+
+var testOrgs = []string{"Org1MSP", "Org2MSP", "Org4MSP", "Org5MSP", "Org6MSP", "Org7MSP"}
+
+func TestRequiredEndorsements(t *testing.T) {
+	tests := []struct {
+		mode      string
+		threshold int
+		orgCount  int
+		expected  int
+	}{
+		{endorseAll, 0, 6, 6},
+		{"", 0, 6, 6},
+		{endorseMajority, 0, 1, 1},
+		{endorseMajority, 0, 5, 3},
+		{endorseMajority, 0, 6, 4},
+		{endorseNOfM, 3, 6, 3},
+		{endorseNOfM, 3, 2, 2},
+	}
+
+	for _, test := range tests {
+		required := requiredEndorsements(test.mode, test.threshold, test.orgCount)
+		if required != test.expected {
+			t.Errorf("%s of %d organizations with threshold %d: expected %d endorsements, got %d", test.mode, test.orgCount, test.threshold, test.expected, required)
+		}
+	}
+}
+
+func TestCheckEndorsementMode(t *testing.T) {
+	if err := checkEndorsementMode(endorseMajority, 0); err != nil {
+		t.Errorf("expected majority mode to be valid: %v", err)
+	}
+	if err := checkEndorsementMode(endorseNOfM, 3); err != nil {
+		t.Errorf("expected nOfM mode with a threshold to be valid: %v", err)
+	}
+	if err := checkEndorsementMode(endorseNOfM, 0); err == nil {
+		t.Error("expected nOfM mode without a threshold to be rejected")
+	}
+	if err := checkEndorsementMode("any", 0); err == nil {
+		t.Error("expected unknown mode to be rejected")
+	}
+}
+
+func TestAuctionEndorsementPolicyMajority(t *testing.T) {
+	auction := &Auction{Orgs: testOrgs, EndorsementMode: endorseMajority}
+
+	policy, err := auctionEndorsementPolicy(auction)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	checkPolicy(t, policy, []string{"Org1MSP", "Org2MSP", "Org4MSP", "Org5MSP"}, true)
+	checkPolicy(t, policy, []string{"Org1MSP", "Org5MSP", "Org6MSP", "Org7MSP"}, true)
+	checkPolicy(t, policy, []string{"Org1MSP", "Org2MSP", "Org4MSP"}, false)
+	// the seller's organization is always required
+	checkPolicy(t, policy, []string{"Org2MSP", "Org4MSP", "Org5MSP", "Org6MSP", "Org7MSP"}, false)
+	checkPolicy(t, policy, []string{"Org1MSP", "Org2MSP", "Org3MSP", "Org4MSP"}, false)
+}
+
+func TestAuctionEndorsementPolicyNOfM(t *testing.T) {
+	auction := &Auction{Orgs: testOrgs, EndorsementMode: endorseNOfM, EndorsementThreshold: 2}
+
+	policy, err := auctionEndorsementPolicy(auction)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	checkPolicy(t, policy, []string{"Org1MSP", "Org7MSP"}, true)
+	checkPolicy(t, policy, []string{"Org1MSP"}, false)
+	checkPolicy(t, policy, []string{"Org6MSP", "Org7MSP"}, false)
+
+	// a threshold of 1 only requires the seller's organization
+	auction.EndorsementThreshold = 1
+	policy, err = auctionEndorsementPolicy(auction)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+	checkPolicy(t, policy, []string{"Org1MSP"}, true)
+	checkPolicy(t, policy, []string{"Org2MSP", "Org4MSP", "Org5MSP"}, false)
+}
+
+func TestAuctionEndorsementPolicyAll(t *testing.T) {
+	auction := &Auction{Orgs: testOrgs, EndorsementMode: endorseAll}
+
+	policy, err := auctionEndorsementPolicy(auction)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	checkPolicy(t, policy, testOrgs, true)
+	checkPolicy(t, policy, testOrgs[:5], false)
+}
+
+func TestAuctionEndorsementPolicyAuditor(t *testing.T) {
+	auction := &Auction{Orgs: testOrgs, EndorsementMode: endorseMajority, Auditor: true, AuditorOrg: "Org3MSP"}
+
+	policy, err := auctionEndorsementPolicy(auction)
+	if err != nil {
+		t.Fatalf("failed to create policy: %v", err)
+	}
+
+	// the participants can update the auction according to the endorsement mode,
+	// or the auditor can update it with any one participant
+	checkPolicy(t, policy, []string{"Org1MSP", "Org2MSP", "Org6MSP", "Org7MSP"}, true)
+	checkPolicy(t, policy, []string{"Org3MSP", "Org5MSP"}, true)
+	checkPolicy(t, policy, []string{"Org3MSP"}, false)
+	checkPolicy(t, policy, []string{"Org2MSP", "Org4MSP", "Org5MSP", "Org6MSP"}, false)
+}
+
+// checkPolicy checks whether peers of the endorsing organizations satisfy the policy
+func checkPolicy(t *testing.T, policy *common.SignaturePolicyEnvelope, endorsers []string, expected bool) {
+	t.Helper()
+
+	endorsingOrgs := make(map[string]bool)
+	for _, org := range endorsers {
+		endorsingOrgs[org] = true
+	}
+
+	satisfied, err := evaluatePolicy(policy.Rule, policy.Identities, endorsingOrgs)
+	if err != nil {
+		t.Fatalf("failed to evaluate policy: %v", err)
+	}
+	if satisfied != expected {
+		t.Errorf("expected policy satisfied to be %t for endorsers %v, got %t", expected, endorsers, satisfied)
+	}
+}
+
+// evaluatePolicy evaluates a signature policy against the organizations that endorsed
+func evaluatePolicy(rule *common.SignaturePolicy, identities []*msp.MSPPrincipal, endorsingOrgs map[string]bool) (bool, error) {
+
+	switch policy := rule.Type.(type) {
+	case *common.SignaturePolicy_SignedBy:
+		role := &msp.MSPRole{}
+		err := proto.Unmarshal(identities[policy.SignedBy].Principal, role)
+		if err != nil {
+			return false, err
+		}
+		return role.Role == msp.MSPRole_PEER && endorsingOrgs[role.MspIdentifier], nil
+	case *common.SignaturePolicy_NOutOf_:
+		satisfiedRules := int32(0)
+		for _, nestedRule := range policy.NOutOf.Rules {
+			satisfied, err := evaluatePolicy(nestedRule, identities, endorsingOrgs)
+			if err != nil {
+				return false, err
+			}
+			if satisfied {
+				satisfiedRules++
+			}
+		}
+		return satisfiedRules >= policy.NOutOf.N, nil
+	}
+
+	return false, nil
+}
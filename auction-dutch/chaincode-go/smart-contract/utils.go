@@ -6,6 +6,7 @@ package auction
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 
 	"github.com/golang/protobuf/proto"
@@ -62,6 +63,46 @@ func verifyClientOrgMatchesPeerOrg(ctx contractapi.TransactionContextInterface)
 	return nil
 }
 
+// getTxTime returns the transaction timestamp as a Unix time in seconds. The timestamp
+// is set by the client that submits the transaction and is the same on every endorser
+func getTxTime(ctx contractapi.TransactionContextInterface) (int64, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	return txTimestamp.GetSeconds(), nil
+}
+
+// currentClockPrice returns the price of a clock auction at the Unix time now. The price
+// drops by the decrement at the end of every time step, and never goes below the floor price
+func currentClockPrice(auction *Auction, now int64) int {
+
+	if now <= auction.StartTime {
+		return auction.StartPrice
+	}
+
+	steps := (now - auction.StartTime) / auction.StepSeconds
+
+	// compare the number of steps first, so that the price cannot overflow
+	if steps > int64((auction.StartPrice-auction.FloorPrice)/auction.Decrement) {
+		return auction.FloorPrice
+	}
+
+	return auction.StartPrice - int(steps)*auction.Decrement
+}
+
+// clockRemainingQuantity returns the quantity of a clock auction that has not been sold
+func clockRemainingQuantity(auction *Auction) int {
+
+	remainingQuantity := auction.Quantity
+	for _, winner := range auction.Winners {
+		remainingQuantity = remainingQuantity - winner.Quantity
+	}
+
+	return remainingQuantity
+}
+
 func contains(sli []string, str string) bool {
 	for _, a := range sli {
 		if a == str {
@@ -71,8 +112,78 @@ func contains(sli []string, str string) bool {
 	return false
 }
 
-func setAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface, assetId string, mspids []string, auditor bool) error {
+// setAssetStateBasedEndorsement sets the endorsement policy of the auction from its
+// participating organizations, its endorsement mode and its auditor
+func setAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface, assetId string, auction *Auction) error {
+
+	policy, err := auctionEndorsementPolicy(auction)
+	if err != nil {
+		return err
+	}
+
+	spBytes, err := proto.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().SetStateValidationParameter(assetId, spBytes)
+	if err != nil {
+		return fmt.Errorf("failed to set validation parameter on auction: %v", err)
+	}
+
+	return nil
+}
+
+// setClosedAuctionEndorsement stores the participating organizations of a closed auction
+// under a key that every participating organization, or the auditor with any one of
+// them, needs to endorse. EndAuction deletes the key while a bid that was not revealed
+// could still win the auction, so that each organization checks its private data
+// collection. Once every bid is revealed, the key is left as it is and the auction can
+// be ended with the endorsement policy of its endorsement mode
+func setClosedAuctionEndorsement(ctx contractapi.TransactionContextInterface, auctionID string, auction *Auction) error {
+
+	closedAuctionKey, err := ctx.GetStub().CreateCompositeKey(closedAuctionKeyType, []string{auctionID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	orgsJSON, err := json.Marshal(auction.Orgs)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(closedAuctionKey, orgsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put closed auction in public data: %v", err)
+	}
+
+	everyOrg := *auction
+	everyOrg.EndorsementMode = endorseAll
+
+	return setAssetStateBasedEndorsement(ctx, closedAuctionKey, &everyOrg)
+}
+
+// deleteClosedAuctionKey deletes the key stored by setClosedAuctionEndorsement, which
+// requires the endorsement of every participating organization
+func deleteClosedAuctionKey(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	closedAuctionKey, err := ctx.GetStub().CreateCompositeKey(closedAuctionKeyType, []string{auctionID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
 
+	err = ctx.GetStub().DelState(closedAuctionKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete closed auction from public data: %v", err)
+	}
+
+	return nil
+}
+
+// auctionEndorsementPolicy creates the endorsement policy of the auction. The first
+// participating organization is the seller's organization
+func auctionEndorsementPolicy(auction *Auction) (*common.SignaturePolicyEnvelope, error) {
+
+	mspids := auction.Orgs
 	principals := make([]*msp.MSPPrincipal, len(mspids))
 	participantSigsPolicy := make([]*common.SignaturePolicy, len(mspids))
 
@@ -84,122 +195,68 @@ func setAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface,
 			},
 		)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		principals[i] = &msp.MSPPrincipal{
 			PrincipalClassification: msp.MSPPrincipal_ROLE,
 			Principal:               principal,
 		}
-		participantSigsPolicy[i] = &common.SignaturePolicy{
-			Type: &common.SignaturePolicy_SignedBy{
-				SignedBy: int32(i),
-			},
-		}
+		participantSigsPolicy[i] = signedBy(int32(i))
 	}
 
-	if auditor == false {
+	// the participating organizations update the auction according to its endorsement mode
+	participantsPolicy := participantPolicy(len(mspids), auction.EndorsementMode, auction.EndorsementThreshold)
+
+	if auction.Auditor == false {
 		// create the defalt policy for an auction without an auditor
 
 		policy := &common.SignaturePolicyEnvelope{
-			Version: 0,
-			Rule: &common.SignaturePolicy{
-				Type: &common.SignaturePolicy_NOutOf_{
-					NOutOf: &common.SignaturePolicy_NOutOf{
-						N:     int32(len(mspids)),
-						Rules: participantSigsPolicy,
-					},
-				},
-			},
+			Version:    0,
+			Rule:       participantsPolicy,
 			Identities: principals,
 		}
 
-		spBytes, err := proto.Marshal(policy)
-		if err != nil {
-			return err
-		}
-		err = ctx.GetStub().SetStateValidationParameter(assetId, spBytes)
-		if err != nil {
-			return fmt.Errorf("failed to set validation parameter on auction: %v", err)
-		}
-	} else {
+		return policy, nil
+	}
 
-		// create the defalt policy for an auction with an auditor
+	// create the defalt policy for an auction with an auditor
 
-		// create the auditor identity and signature policy
-		auditorMSP, err := proto.Marshal(
-			&msp.MSPRole{
-				Role:          msp.MSPRole_PEER,
-				MspIdentifier: "Org3MSP",
-			},
-		)
-		if err != nil {
-			return err
-		}
-		principals = append(principals, &msp.MSPPrincipal{
-			PrincipalClassification: msp.MSPPrincipal_ROLE,
-			Principal:               auditorMSP,
+	// create the auditor identity and signature policy
+	auditorMSP, err := proto.Marshal(
+		&msp.MSPRole{
+			Role:          msp.MSPRole_PEER,
+			MspIdentifier: auction.AuditorOrg,
 		},
-		)
-		// Create the policies in case the auditor is needed. In this case, an
-		// auditor and 1 participant can update the auction.
-		auditorPolicies := make([]*common.SignaturePolicy, 2)
-		auditorPolicies[0] = &common.SignaturePolicy{
-			Type: &common.SignaturePolicy_SignedBy{
-				SignedBy: int32(len(principals) - 1),
-			},
-		}
-		auditorPolicies[1] = &common.SignaturePolicy{
-			Type: &common.SignaturePolicy_NOutOf_{
-				NOutOf: &common.SignaturePolicy_NOutOf{
-					N:     1,
-					Rules: participantSigsPolicy,
-				},
-			},
-		}
+	)
+	if err != nil {
+		return nil, err
+	}
+	principals = append(principals, &msp.MSPPrincipal{
+		PrincipalClassification: msp.MSPPrincipal_ROLE,
+		Principal:               auditorMSP,
+	},
+	)
+	// Create the policies in case the auditor is needed. In this case, an
+	// auditor and 1 participant can update the auction.
+	auditorPolicies := make([]*common.SignaturePolicy, 2)
+	auditorPolicies[0] = signedBy(int32(len(principals) - 1))
+	auditorPolicies[1] = nOutOf(1, participantSigsPolicy...)
 
-		// For two organizations, the auditor policy below is equivilent to
-		// AND(auditor, OR(Org1, Org2))
-		policies := make([]*common.SignaturePolicy, 2)
-		policies[0] = &common.SignaturePolicy{
-			Type: &common.SignaturePolicy_NOutOf_{
-				NOutOf: &common.SignaturePolicy_NOutOf{
-					N:     2,
-					Rules: auditorPolicies,
-				},
-			},
-		}
-		// Participants can also update the auction without an auditor
-		policies[1] = &common.SignaturePolicy{
-			Type: &common.SignaturePolicy_NOutOf_{
-				NOutOf: &common.SignaturePolicy_NOutOf{
-					N:     int32(len(mspids)),
-					Rules: participantSigsPolicy,
-				},
-			},
-		}
-		// Either the auditor policy or the participant policy can update
-		// the auction. For example, for two organizations, the full policy would be
-		// equivilent to OR(AND(Org1, Org2),AND(auditor, OR(Org1, Org2)))
-		policy := &common.SignaturePolicyEnvelope{
-			Version: 0,
-			Rule: &common.SignaturePolicy{
-				Type: &common.SignaturePolicy_NOutOf_{
-					NOutOf: &common.SignaturePolicy_NOutOf{
-						N:     1,
-						Rules: policies,
-					},
-				},
-			},
-			Identities: principals,
-		}
-		spBytes, err := proto.Marshal(policy)
-		if err != nil {
-			return err
-		}
-		err = ctx.GetStub().SetStateValidationParameter(assetId, spBytes)
-		if err != nil {
-			return fmt.Errorf("failed to set validation parameter on auction: %v", err)
-		}
+	// For two organizations, the auditor policy below is equivilent to
+	// AND(auditor, OR(Org1, Org2))
+	policies := make([]*common.SignaturePolicy, 2)
+	policies[0] = nOutOf(2, auditorPolicies...)
+	// Participants can also update the auction without an auditor
+	policies[1] = participantsPolicy
+
+	// Either the auditor policy or the participant policy can update
+	// the auction. For example, for two organizations, the full policy would be
+	// equivilent to OR(AND(Org1, Org2),AND(auditor, OR(Org1, Org2)))
+	policy := &common.SignaturePolicyEnvelope{
+		Version:    0,
+		Rule:       nOutOf(1, policies...),
+		Identities: principals,
 	}
-	return nil
+
+	return policy, nil
 }
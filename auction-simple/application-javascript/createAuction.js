@@ -8,12 +8,13 @@
 
 const { Gateway, Wallets } = require('fabric-network');
 const path = require('path');
+const crypto = require('crypto');
 const { buildCCPOrg1, buildCCPOrg2, buildWallet, prettyJSONString} = require('../../test-application/javascript/AppUtil.js');
 
 const myChannel = 'mychannel';
 const myChaincodeName = 'auction';
 
-async function createAuction(ccp,wallet,user,auctionID,item) {
+async function createAuction(ccp,wallet,user,orgMSP,auctionID,item,biddingDeadline,revealDeadline,minimumBid,reservePrice,auctionType,tokenChaincode,endorsementMode,endorsementThreshold) {
 	try {
 
 		const gateway = new Gateway();
@@ -27,8 +28,17 @@ async function createAuction(ccp,wallet,user,auctionID,item) {
 
 		let statefulTxn = contract.createTransaction('CreateAuction');
 
+		// the reserve price is kept in the private data collection of the seller's organization
+		if (reservePrice > 0) {
+			let reserveData = { price: reservePrice, salt: crypto.randomBytes(16).toString('hex') };
+			statefulTxn.setEndorsingOrganizations(orgMSP);
+			statefulTxn.setTransient({
+				reserve: Buffer.from(JSON.stringify(reserveData))
+			});
+		}
+
 		console.log('\n--> Submit Transaction: Propose a new auction');
-		await statefulTxn.submit(auctionID,item);
+		await statefulTxn.submit(auctionID,item,biddingDeadline.toString(),revealDeadline.toString(),minimumBid.toString(),auctionType,tokenChaincode,endorsementMode,endorsementThreshold.toString());
 		console.log('*** Result: committed');
 
 		console.log('\n--> Evaluate Transaction: query the auction that was just created');
@@ -46,7 +56,7 @@ async function main() {
 
 		if (process.argv[2] === undefined || process.argv[3] === undefined ||
             process.argv[4] === undefined || process.argv[5] === undefined) {
-			console.log('Usage: node createAuction.js org userID auctionID item');
+			console.log('Usage: node createAuction.js org userID auctionID item [biddingMinutes] [revealMinutes] [minimumBid] [reservePrice] [firstPrice|secondPrice] [tokenChaincode] [all|majority|N]');
 			process.exit(1);
 		}
 
@@ -55,19 +65,43 @@ async function main() {
 		const auctionID = process.argv[4];
 		const item = process.argv[5];
 
+		// the deadlines are Unix times in seconds, by default bidding and revealing are open for an hour each
+		const biddingMinutes = process.argv[6] === undefined ? 60 : parseInt(process.argv[6]);
+		const revealMinutes = process.argv[7] === undefined ? 60 : parseInt(process.argv[7]);
+		const biddingDeadline = Math.floor(Date.now() / 1000) + biddingMinutes * 60;
+		const revealDeadline = biddingDeadline + revealMinutes * 60;
+
+		// by default there is no minimum bid and no reserve price
+		const minimumBid = process.argv[8] === undefined ? 0 : parseInt(process.argv[8]);
+		const reservePrice = process.argv[9] === undefined ? 0 : parseInt(process.argv[9]);
+
+		// by default the winner pays their own bid
+		const auctionType = process.argv[10] === undefined ? 'firstPrice' : process.argv[10];
+
+		// by default the auction is not settled with a token chaincode
+		const tokenChaincode = process.argv[11] === undefined ? '' : process.argv[11];
+
+		// by default every participating organization endorses updates to the auction,
+		// a number N requires N organizations including the seller's organization
+		const endorsement = process.argv[12] === undefined ? 'all' : process.argv[12];
+		const endorsementMode = isNaN(parseInt(endorsement)) ? endorsement : 'nOfM';
+		const endorsementThreshold = isNaN(parseInt(endorsement)) ? 0 : parseInt(endorsement);
+
 		if (org === 'Org1' || org === 'org1') {
+			const orgMSP = 'Org1MSP';
 			const ccp = buildCCPOrg1();
 			const walletPath = path.join(__dirname, 'wallet/org1');
 			const wallet = await buildWallet(Wallets, walletPath);
-			await createAuction(ccp,wallet,user,auctionID,item);
+			await createAuction(ccp,wallet,user,orgMSP,auctionID,item,biddingDeadline,revealDeadline,minimumBid,reservePrice,auctionType,tokenChaincode,endorsementMode,endorsementThreshold);
 		}
 		else if (org === 'Org2' || org === 'org2') {
+			const orgMSP = 'Org2MSP';
 			const ccp = buildCCPOrg2();
 			const walletPath = path.join(__dirname, 'wallet/org2');
 			const wallet = await buildWallet(Wallets, walletPath);
-			await createAuction(ccp,wallet,user,auctionID,item);
+			await createAuction(ccp,wallet,user,orgMSP,auctionID,item,biddingDeadline,revealDeadline,minimumBid,reservePrice,auctionType,tokenChaincode,endorsementMode,endorsementThreshold);
 		}  else {
-			console.log('Usage: node createAuction.js org userID auctionID item');
+			console.log('Usage: node createAuction.js org userID auctionID item [biddingMinutes] [revealMinutes] [minimumBid] [reservePrice] [firstPrice|secondPrice] [tokenChaincode] [all|majority|N]');
 			console.log('Org must be Org1 or Org2');
 		}
 	} catch (error) {
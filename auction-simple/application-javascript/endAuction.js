@@ -31,6 +31,17 @@ async function endAuction(ccp,wallet,user,auctionID) {
 
 		let statefulTxn = contract.createTransaction('EndAuction');
 
+		// the seller reveals the reserve price of the auction, if it has one
+		if (auctionJSON.reserveHash !== '') {
+			console.log('\n--> Evaluate Transaction: read the reserve price');
+			let reserveString = await contract.evaluateTransaction('QueryReserve',auctionID);
+			let reserveJSON = JSON.parse(reserveString);
+			let reserveData = { price: parseInt(reserveJSON.price), salt: reserveJSON.salt };
+			statefulTxn.setTransient({
+				reserve: Buffer.from(JSON.stringify(reserveData))
+			});
+		}
+
 		if (auctionJSON.organizations.length === 2) {
 			statefulTxn.setEndorsingOrganizations(auctionJSON.organizations[0],auctionJSON.organizations[1]);
 		} else {
@@ -0,0 +1,86 @@
+/*
+ * Copyright IBM Corp. All Rights Reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+'use strict';
+
+const { Gateway, Wallets } = require('fabric-network');
+const path = require('path');
+const { buildCCPOrg1, buildCCPOrg2, buildWallet, prettyJSONString} = require('../../test-application/javascript/AppUtil.js');
+
+const myChannel = 'mychannel';
+const myChaincodeName = 'auction';
+
+async function queryAuctions(ccp,wallet,user,status,sellerOrg,item) {
+	try {
+
+		const gateway = new Gateway();
+
+		//connect using Discovery enabled
+		await gateway.connect(ccp,
+			{ wallet: wallet, identity: user, discovery: { enabled: true, asLocalhost: true } });
+
+		const network = await gateway.getNetwork(myChannel);
+		const contract = network.getContract(myChaincodeName);
+
+		// read the auctions one page at a time, until the last page returns fewer auctions than the page size
+		const pageSize = 10;
+		let bookmark = '';
+		for (;;) {
+			console.log('\n--> Evaluate Transaction: query a page of auctions');
+			let result = await contract.evaluateTransaction('QueryAuctions',status,sellerOrg,item,pageSize.toString(),bookmark);
+			console.log('*** Result: Auctions: ' + prettyJSONString(result.toString()));
+
+			let page = JSON.parse(result.toString());
+			if (page.fetchedRecordsCount < pageSize) {
+				break;
+			}
+			bookmark = page.bookmark;
+		}
+
+		gateway.disconnect();
+	} catch (error) {
+		console.error(`******** FAILED to query auctions: ${error}`);
+	}
+}
+
+async function main() {
+	try {
+
+		if (process.argv[2] === undefined || process.argv[3] === undefined) {
+			console.log('Usage: node queryAuctions.js org userID [status] [sellerOrg] [item]');
+			process.exit(1);
+		}
+
+		const org = process.argv[2];
+		const user = process.argv[3];
+
+		// filters that are not passed match every auction
+		const status = process.argv[4] === undefined ? '' : process.argv[4];
+		const sellerOrg = process.argv[5] === undefined ? '' : process.argv[5];
+		const item = process.argv[6] === undefined ? '' : process.argv[6];
+
+		if (org === 'Org1' || org === 'org1') {
+			const ccp = buildCCPOrg1();
+			const walletPath = path.join(__dirname, 'wallet/org1');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await queryAuctions(ccp,wallet,user,status,sellerOrg,item);
+		}
+		else if (org === 'Org2' || org === 'org2') {
+			const ccp = buildCCPOrg2();
+			const walletPath = path.join(__dirname, 'wallet/org2');
+			const wallet = await buildWallet(Wallets, walletPath);
+			await queryAuctions(ccp,wallet,user,status,sellerOrg,item);
+		} else {
+			console.log('Usage: node queryAuctions.js org userID [status] [sellerOrg] [item]');
+			console.log('Org must be Org1 or Org2');
+		}
+	} catch (error) {
+		console.error(`******** FAILED to run the application: ${error}`);
+	}
+}
+
+
+main();
@@ -18,16 +18,33 @@ type SmartContract struct {
 }
 
 // Auction data
+// BiddingDeadline and RevealDeadline are Unix times in seconds. ReserveHash is the hash
+// of the reserve price in the seller's private data collection, and ReservePrice is
+// only set once the seller reveals it at the end of the auction. AuctionType decides
+// the price paid by the winner, either their own bid or the second highest revealed bid.
+// TokenChaincode is the name of the token chaincode used to pay for the item.
+// EndorsementMode and EndorsementThreshold decide how many participating organizations
+// need to endorse an update to the auction
 type Auction struct {
-	Type         string             `json:"objectType"`
-	ItemSold     string             `json:"item"`
-	Seller       string             `json:"seller"`
-	Orgs         []string           `json:"organizations"`
-	PrivateBids  map[string]BidHash `json:"privateBids"`
-	RevealedBids map[string]FullBid `json:"revealedBids"`
-	Winner       string             `json:"winner"`
-	Price        int                `json:"price"`
-	Status       string             `json:"status"`
+	Type                 string             `json:"objectType"`
+	ItemSold             string             `json:"item"`
+	Seller               string             `json:"seller"`
+	SellerOrg            string             `json:"sellerOrg"`
+	Orgs                 []string           `json:"organizations"`
+	PrivateBids          map[string]BidHash `json:"privateBids"`
+	RevealedBids         map[string]FullBid `json:"revealedBids"`
+	Winner               string             `json:"winner"`
+	Price                int                `json:"price"`
+	Status               string             `json:"status"`
+	BiddingDeadline      int64              `json:"biddingDeadline"`
+	RevealDeadline       int64              `json:"revealDeadline"`
+	MinimumBid           int                `json:"minimumBid"`
+	ReserveHash          string             `json:"reserveHash"`
+	ReservePrice         int                `json:"reservePrice"`
+	AuctionType          string             `json:"auctionType"`
+	TokenChaincode       string             `json:"tokenChaincode"`
+	EndorsementMode      string             `json:"endorsementMode"`
+	EndorsementThreshold int                `json:"endorsementThreshold"`
 }
 
 // FullBid is the structure of a revealed bid
@@ -38,17 +55,62 @@ type FullBid struct {
 	Bidder string `json:"bidder"`
 }
 
+// AuctionQueryResult is an auction returned by QueryAuctions together with its ID
+type AuctionQueryResult struct {
+	AuctionID string   `json:"auctionID"`
+	Auction   *Auction `json:"auction"`
+}
+
+// PaginatedAuctionQueryResult is a page of auctions returned by QueryAuctions
+type PaginatedAuctionQueryResult struct {
+	Records             []*AuctionQueryResult `json:"records"`
+	FetchedRecordsCount int32                 `json:"fetchedRecordsCount"`
+	Bookmark            string                `json:"bookmark"`
+}
+
+// BidQueryResult is a bid returned by QueryMyBids together with the auction it was made
+// for. BidID is the transaction ID that created the bid
+type BidQueryResult struct {
+	AuctionID string   `json:"auctionID"`
+	BidID     string   `json:"bidID"`
+	Bid       *FullBid `json:"bid"`
+}
+
 // BidHash is the structure of a private bid
 type BidHash struct {
 	Org  string `json:"org"`
 	Hash string `json:"hash"`
 }
 
+// ReservePrice is the lowest price the seller accepts. The salt prevents other
+// participants from guessing the price from its hash on the public ledger
+type ReservePrice struct {
+	Price int    `json:"price"`
+	Salt  string `json:"salt"`
+}
+
 const bidKeyType = "bid"
+const reserveKeyType = "reserve"
+const closedAuctionKeyType = "closedAuction"
+
+// Auction types. The highest bidder wins both types of auction, but pays their own
+// bid in a first price auction and the second highest price in a second price auction
+const firstPriceAuction = "firstPrice"
+const secondPriceAuction = "secondPrice"
 
 // CreateAuction creates on auction on the public channel. The identity that
-// submits the transacion becomes the seller of the auction
-func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterface, auctionID string, itemsold string) error {
+// submits the transacion becomes the seller of the auction. Bids can be submitted
+// until the bidding deadline and revealed until the reveal deadline, both given as
+// Unix times in seconds and checked against the transaction timestamp. Revealed bids
+// below the minimum bid are rejected, pass 0 for no minimum bid. The seller can set a
+// reserve price by passing it in the transient map, it is then stored in the private
+// data collection of the seller's organization and only its hash is added to the auction.
+// The auction type is either "firstPrice" or "secondPrice". The winner pays the seller
+// with the ERC-20 token chaincode deployed as tokenChaincode on the same channel, pass an
+// empty name if the auction is not settled on the ledger. The endorsement mode is "all",
+// "majority" or "nOfM", the endorsement threshold is the number of organizations of the
+// nOfM mode
+func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterface, auctionID string, itemsold string, biddingDeadline int64, revealDeadline int64, minimumBid int, auctionType string, tokenChaincode string, endorsementMode string, endorsementThreshold int) error {
 
 	// get ID of submitting client
 	clientID, err := s.GetSubmittingClientIdentity(ctx)
@@ -62,20 +124,68 @@ func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
+	// the deadlines need to leave time to bid and then to reveal bids
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if biddingDeadline <= now {
+		return fmt.Errorf("bidding deadline must be in the future")
+	}
+	if revealDeadline <= biddingDeadline {
+		return fmt.Errorf("reveal deadline must be after the bidding deadline")
+	}
+
+	if minimumBid < 0 {
+		return fmt.Errorf("minimum bid cannot be negative")
+	}
+
+	if auctionType != firstPriceAuction && auctionType != secondPriceAuction {
+		return fmt.Errorf("auction type must be %s or %s", firstPriceAuction, secondPriceAuction)
+	}
+
+	err = checkEndorsementMode(endorsementMode, endorsementThreshold)
+	if err != nil {
+		return err
+	}
+
+	// get the optional reserve price from transient map
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+
+	reserveHash := ""
+	if reserveJSON, ok := transientMap["reserve"]; ok {
+		reserveHash, err = putReservePrice(ctx, auctionID, reserveJSON)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Create auction
 	bidders := make(map[string]BidHash)
 	revealedBids := make(map[string]FullBid)
 
 	auction := Auction{
-		Type:         "auction",
-		ItemSold:     itemsold,
-		Price:        0,
-		Seller:       clientID,
-		Orgs:         []string{clientOrgID},
-		PrivateBids:  bidders,
-		RevealedBids: revealedBids,
-		Winner:       "",
-		Status:       "open",
+		Type:                 "auction",
+		ItemSold:             itemsold,
+		Price:                0,
+		Seller:               clientID,
+		SellerOrg:            clientOrgID,
+		Orgs:                 []string{clientOrgID},
+		PrivateBids:          bidders,
+		RevealedBids:         revealedBids,
+		Winner:               "",
+		Status:               "open",
+		BiddingDeadline:      biddingDeadline,
+		RevealDeadline:       revealDeadline,
+		MinimumBid:           minimumBid,
+		ReserveHash:          reserveHash,
+		AuctionType:          auctionType,
+		TokenChaincode:       tokenChaincode,
+		EndorsementMode:      endorsementMode,
+		EndorsementThreshold: endorsementThreshold,
 	}
 
 	auctionJSON, err := json.Marshal(auction)
@@ -90,7 +200,7 @@ func (s *SmartContract) CreateAuction(ctx contractapi.TransactionContextInterfac
 	}
 
 	// set the seller of the auction as an endorser
-	err = setAssetStateBasedEndorsement(ctx, auctionID, clientOrgID)
+	err = setAssetStateBasedEndorsement(ctx, auctionID, &auction)
 	if err != nil {
 		return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
 	}
@@ -168,6 +278,15 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("cannot join closed or ended auction")
 	}
 
+	// bids can only be added until the bidding deadline, even if nobody closed the auction yet
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now > auction.BiddingDeadline {
+		return fmt.Errorf("cannot join auction after the bidding deadline")
+	}
+
 	// get the inplicit collection name of bidder's org
 	collection, err := getCollectionName(ctx)
 	if err != nil {
@@ -206,7 +325,7 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, a
 		newOrgs := append(Orgs, clientOrgID)
 		auction.Orgs = newOrgs
 
-		err = addAssetStateBasedEndorsement(ctx, auctionID, clientOrgID)
+		err = setAssetStateBasedEndorsement(ctx, auctionID, auction)
 		if err != nil {
 			return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
 		}
@@ -222,6 +341,111 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, a
 	return nil
 }
 
+// WithdrawBid is used by a bidder to remove their bid from an open auction before the
+// bidding deadline. The bidder passes the bid in the transient map to prove that they
+// submitted it. The hash of the bid is removed from the auction and the bid is deleted
+// from the private data collection of the bidder's organization
+func (s *SmartContract) WithdrawBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string) error {
+
+	// get ID of submitting client
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get the auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	err = removePrivateBid(ctx, auction, auctionID, txID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to withdraw bid: %v", err)
+	}
+
+	newAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	return nil
+}
+
+// ReplaceBid is used by a bidder to replace their bid in an open auction before the
+// bidding deadline. The old bid is withdrawn as with WithdrawBid, and the hash of the
+// new bid, created with the Bid function, is added to the auction in its place
+func (s *SmartContract) ReplaceBid(ctx contractapi.TransactionContextInterface, auctionID string, oldTxID string, newTxID string) error {
+
+	if oldTxID == newTxID {
+		return fmt.Errorf("cannot replace a bid with itself")
+	}
+
+	// get ID of submitting client
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get the MSP ID of the bidder's org
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+
+	// get the auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	err = removePrivateBid(ctx, auction, auctionID, oldTxID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to replace bid: %v", err)
+	}
+
+	// get the inplicit collection name of bidder's org
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	newBidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, newTxID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	if _, bidInAuction := auction.PrivateBids[newBidKey]; bidInAuction {
+		return fmt.Errorf("bid %s has already been submitted to the auction", newBidKey)
+	}
+
+	// get the hash of the new bid stored in private data collection
+	bidHash, err := ctx.GetStub().GetPrivateDataHash(collection, newBidKey)
+	if err != nil {
+		return fmt.Errorf("failed to read bid bash from collection: %v", err)
+	}
+	if bidHash == nil {
+		return fmt.Errorf("bid hash does not exist: %s", newBidKey)
+	}
+
+	// the organization of the bidder already endorses the auction, since it submitted the old bid
+	auction.PrivateBids[newBidKey] = BidHash{
+		Org:  clientOrgID,
+		Hash: fmt.Sprintf("%x", bidHash),
+	}
+
+	newAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, newAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update auction: %v", err)
+	}
+
+	return nil
+}
+
 // RevealBid is used by a bidder to reveal their bid after the auction is closed
 func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string) error {
 
@@ -263,15 +487,24 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("failed to get auction from public state %v", err)
 	}
 
-	// Complete a series of three checks before we add the bid to the auction
+	// Complete a series of checks before we add the bid to the auction
 
-	// check 1: check that the auction is closed. We cannot reveal a
-	// bid to an open auction
+	// check 1: check that the auction is closed and the reveal deadline has not passed.
+	// We cannot reveal a bid to an open auction
 	Status := auction.Status
 	if Status != "closed" {
 		return fmt.Errorf("cannot reveal bid for open or ended auction")
 	}
 
+	// bids that are not revealed by the reveal deadline are forfeited
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now > auction.RevealDeadline {
+		return fmt.Errorf("cannot reveal bid after the reveal deadline")
+	}
+
 	// check 2: check that hash of revealed bid matches hash of private bid
 	// on the public ledger. This checks that the bidder is telling the truth
 	// about the value of their bid
@@ -338,6 +571,11 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 		return fmt.Errorf("Permission denied, client id %v is not the owner of the bid", clientID)
 	}
 
+	// check 5: make sure that the bid meets the minimum bid of the auction
+	if bidInput.Price < auction.MinimumBid {
+		return fmt.Errorf("bid price %d is below the minimum bid %d", bidInput.Price, auction.MinimumBid)
+	}
+
 	revealedBids := make(map[string]FullBid)
 	revealedBids = auction.RevealedBids
 	revealedBids[bidKey] = NewBid
@@ -355,7 +593,8 @@ func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface, a
 }
 
 // CloseAuction can be used by the seller to close the auction. This prevents
-// bids from being added to the auction, and allows users to reveal their bid
+// bids from being added to the auction, and allows users to reveal their bid.
+// Once the bidding deadline has passed, anyone can close the auction
 func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
 
 	// get auction from public state
@@ -364,7 +603,7 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to get auction from public state %v", err)
 	}
 
-	// the auction can only be closed by the seller
+	// the auction can only be closed by the seller until the bidding deadline
 
 	// get ID of submitting client
 	clientID, err := s.GetSubmittingClientIdentity(ctx)
@@ -372,9 +611,14 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
 	Seller := auction.Seller
-	if Seller != clientID {
-		return fmt.Errorf("auction can only be closed by seller: %v", err)
+	if Seller != clientID && now <= auction.BiddingDeadline {
+		return fmt.Errorf("auction can only be closed by seller before the bidding deadline")
 	}
 
 	Status := auction.Status
@@ -384,6 +628,13 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 
 	auction.Status = string("closed")
 
+	// every participating organization needs to endorse the check for bids that were
+	// not revealed when the auction is ended
+	err = setClosedAuctionEndorsement(ctx, auctionID, auction)
+	if err != nil {
+		return fmt.Errorf("failed setting state based endorsement for closed auction: %v", err)
+	}
+
 	closedAuctionJSON, _ := json.Marshal(auction)
 
 	err = ctx.GetStub().PutState(auctionID, closedAuctionJSON)
@@ -395,7 +646,10 @@ func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface
 }
 
 // EndAuction both changes the auction status to closed and calculates the winners
-// of the auction
+// of the auction. Once the reveal deadline has passed, anyone can end the auction,
+// and bids that were not revealed are forfeited. If the auction has a reserve price,
+// the seller reveals it by passing it in the transient map. The auction fails without
+// a winner if the highest bid is below the reserve price
 func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
 
 	// get auction from public state
@@ -404,7 +658,7 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("failed to get auction from public state %v", err)
 	}
 
-	// Check that the auction is being ended by the seller
+	// Check that the auction is being ended by the seller until the reveal deadline
 
 	// get ID of submitting client
 	clientID, err := s.GetSubmittingClientIdentity(ctx)
@@ -412,9 +666,15 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	revealWindowEnded := now > auction.RevealDeadline
+
 	Seller := auction.Seller
-	if Seller != clientID {
-		return fmt.Errorf("auction can only be ended by seller: %v", err)
+	if Seller != clientID && !revealWindowEnded {
+		return fmt.Errorf("auction can only be ended by seller before the reveal deadline")
 	}
 
 	Status := auction.Status
@@ -422,27 +682,67 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("Can only end a closed auction")
 	}
 
-	// get the list of revealed bids
+	// get the list of revealed bids. If none were revealed by the reveal deadline,
+	// the auction ends without a winner
 	revealedBidMap := auction.RevealedBids
-	if len(auction.RevealedBids) == 0 {
+	if len(auction.RevealedBids) == 0 && !revealWindowEnded {
 		return fmt.Errorf("No bids have been revealed, cannot end auction: %v", err)
 	}
 
-	// determine the highest bid
-	for _, bid := range revealedBidMap {
-		if bid.Price > auction.Price {
-			auction.Winner = bid.Bidder
-			auction.Price = bid.Price
+	// determine the highest bid and the price paid by the winner
+	rankedBids := rankBids(revealedBidMap)
+	if len(rankedBids) > 0 {
+		auction.Winner = rankedBids[0].Bid.Bidder
+		auction.Price = winningPrice(auction, rankedBids)
+	}
+
+	// check if there is a winning bid that has yet to be revealed. After the reveal
+	// deadline, unrevealed bids are forfeited and can no longer win the auction. Every
+	// participating organization needs to endorse the check
+	if !revealWindowEnded && len(auction.RevealedBids) < len(auction.PrivateBids) {
+		err = checkForHigherBid(ctx, auction, rankedBids)
+		if err != nil {
+			return fmt.Errorf("Cannot end auction: %v", err)
+		}
+
+		err = deleteClosedAuctionKey(ctx, auctionID)
+		if err != nil {
+			return err
 		}
 	}
 
-	// check if there is a winning bid that has yet to be revealed
-	err = checkForHigherBid(ctx, auction.Price, auction.RevealedBids, auction.PrivateBids)
-	if err != nil {
-		return fmt.Errorf("Cannot end auction: %v", err)
+	// check the winning bid against the reserve price of the seller
+	if auction.ReserveHash != "" {
+		reserve, err := readRevealedReservePrice(ctx, auctionID, auction)
+		if err != nil {
+			return fmt.Errorf("Cannot end auction: %v", err)
+		}
+
+		if reserve == nil {
+			// once the reveal deadline has passed anyone can end the auction, but only the
+			// seller can reveal the reserve price. It cannot be shown to be met without it
+			if Seller == clientID {
+				return fmt.Errorf("reserve key not found in the transient map")
+			}
+			auction.Winner = ""
+			auction.Price = 0
+		} else {
+			auction.ReservePrice = reserve.Price
+			if len(rankedBids) == 0 || rankedBids[0].Bid.Price < reserve.Price {
+				auction.Winner = ""
+				auction.Price = 0
+			} else if auction.Price < reserve.Price {
+				// the winner of a second price auction pays at least the reserve price
+				auction.Price = reserve.Price
+			}
+		}
 	}
 
-	auction.Status = string("ended")
+	if auction.Winner == "" {
+		auction.Status = string("failed")
+	} else {
+		auction.Status = string("ended")
+	}
 
 	endedAuctionJSON, _ := json.Marshal(auction)
 
@@ -452,3 +752,86 @@ func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface,
 	}
 	return nil
 }
+
+// SettleAuction pays the seller of an ended auction with the token chaincode of the
+// auction. The price is transferred from the winner to the seller using the allowance
+// that the winner approved for the seller in the token chaincode. If the winner cannot
+// pay, the next highest bidder wins the auction instead. The auction is settled once a
+// bidder has paid, and fails if none of the bidders can pay
+func (s *SmartContract) SettleAuction(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	// get auction from public state
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	// the token chaincode checks the allowance of the client that submits the
+	// transaction, so only the seller can settle the auction
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	Seller := auction.Seller
+	if Seller != clientID {
+		return fmt.Errorf("auction can only be settled by seller")
+	}
+
+	Status := auction.Status
+	if Status != "ended" {
+		return fmt.Errorf("Can only settle an ended auction")
+	}
+
+	if auction.TokenChaincode == "" {
+		return fmt.Errorf("auction %v has no token chaincode to settle with", auctionID)
+	}
+
+	// try the bids from the highest to the lowest. A bidder that cannot pay is
+	// skipped together with their other bids
+	rankedBids := rankBids(auction.RevealedBids)
+	defaulted := make(map[string]bool)
+
+	auction.Winner = ""
+	auction.Price = 0
+	auction.Status = string("failed")
+
+	for i, candidate := range rankedBids {
+		bidder := candidate.Bid.Bidder
+		if defaulted[bidder] {
+			continue
+		}
+
+		// bids are ranked by price, so none of the remaining bids meets the reserve price
+		if candidate.Bid.Price < auction.ReservePrice {
+			break
+		}
+
+		price := winningPrice(auction, rankedBids[i:])
+		if price < auction.ReservePrice {
+			price = auction.ReservePrice
+		}
+
+		paid, err := payWithToken(ctx, auction.TokenChaincode, bidder, Seller, price)
+		if err != nil {
+			return fmt.Errorf("failed to settle auction: %v", err)
+		}
+		if !paid {
+			defaulted[bidder] = true
+			continue
+		}
+
+		auction.Winner = bidder
+		auction.Price = price
+		auction.Status = string("settled")
+		break
+	}
+
+	settledAuctionJSON, _ := json.Marshal(auction)
+
+	err = ctx.GetStub().PutState(auctionID, settledAuctionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to settle auction: %v", err)
+	}
+	return nil
+}
@@ -32,6 +32,61 @@ func (s *SmartContract) QueryAuction(ctx contractapi.TransactionContextInterface
 	return auction, nil
 }
 
+// QueryAuctions returns a page of the auctions on the public ledger, filtered by status,
+// the organization of the seller and the item sold. Pass an empty string to skip a filter.
+// The number of auctions returned is equal to or lesser than the page size, and the
+// bookmark returned with the page is used to query the next page.
+// Only available on state databases that support rich query (e.g. CouchDB)
+func (s *SmartContract) QueryAuctions(ctx contractapi.TransactionContextInterface, status string, sellerOrg string, item string, pageSize int, bookmark string) (*PaginatedAuctionQueryResult, error) {
+
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be a positive integer")
+	}
+
+	selector := map[string]string{"objectType": "auction"}
+	if status != "" {
+		selector["status"] = status
+	}
+	if sellerOrg != "" {
+		selector["sellerOrg"] = sellerOrg
+	}
+	if item != "" {
+		selector["item"] = item
+	}
+
+	queryString, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create query: %v", err)
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetQueryResultWithPagination(string(queryString), int32(pageSize), bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query auctions: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	auctions := []*AuctionQueryResult{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var auction *Auction
+		err = json.Unmarshal(queryResponse.Value, &auction)
+		if err != nil {
+			return nil, err
+		}
+		auctions = append(auctions, &AuctionQueryResult{AuctionID: queryResponse.Key, Auction: auction})
+	}
+
+	return &PaginatedAuctionQueryResult{
+		Records:             auctions,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
 // QueryBid allows the submitter of the bid to read their bid from public state
 func (s *SmartContract) QueryBid(ctx contractapi.TransactionContextInterface, auctionID string, txID string) (*FullBid, error) {
 
@@ -77,8 +132,121 @@ func (s *SmartContract) QueryBid(ctx contractapi.TransactionContextInterface, au
 	return bid, nil
 }
 
-// checkForHigherBid is an internal function that is used to determine if a winning bid has yet to be revealed
-func checkForHigherBid(ctx contractapi.TransactionContextInterface, auctionPrice int, revealedBidders map[string]FullBid, bidders map[string]BidHash) error {
+// QueryMyBids allows a bidder to list their bids in all auctions. The bids are read
+// from the private data collection of the bidder's organization, so the query needs to
+// be sent to a peer of that organization
+func (s *SmartContract) QueryMyBids(ctx contractapi.TransactionContextInterface) ([]*BidQueryResult, error) {
+
+	err := verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	// the collection holds the bids of every member of the organization
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(collection, bidKeyType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bids from collection: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	bids := []*BidQueryResult{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var bid *FullBid
+		err = json.Unmarshal(queryResponse.Value, &bid)
+		if err != nil {
+			return nil, err
+		}
+		if bid.Bidder != clientID {
+			continue
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key: %v", err)
+		}
+		if len(keyParts) != 2 {
+			return nil, fmt.Errorf("bid key %v is not a bid of an auction", queryResponse.Key)
+		}
+
+		bids = append(bids, &BidQueryResult{AuctionID: keyParts[0], BidID: keyParts[1], Bid: bid})
+	}
+
+	return bids, nil
+}
+
+// QueryReserve allows the seller to read the reserve price of their auction from the
+// private data collection of their organization, to reveal it when ending the auction
+func (s *SmartContract) QueryReserve(ctx contractapi.TransactionContextInterface, auctionID string) (*ReservePrice, error) {
+
+	err := verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	auction, err := s.QueryAuction(ctx, auctionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auction from public state %v", err)
+	}
+
+	// check that the client querying the reserve price is the seller
+	if auction.Seller != clientID {
+		return nil, fmt.Errorf("Permission denied, client id %v is not the seller of the auction", clientID)
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	reserveKey, err := ctx.GetStub().CreateCompositeKey(reserveKeyType, []string{auctionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	reserveJSON, err := ctx.GetStub().GetPrivateData(collection, reserveKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reserve price %v: %v", reserveKey, err)
+	}
+	if reserveJSON == nil {
+		return nil, fmt.Errorf("auction %v has no reserve price", auctionID)
+	}
+
+	var reserve *ReservePrice
+	err = json.Unmarshal(reserveJSON, &reserve)
+	if err != nil {
+		return nil, err
+	}
+
+	return reserve, nil
+}
+
+// checkForHigherBid is an internal function that is used to determine if a winning bid has yet to be revealed.
+// In a second price auction, a bid that has yet to be revealed can also raise the price paid by the winner
+func checkForHigherBid(ctx contractapi.TransactionContextInterface, auction *Auction, rankedBids []rankedBid) error {
+
+	revealedBidders := auction.RevealedBids
+	bidders := auction.PrivateBids
+	winner := rankedBids[0]
 
 	// Get MSP ID of peer org
 	peerMSPID, err := shim.GetMSPID()
@@ -115,8 +283,10 @@ func checkForHigherBid(ctx contractapi.TransactionContextInterface, auctionPrice
 					return err
 				}
 
-				if bid.Price > auctionPrice {
+				if bidOutranks(bid.Price, bidKey, winner.Bid.Price, winner.Key) {
 					error = fmt.Errorf("Cannot close auction, bidder has a higher price: %v", err)
+				} else if auction.AuctionType == secondPriceAuction && bid.Price > auction.Price {
+					error = fmt.Errorf("Cannot close auction, bidder has a higher second price")
 				}
 
 			} else {
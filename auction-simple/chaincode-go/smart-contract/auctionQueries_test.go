@@ -0,0 +1,165 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"os"
+	"testing"
+)
+
+func TestQueryAuctions(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, firstPriceAuction, "", "")
+
+	ctx := stub.startTransaction("seller2", "Org2MSP", 50)
+	err := contract.CreateAuction(ctx, "auction2", "vase", testBiddingDeadline, testRevealDeadline, 0, firstPriceAuction, "", endorseAll, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+	ctx = stub.startTransaction("seller", "Org1MSP", 50)
+	err = contract.CreateAuction(ctx, "auction3", "vase", testBiddingDeadline, testRevealDeadline, 0, firstPriceAuction, "", endorseAll, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+	closeTestAuction(t, stub)
+
+	queryAuctionIDs := func(status string, sellerOrg string, item string, pageSize int, bookmark string) ([]string, string) {
+		t.Helper()
+		ctx := stub.startTransaction("bidder1", "Org2MSP", 110)
+		result, err := contract.QueryAuctions(ctx, status, sellerOrg, item, pageSize, bookmark)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if int(result.FetchedRecordsCount) != len(result.Records) {
+			t.Fatalf("fetched %d records but returned %d", result.FetchedRecordsCount, len(result.Records))
+		}
+		var auctionIDs []string
+		for _, record := range result.Records {
+			auctionIDs = append(auctionIDs, record.AuctionID)
+		}
+		return auctionIDs, result.Bookmark
+	}
+
+	// without filters every auction is returned, one page at a time
+	auctionIDs, bookmark := queryAuctionIDs("", "", "", 2, "")
+	if len(auctionIDs) != 2 || auctionIDs[0] != "auction1" || auctionIDs[1] != "auction2" || bookmark == "" {
+		t.Fatalf("unexpected first page %v with bookmark %q", auctionIDs, bookmark)
+	}
+	auctionIDs, bookmark = queryAuctionIDs("", "", "", 2, bookmark)
+	if len(auctionIDs) != 1 || auctionIDs[0] != "auction3" || bookmark != "" {
+		t.Fatalf("unexpected last page %v with bookmark %q", auctionIDs, bookmark)
+	}
+
+	tests := []struct {
+		name      string
+		status    string
+		sellerOrg string
+		item      string
+		expected  []string
+	}{
+		{"by status", "closed", "", "", []string{"auction1"}},
+		{"by seller org", "", "Org2MSP", "", []string{"auction2"}},
+		{"by seller org and item", "open", "Org1MSP", "vase", []string{"auction3"}},
+		{"no match", "ended", "", "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			auctionIDs, _ := queryAuctionIDs(test.status, test.sellerOrg, test.item, 10, "")
+			if len(auctionIDs) != len(test.expected) {
+				t.Fatalf("expected auctions %v, got %v", test.expected, auctionIDs)
+			}
+			for i := range auctionIDs {
+				if auctionIDs[i] != test.expected[i] {
+					t.Fatalf("expected auctions %v, got %v", test.expected, auctionIDs)
+				}
+			}
+		})
+	}
+
+	_, err = contract.QueryAuctions(stub.startTransaction("bidder1", "Org2MSP", 110), "", "", "", 0, "")
+	expectError(t, err, "page size must be a positive integer")
+}
+
+func TestQueryMyBids(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, firstPriceAuction, "", "")
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 50)
+	err := contract.CreateAuction(ctx, "auction2", "vase", testBiddingDeadline, testRevealDeadline, 0, firstPriceAuction, "", endorseAll, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+
+	bidID1, _ := submitTestBid(t, stub, "bidder1", "Org2MSP", 800, 60)
+	submitTestBid(t, stub, "bidder2", "Org2MSP", 700, 60)
+
+	// a bid that is created but not submitted yet is listed as well
+	ctx = stub.startTransaction("bidder1", "Org2MSP", 70)
+	stub.transient["bid"] = []byte(`{"objectType":"bid","price":300,"org":"Org2MSP","bidder":"bidder1"}`)
+	bidID2, err := contract.Bid(ctx, "auction2")
+	if err != nil {
+		t.Fatalf("failed to create bid: %v", err)
+	}
+
+	// the bids of other members of the organization are left out
+	ctx = stub.startTransaction("bidder1", "Org2MSP", 80)
+	bids, err := contract.QueryMyBids(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(bids) != 2 {
+		t.Fatalf("expected 2 bids, got %d", len(bids))
+	}
+	if bids[0].AuctionID != testAuctionID || bids[0].BidID != bidID1 || bids[0].Bid.Price != 800 {
+		t.Fatalf("unexpected first bid %+v", bids[0])
+	}
+	if bids[1].AuctionID != "auction2" || bids[1].BidID != bidID2 || bids[1].Bid.Price != 300 {
+		t.Fatalf("unexpected second bid %+v", bids[1])
+	}
+
+	// a bidder without bids gets an empty list
+	bids, err = contract.QueryMyBids(stub.startTransaction("bidder3", "Org2MSP", 80))
+	if err != nil || len(bids) != 0 {
+		t.Fatalf("expected no bids, got %v, %v", bids, err)
+	}
+
+	// the bids can only be read from a peer of the bidder's organization
+	ctx = stub.startTransaction("bidder1", "Org2MSP", 80)
+	os.Setenv("CORE_PEER_LOCALMSPID", "Org1MSP")
+	_, err = contract.QueryMyBids(ctx)
+	expectError(t, err, "is not authorized to read or write private data")
+}
+
+func TestQueryReserve(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, firstPriceAuction, `{"price":500,"salt":"0123456789abcdef"}`, "")
+
+	reserve, err := contract.QueryReserve(stub.startTransaction("seller", "Org1MSP", 60), testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reserve.Price != 500 || reserve.Salt != "0123456789abcdef" {
+		t.Fatalf("unexpected reserve price %+v", reserve)
+	}
+
+	// only the seller can read the reserve price
+	_, err = contract.QueryReserve(stub.startTransaction("bidder1", "Org1MSP", 60), testAuctionID)
+	expectError(t, err, "is not the seller of the auction")
+
+	_, err = contract.QueryReserve(stub.startTransaction("seller", "Org1MSP", 60), "auction2")
+	expectError(t, err, "auction does not exist")
+
+	// an auction without a reserve price has nothing to return
+	ctx := stub.startTransaction("seller", "Org1MSP", 60)
+	err = contract.CreateAuction(ctx, "auction2", "vase", testBiddingDeadline, testRevealDeadline, 0, firstPriceAuction, "", endorseAll, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+	_, err = contract.QueryReserve(stub.startTransaction("seller", "Org1MSP", 60), "auction2")
+	expectError(t, err, "auction auction2 has no reserve price")
+}
@@ -0,0 +1,814 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const testAuctionID = "auction1"
+const testBiddingDeadline = 100
+const testRevealDeadline = 200
+
+func TestRankBids(t *testing.T) {
+	revealedBids := map[string]FullBid{
+		"bid-c": {Price: 500, Bidder: "bidder3"},
+		"bid-b": {Price: 800, Bidder: "bidder2"},
+		"bid-a": {Price: 800, Bidder: "bidder1"},
+		"bid-d": {Price: 700, Bidder: "bidder4"},
+	}
+
+	// ties are resolved by bid key, whatever the map iteration order
+	for i := 0; i < 10; i++ {
+		rankedBids := rankBids(revealedBids)
+		expected := []string{"bid-a", "bid-b", "bid-d", "bid-c"}
+		if len(rankedBids) != len(expected) {
+			t.Fatalf("expected %d ranked bids, got %d", len(expected), len(rankedBids))
+		}
+		for j, key := range expected {
+			if rankedBids[j].Key != key {
+				t.Fatalf("expected bid %s at rank %d, got %s", key, j, rankedBids[j].Key)
+			}
+		}
+	}
+}
+
+func TestWinningPrice(t *testing.T) {
+	rankedBids := rankBids(map[string]FullBid{
+		"bid-a": {Price: 800},
+		"bid-b": {Price: 700},
+	})
+
+	tests := []struct {
+		name       string
+		auction    Auction
+		rankedBids []rankedBid
+		expected   int
+	}{
+		{"first price", Auction{AuctionType: firstPriceAuction}, rankedBids, 800},
+		{"second price", Auction{AuctionType: secondPriceAuction}, rankedBids, 700},
+		{"second price below minimum bid", Auction{AuctionType: secondPriceAuction, MinimumBid: 750}, rankedBids, 750},
+		{"second price with a single bid", Auction{AuctionType: secondPriceAuction, MinimumBid: 100}, rankedBids[:1], 100},
+		{"auction without type", Auction{}, rankedBids, 800},
+	}
+
+	for _, test := range tests {
+		price := winningPrice(&test.auction, test.rankedBids)
+		if price != test.expected {
+			t.Errorf("%s: expected price %d, got %d", test.name, test.expected, price)
+		}
+	}
+}
+
+func TestBidDeadlines(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, firstPriceAuction, "", "")
+
+	bidID, bidJSON := submitTestBid(t, stub, "bidder1", "Org2MSP", 800, 60)
+
+	// bids can not be added after the bidding deadline
+	ctx := stub.startTransaction("bidder2", "Org2MSP", testBiddingDeadline+1)
+	stub.transient["bid"] = []byte(`{"objectType":"bid","price":900,"org":"Org2MSP","bidder":"bidder2"}`)
+	lateBidID, err := contract.Bid(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx = stub.startTransaction("bidder2", "Org2MSP", testBiddingDeadline+1)
+	err = contract.SubmitBid(ctx, testAuctionID, lateBidID)
+	expectError(t, err, "cannot join auction after the bidding deadline")
+
+	// only the seller can close the auction before the bidding deadline
+	ctx = stub.startTransaction("bidder1", "Org2MSP", testBiddingDeadline)
+	err = contract.CloseAuction(ctx, testAuctionID)
+	expectError(t, err, "auction can only be closed by seller before the bidding deadline")
+
+	ctx = stub.startTransaction("bidder1", "Org2MSP", testBiddingDeadline+1)
+	err = contract.CloseAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// bids can not be revealed after the reveal deadline
+	ctx = stub.startTransaction("bidder1", "Org2MSP", testRevealDeadline+1)
+	stub.transient["bid"] = bidJSON
+	err = contract.RevealBid(ctx, testAuctionID, bidID)
+	expectError(t, err, "cannot reveal bid after the reveal deadline")
+
+	ctx = stub.startTransaction("bidder1", "Org2MSP", testRevealDeadline)
+	stub.transient["bid"] = bidJSON
+	err = contract.RevealBid(ctx, testAuctionID, bidID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestWithdrawBid(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, firstPriceAuction, "", "")
+
+	bidID, bidJSON := submitTestBid(t, stub, "bidder1", "Org2MSP", 800, 60)
+
+	// only the bidder can withdraw the bid, and only with the bid that was submitted
+	ctx := stub.startTransaction("bidder2", "Org2MSP", 70)
+	stub.transient["bid"] = bidJSON
+	err := contract.WithdrawBid(ctx, testAuctionID, bidID)
+	expectError(t, err, "client id bidder2 is not the owner of the bid")
+
+	ctx = stub.startTransaction("bidder1", "Org2MSP", 70)
+	stub.transient["bid"] = []byte(`{"objectType":"bid","price":1,"org":"Org2MSP","bidder":"bidder1"}`)
+	err = contract.WithdrawBid(ctx, testAuctionID, bidID)
+	expectError(t, err, "does not match hash in auction")
+
+	ctx = stub.startTransaction("bidder1", "Org2MSP", 70)
+	stub.transient["bid"] = bidJSON
+	err = contract.WithdrawBid(ctx, testAuctionID, bidID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if len(auction.PrivateBids) != 0 {
+		t.Fatalf("expected the bid to be removed from the auction, got %v", auction.PrivateBids)
+	}
+	bidKey, _ := stub.CreateCompositeKey(bidKeyType, []string{testAuctionID, bidID})
+	if stub.PvtState["_implicit_org_Org2MSP"][bidKey] != nil {
+		t.Fatalf("expected the bid to be deleted from the collection")
+	}
+
+	// bids can not be withdrawn after the bidding deadline
+	bidID, bidJSON = submitTestBid(t, stub, "bidder1", "Org2MSP", 700, 80)
+	ctx = stub.startTransaction("bidder1", "Org2MSP", testBiddingDeadline+1)
+	stub.transient["bid"] = bidJSON
+	err = contract.WithdrawBid(ctx, testAuctionID, bidID)
+	expectError(t, err, "cannot change bids after the bidding deadline")
+}
+
+func TestReplaceBid(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, firstPriceAuction, "", "")
+
+	oldBidID, oldBidJSON := submitTestBid(t, stub, "bidder1", "Org2MSP", 800, 60)
+
+	ctx := stub.startTransaction("bidder1", "Org2MSP", 70)
+	stub.transient["bid"] = []byte(`{"objectType":"bid","price":900,"org":"Org2MSP","bidder":"bidder1"}`)
+	newBidID, err := contract.Bid(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx = stub.startTransaction("bidder1", "Org2MSP", 70)
+	stub.transient["bid"] = oldBidJSON
+	err = contract.ReplaceBid(ctx, testAuctionID, oldBidID, oldBidID)
+	expectError(t, err, "cannot replace a bid with itself")
+
+	err = contract.ReplaceBid(ctx, testAuctionID, oldBidID, newBidID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	newBidKey, _ := stub.CreateCompositeKey(bidKeyType, []string{testAuctionID, newBidID})
+	if _, ok := auction.PrivateBids[newBidKey]; !ok || len(auction.PrivateBids) != 1 {
+		t.Fatalf("expected only the new bid in the auction, got %v", auction.PrivateBids)
+	}
+}
+
+func TestEndAuctionReserve(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	reserveJSON := `{"price":500,"salt":"0123456789abcdef"}`
+	createTestAuction(t, stub, secondPriceAuction, reserveJSON, "")
+
+	// the reserve price is stored in the collection of the seller's organization
+	reserveKey, _ := stub.CreateCompositeKey(reserveKeyType, []string{testAuctionID})
+	if stub.PvtState["_implicit_org_Org1MSP"][reserveKey] == nil {
+		t.Fatalf("expected the reserve price in the seller's collection")
+	}
+
+	bidID1, bidJSON1 := submitTestBid(t, stub, "bidder1", "Org2MSP", 800, 60)
+	bidID2, bidJSON2 := submitTestBid(t, stub, "bidder2", "Org2MSP", 300, 60)
+	closeTestAuction(t, stub)
+	revealTestBid(t, stub, "bidder1", bidID1, bidJSON1)
+	revealTestBid(t, stub, "bidder2", bidID2, bidJSON2)
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 160)
+	err := contract.EndAuction(ctx, testAuctionID)
+	expectError(t, err, "reserve key not found in the transient map")
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 160)
+	stub.transient["reserve"] = []byte(`{"price":100,"salt":"0123456789abcdef"}`)
+	err = contract.EndAuction(ctx, testAuctionID)
+	expectError(t, err, "does not match hash in auction")
+
+	// the winner pays the reserve price, which is above the second highest bid
+	ctx = stub.startTransaction("seller", "Org1MSP", 160)
+	stub.transient["reserve"] = []byte(reserveJSON)
+	err = contract.EndAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Status != "ended" || auction.Winner != "bidder1" || auction.Price != 500 || auction.ReservePrice != 500 {
+		t.Fatalf("unexpected auction result %s %s %d %d", auction.Status, auction.Winner, auction.Price, auction.ReservePrice)
+	}
+}
+
+func TestEndAuctionBelowReserve(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	reserveJSON := `{"price":1000,"salt":"0123456789abcdef"}`
+	createTestAuction(t, stub, firstPriceAuction, reserveJSON, "")
+
+	bidID, bidJSON := submitTestBid(t, stub, "bidder1", "Org2MSP", 800, 60)
+	closeTestAuction(t, stub)
+	revealTestBid(t, stub, "bidder1", bidID, bidJSON)
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 160)
+	stub.transient["reserve"] = []byte(reserveJSON)
+	err := contract.EndAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Status != "failed" || auction.Winner != "" || auction.Price != 0 {
+		t.Fatalf("expected the auction to fail, got %s %s %d", auction.Status, auction.Winner, auction.Price)
+	}
+}
+
+func TestEndAuctionForfeit(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, firstPriceAuction, "", "")
+
+	bidID1, bidJSON1 := submitTestBid(t, stub, "bidder1", "Org2MSP", 800, 60)
+	submitTestBid(t, stub, "bidder2", "Org1MSP", 900, 60)
+	closeTestAuction(t, stub)
+	revealTestBid(t, stub, "bidder1", bidID1, bidJSON1)
+
+	// the higher bid of bidder2 is not revealed, so the seller can not end the auction yet
+	ctx := stub.startTransaction("seller", "Org1MSP", 160)
+	err := contract.EndAuction(ctx, testAuctionID)
+	expectError(t, err, "bidder has a higher price")
+
+	// only the seller can end the auction before the reveal deadline
+	ctx = stub.startTransaction("bidder1", "Org2MSP", testRevealDeadline)
+	err = contract.EndAuction(ctx, testAuctionID)
+	expectError(t, err, "auction can only be ended by seller before the reveal deadline")
+
+	// after the reveal deadline anyone can end the auction, and the unrevealed bid is forfeited
+	ctx = stub.startTransaction("bidder1", "Org2MSP", testRevealDeadline+1)
+	err = contract.EndAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Status != "ended" || auction.Winner != "bidder1" || auction.Price != 800 {
+		t.Fatalf("unexpected auction result %s %s %d", auction.Status, auction.Winner, auction.Price)
+	}
+}
+
+func TestSettleAuction(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, firstPriceAuction, "", "token")
+
+	bidID1, bidJSON1 := submitTestBid(t, stub, "bidder1", "Org2MSP", 900, 60)
+	bidID2, bidJSON2 := submitTestBid(t, stub, "bidder2", "Org2MSP", 600, 60)
+	closeTestAuction(t, stub)
+	revealTestBid(t, stub, "bidder1", bidID1, bidJSON1)
+	revealTestBid(t, stub, "bidder2", bidID2, bidJSON2)
+	endTestAuction(t, stub)
+
+	// bidder1 approved the seller but has no token account, so bidder2 wins instead
+	stub.token = newTestToken()
+	stub.token.allowances["bidder1:seller"] = 900
+	stub.token.allowances["bidder2:seller"] = 600
+	stub.token.balances["bidder2"] = 1000
+
+	ctx := stub.startTransaction("bidder2", "Org2MSP", 170)
+	err := contract.SettleAuction(ctx, testAuctionID)
+	expectError(t, err, "auction can only be settled by seller")
+
+	ctx = stub.startTransaction("seller", "Org1MSP", 170)
+	err = contract.SettleAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Status != "settled" || auction.Winner != "bidder2" || auction.Price != 600 {
+		t.Fatalf("unexpected auction result %s %s %d", auction.Status, auction.Winner, auction.Price)
+	}
+	if strings.Join(stub.token.transfers, ",") != "bidder2->seller:600" {
+		t.Fatalf("unexpected transfers %v", stub.token.transfers)
+	}
+}
+
+func TestSettleAuctionWithoutPayingBidder(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, firstPriceAuction, "", "token")
+
+	bidID, bidJSON := submitTestBid(t, stub, "bidder1", "Org2MSP", 900, 60)
+	closeTestAuction(t, stub)
+	revealTestBid(t, stub, "bidder1", bidID, bidJSON)
+	endTestAuction(t, stub)
+
+	// the only bidder has a balance but did not approve the seller
+	stub.token = newTestToken()
+	stub.token.balances["bidder1"] = 1000
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 170)
+	err := contract.SettleAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	auction := queryTestAuction(t, stub)
+	if auction.Status != "failed" || auction.Winner != "" || len(stub.token.transfers) != 0 {
+		t.Fatalf("expected the auction to fail without a transfer, got %s %s %v", auction.Status, auction.Winner, stub.token.transfers)
+	}
+}
+
+func TestSettleAuctionTokenFailure(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+	createTestAuction(t, stub, firstPriceAuction, "", "missing")
+
+	bidID, bidJSON := submitTestBid(t, stub, "bidder1", "Org2MSP", 900, 60)
+	closeTestAuction(t, stub)
+	revealTestBid(t, stub, "bidder1", bidID, bidJSON)
+	endTestAuction(t, stub)
+
+	// the token chaincode of the auction is not deployed, which is no reason to skip the bidder
+	stub.token = newTestToken()
+	stub.token.allowances["bidder1:seller"] = 900
+	stub.token.balances["bidder1"] = 1000
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 170)
+	err := contract.SettleAuction(ctx, testAuctionID)
+	expectError(t, err, "chaincode missing not found")
+
+	auction := queryTestAuction(t, stub)
+	if auction.Status != "ended" || len(stub.token.transfers) != 0 {
+		t.Fatalf("expected the auction to stay ended without a transfer, got %s %v", auction.Status, stub.token.transfers)
+	}
+}
+
+func TestClosedAuctionRequiresEveryOrg(t *testing.T) {
+	stub := newTestStub(t)
+	contract := SmartContract{}
+
+	ctx := stub.startTransaction("seller", "Org1MSP", 50)
+	err := contract.CreateAuction(ctx, testAuctionID, "painting", testBiddingDeadline, testRevealDeadline, 0, firstPriceAuction, "", endorseMajority, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+
+	bidID, bidJSON := submitTestBid(t, stub, "bidder1", "Org2MSP", 800, 60)
+	submitTestBid(t, stub, "bidder2", "Org4MSP", 700, 60)
+	everyOrg := []string{"Org1MSP", "Org2MSP", "Org4MSP"}
+
+	checkAuctionPolicy(t, stub, everyOrg[:2], true)
+
+	// the auction keeps its endorsement mode once it is closed, while the key of the
+	// closed auction requires every participating organization
+	closeTestAuction(t, stub)
+	closedAuctionKey := testClosedAuctionKey(t, stub)
+	checkAuctionPolicy(t, stub, everyOrg[:2], true)
+	checkKeyPolicy(t, stub, closedAuctionKey, everyOrg[:2], false)
+	checkKeyPolicy(t, stub, closedAuctionKey, everyOrg, true)
+
+	// the organization holding an unrevealed bid cannot be left out of the end of the
+	// auction before the reveal deadline, as the end of the auction deletes the key
+	revealTestBid(t, stub, "bidder1", bidID, bidJSON)
+	endTestAuction(t, stub)
+	if _, ok := stub.State[closedAuctionKey]; ok {
+		t.Fatal("expected the end of the auction to delete the key of the closed auction")
+	}
+	checkAuctionPolicy(t, stub, everyOrg[:2], true)
+}
+
+func TestEndAuctionWithoutOneOrg(t *testing.T) {
+	bidOrgs := []string{"Org2MSP", "Org4MSP", "Org5MSP", "Org6MSP", "Org7MSP"}
+	everyOrg := append([]string{"Org1MSP"}, bidOrgs...)
+
+	tests := []struct {
+		endorsementMode      string
+		endorsementThreshold int
+		revealed             int
+		now                  int64
+		winner               string
+	}{
+		// every bid is revealed before the reveal deadline
+		{endorseMajority, 0, 5, 160, "bidder5"},
+		{endorseNOfM, 4, 5, 160, "bidder5"},
+		// the bid of Org7 is forfeited after the reveal deadline
+		{endorseMajority, 0, 4, testRevealDeadline + 1, "bidder4"},
+		{endorseNOfM, 4, 4, testRevealDeadline + 1, "bidder4"},
+	}
+
+	for _, test := range tests {
+		stub := newTestStub(t)
+		contract := SmartContract{}
+
+		ctx := stub.startTransaction("seller", "Org1MSP", 50)
+		err := contract.CreateAuction(ctx, testAuctionID, "painting", testBiddingDeadline, testRevealDeadline, 0, firstPriceAuction, "", test.endorsementMode, test.endorsementThreshold)
+		if err != nil {
+			t.Fatalf("failed to create auction: %v", err)
+		}
+
+		var bidIDs []string
+		var bidJSONs [][]byte
+		for i, org := range bidOrgs {
+			bidID, bidJSON := submitTestBid(t, stub, fmt.Sprintf("bidder%d", i+1), org, 100*(i+1), 60)
+			bidIDs = append(bidIDs, bidID)
+			bidJSONs = append(bidJSONs, bidJSON)
+		}
+		closeTestAuction(t, stub)
+
+		for i := 0; i < test.revealed; i++ {
+			ctx = stub.startTransaction(fmt.Sprintf("bidder%d", i+1), bidOrgs[i], 150)
+			stub.transient["bid"] = bidJSONs[i]
+			err = contract.RevealBid(ctx, testAuctionID, bidIDs[i])
+			if err != nil {
+				t.Fatalf("failed to reveal bid: %v", err)
+			}
+		}
+
+		ctx = stub.startTransaction("seller", "Org1MSP", test.now)
+		err = contract.EndAuction(ctx, testAuctionID)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.endorsementMode, err)
+		}
+
+		auction := queryTestAuction(t, stub)
+		if auction.Status != "ended" || auction.Winner != test.winner {
+			t.Fatalf("%s: unexpected auction result %s %s", test.endorsementMode, auction.Status, auction.Winner)
+		}
+
+		// the end of the auction leaves the key of the closed auction as it is, so only
+		// the policy of the endorsement mode applies and Org7 can be left out
+		closedAuctionKey := testClosedAuctionKey(t, stub)
+		if _, ok := stub.State[closedAuctionKey]; !ok {
+			t.Fatalf("%s: expected the key of the closed auction to be left as it is", test.endorsementMode)
+		}
+		checkKeyPolicy(t, stub, closedAuctionKey, everyOrg[:5], false)
+		checkAuctionPolicy(t, stub, everyOrg[:5], true)
+		checkAuctionPolicy(t, stub, everyOrg[:3], false)
+	}
+}
+
+// testStub adds the transient map, private data hashes and private data deletes to the
+// shim mock stub. Each transaction is started with startTransaction. Chaincode invocations
+// are sent to the token chaincode mock
+type testStub struct {
+	*shimtest.MockStub
+	transient map[string][]byte
+	txCount   int
+	token     *testToken
+}
+
+func newTestStub(t *testing.T) *testStub {
+	t.Cleanup(func() { os.Unsetenv("CORE_PEER_LOCALMSPID") })
+	return &testStub{MockStub: shimtest.NewMockStub("auction", nil)}
+}
+
+// startTransaction starts a new transaction submitted by the client at the given time,
+// and sent to a peer of the client's organization
+func (stub *testStub) startTransaction(clientID string, mspID string, now int64) *contractapi.TransactionContext {
+	stub.txCount++
+	stub.MockTransactionStart(fmt.Sprintf("tx%d", stub.txCount))
+	stub.TxTimestamp = &timestamp.Timestamp{Seconds: now}
+	stub.transient = map[string][]byte{}
+	os.Setenv("CORE_PEER_LOCALMSPID", mspID)
+
+	ctx := &contractapi.TransactionContext{}
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(&testClientIdentity{id: clientID, mspID: mspID})
+
+	return ctx
+}
+
+func (stub *testStub) GetTransient() (map[string][]byte, error) {
+	return stub.transient, nil
+}
+
+func (stub *testStub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value := stub.PvtState[collection][key]
+	if value == nil {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+func (stub *testStub) DelPrivateData(collection string, key string) error {
+	delete(stub.PvtState[collection], key)
+	return nil
+}
+
+// GetPrivateDataByPartialCompositeKey returns the keys of the collection that start with
+// the partial composite key, in lexical order
+func (stub *testStub) GetPrivateDataByPartialCompositeKey(collection string, objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	partialCompositeKey, err := stub.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for key := range stub.PvtState[collection] {
+		if strings.HasPrefix(key, partialCompositeKey) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	iterator := &testIterator{}
+	for _, key := range keys {
+		iterator.records = append(iterator.records, &queryresult.KV{Key: key, Value: stub.PvtState[collection][key]})
+	}
+	return iterator, nil
+}
+
+// GetQueryResultWithPagination supports rich queries with a selector of string fields
+// that must all be equal. The bookmark is the key of the first record of the next page
+func (stub *testStub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	var richQuery struct {
+		Selector map[string]string `json:"selector"`
+	}
+	err := json.Unmarshal([]byte(query), &richQuery)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iterator := &testIterator{}
+	metadata := &peer.QueryResponseMetadata{}
+	for elem := stub.Keys.Front(); elem != nil; elem = elem.Next() {
+		key := elem.Value.(string)
+		if key < bookmark {
+			continue
+		}
+
+		var document map[string]interface{}
+		if json.Unmarshal(stub.State[key], &document) != nil {
+			continue
+		}
+		matches := true
+		for field, value := range richQuery.Selector {
+			if document[field] != value {
+				matches = false
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		if metadata.FetchedRecordsCount == pageSize {
+			metadata.Bookmark = key
+			break
+		}
+		iterator.records = append(iterator.records, &queryresult.KV{Key: key, Value: stub.State[key]})
+		metadata.FetchedRecordsCount++
+	}
+
+	return iterator, metadata, nil
+}
+
+func (stub *testStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	if stub.token == nil || chaincodeName != "token" {
+		return shim.Error(fmt.Sprintf("chaincode %s not found", chaincodeName))
+	}
+	return stub.token.invoke(args)
+}
+
+// testIterator iterates over the records of a query
+type testIterator struct {
+	records []*queryresult.KV
+}
+
+func (iterator *testIterator) HasNext() bool {
+	return len(iterator.records) > 0
+}
+
+func (iterator *testIterator) Next() (*queryresult.KV, error) {
+	record := iterator.records[0]
+	iterator.records = iterator.records[1:]
+	return record, nil
+}
+
+func (iterator *testIterator) Close() error {
+	return nil
+}
+
+// testToken is a token chaincode mock that holds balances and allowances by client ID
+// and records the transfers made with TransferFrom. Like the ERC-20 token chaincode, it
+// takes base64 encoded client IDs as accounts and fails for accounts without a balance
+type testToken struct {
+	balances   map[string]int
+	allowances map[string]int
+	transfers  []string
+}
+
+func newTestToken() *testToken {
+	return &testToken{balances: map[string]int{}, allowances: map[string]int{}}
+}
+
+func (token *testToken) invoke(args [][]byte) peer.Response {
+	// the accounts are the first two arguments of every function
+	accounts := []string{}
+	for i := 1; i < len(args) && i <= 2; i++ {
+		account, err := base64.StdEncoding.DecodeString(string(args[i]))
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		accounts = append(accounts, string(account))
+	}
+
+	switch string(args[0]) {
+	case "Allowance":
+		return shim.Success([]byte(strconv.Itoa(token.allowances[accounts[0]+":"+accounts[1]])))
+	case "BalanceOf":
+		balance, ok := token.balances[accounts[0]]
+		if !ok {
+			return shim.Error(fmt.Sprintf("the account %s does not exist", args[1]))
+		}
+		return shim.Success([]byte(strconv.Itoa(balance)))
+	case "TransferFrom":
+		token.transfers = append(token.transfers, fmt.Sprintf("%s->%s:%s", accounts[0], accounts[1], args[3]))
+		return shim.Success(nil)
+	}
+
+	return shim.Error(fmt.Sprintf("unknown function %s", args[0]))
+}
+
+// testClientIdentity is a client identity with a fixed MSP ID. Its ID is base64 encoded
+// like the IDs returned by the client identity library
+type testClientIdentity struct {
+	id    string
+	mspID string
+}
+
+func (identity *testClientIdentity) GetID() (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(identity.id)), nil
+}
+
+func (identity *testClientIdentity) GetMSPID() (string, error) {
+	return identity.mspID, nil
+}
+
+func (identity *testClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (identity *testClientIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	return nil
+}
+
+func (identity *testClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+// createTestAuction creates an auction of the seller of Org1 at time 50, with an optional reserve price and token chaincode
+func createTestAuction(t *testing.T, stub *testStub, auctionType string, reserveJSON string, tokenChaincode string) {
+	contract := SmartContract{}
+	ctx := stub.startTransaction("seller", "Org1MSP", 50)
+	if reserveJSON != "" {
+		stub.transient["reserve"] = []byte(reserveJSON)
+	}
+
+	err := contract.CreateAuction(ctx, testAuctionID, "painting", testBiddingDeadline, testRevealDeadline, 0, auctionType, tokenChaincode, endorseAll, 0)
+	if err != nil {
+		t.Fatalf("failed to create auction: %v", err)
+	}
+}
+
+// submitTestBid creates a bid and adds it to the auction, and returns the bid ID and the bid JSON
+func submitTestBid(t *testing.T, stub *testStub, bidder string, org string, price int, now int64) (string, []byte) {
+	contract := SmartContract{}
+	bidJSON := []byte(fmt.Sprintf(`{"objectType":"bid","price":%d,"org":"%s","bidder":"%s"}`, price, org, bidder))
+
+	ctx := stub.startTransaction(bidder, org, now)
+	stub.transient["bid"] = bidJSON
+	bidID, err := contract.Bid(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("failed to create bid: %v", err)
+	}
+
+	ctx = stub.startTransaction(bidder, org, now)
+	err = contract.SubmitBid(ctx, testAuctionID, bidID)
+	if err != nil {
+		t.Fatalf("failed to submit bid: %v", err)
+	}
+
+	return bidID, bidJSON
+}
+
+// closeTestAuction closes the auction as the seller after the bidding deadline
+func closeTestAuction(t *testing.T, stub *testStub) {
+	contract := SmartContract{}
+	ctx := stub.startTransaction("seller", "Org1MSP", testBiddingDeadline+1)
+	err := contract.CloseAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("failed to close auction: %v", err)
+	}
+}
+
+// revealTestBid reveals the bid of a bidder of Org2 before the reveal deadline
+func revealTestBid(t *testing.T, stub *testStub, bidder string, bidID string, bidJSON []byte) {
+	contract := SmartContract{}
+	ctx := stub.startTransaction(bidder, "Org2MSP", 150)
+	stub.transient["bid"] = bidJSON
+	err := contract.RevealBid(ctx, testAuctionID, bidID)
+	if err != nil {
+		t.Fatalf("failed to reveal bid: %v", err)
+	}
+}
+
+// endTestAuction ends the auction as the seller after every bid has been revealed
+func endTestAuction(t *testing.T, stub *testStub) {
+	contract := SmartContract{}
+	ctx := stub.startTransaction("seller", "Org1MSP", 160)
+	err := contract.EndAuction(ctx, testAuctionID)
+	if err != nil {
+		t.Fatalf("failed to end auction: %v", err)
+	}
+}
+
+// queryTestAuction reads the auction from the world state
+func queryTestAuction(t *testing.T, stub *testStub) *Auction {
+	contract := SmartContract{}
+	auction, err := contract.QueryAuction(stub.startTransaction("seller", "Org1MSP", 0), testAuctionID)
+	if err != nil {
+		t.Fatalf("failed to query auction: %v", err)
+	}
+	return auction
+}
+
+// testClosedAuctionKey returns the key that CloseAuction stores for the auction
+func testClosedAuctionKey(t *testing.T, stub *testStub) string {
+	closedAuctionKey, err := stub.CreateCompositeKey(closedAuctionKeyType, []string{testAuctionID})
+	if err != nil {
+		t.Fatalf("failed to create composite key: %v", err)
+	}
+	return closedAuctionKey
+}
+
+// checkAuctionPolicy checks whether peers of the endorsing organizations satisfy the
+// endorsement policy of the auction
+func checkAuctionPolicy(t *testing.T, stub *testStub, endorsers []string, expected bool) {
+	t.Helper()
+	checkKeyPolicy(t, stub, testAuctionID, endorsers, expected)
+}
+
+// checkKeyPolicy checks whether peers of the endorsing organizations satisfy the
+// endorsement policy of a key
+func checkKeyPolicy(t *testing.T, stub *testStub, key string, endorsers []string, expected bool) {
+	t.Helper()
+
+	policyBytes, err := stub.GetStateValidationParameter(key)
+	if err != nil {
+		t.Fatalf("failed to get validation parameter: %v", err)
+	}
+	policy := &common.SignaturePolicyEnvelope{}
+	err = proto.Unmarshal(policyBytes, policy)
+	if err != nil {
+		t.Fatalf("failed to unmarshal policy: %v", err)
+	}
+
+	checkPolicy(t, policy, endorsers, expected)
+}
+
+// expectError fails the test unless the error contains the message
+func expectError(t *testing.T, err error, message string) {
+	t.Helper()
+	if err == nil || !strings.Contains(err.Error(), message) {
+		t.Fatalf("expected an error containing %q, got %v", message, err)
+	}
+}
@@ -5,12 +5,19 @@ SPDX-License-Identifier: Apache-2.0
 package auction
 
 import (
-	"fmt"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
-	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/msp"
 )
 
 func (s *SmartContract) GetSubmittingClientIdentity(ctx contractapi.TransactionContextInterface) (string, error) {
@@ -26,20 +33,18 @@ func (s *SmartContract) GetSubmittingClientIdentity(ctx contractapi.TransactionC
 	return string(decodeID), nil
 }
 
-// setAssetStateBasedEndorsement sets the endorsement policy of a new auction
-func setAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface, auctionID string, orgToEndorse string) error {
+// setAssetStateBasedEndorsement sets the endorsement policy of the auction from its
+// participating organizations and its endorsement mode. The policy is created again
+// whenever a new organization joins the auction
+func setAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface, auctionID string, auction *Auction) error {
 
-	endorsementPolicy, err := statebased.NewStateEP(nil)
+	endorsementPolicy, err := auctionEndorsementPolicy(auction)
 	if err != nil {
 		return err
 	}
-	err = endorsementPolicy.AddOrgs(statebased.RoleTypePeer, orgToEndorse)
+	policy, err := proto.Marshal(endorsementPolicy)
 	if err != nil {
-		return fmt.Errorf("failed to add org to endorsement policy: %v", err)
-	}
-	policy, err := endorsementPolicy.Policy()
-	if err != nil {
-		return fmt.Errorf("failed to create endorsement policy bytes from org: %v", err)
+		return fmt.Errorf("failed to create endorsement policy bytes from orgs: %v", err)
 	}
 	err = ctx.GetStub().SetStateValidationParameter(auctionID, policy)
 	if err != nil {
@@ -49,35 +54,83 @@ func setAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface,
 	return nil
 }
 
-// addAssetStateBasedEndorsement adds a new organization as an endorser of the auction
-func addAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface, auctionID string, orgToEndorse string) error {
+// setClosedAuctionEndorsement stores the participating organizations of a closed auction
+// under a key that every participating organization needs to endorse. EndAuction deletes
+// the key while a bid that was not revealed could still win the auction, so that each
+// organization checks its private data collection. Once the reveal deadline has passed
+// or every bid is revealed, the key is left as it is and the auction can be ended with
+// the endorsement policy of its endorsement mode
+func setClosedAuctionEndorsement(ctx contractapi.TransactionContextInterface, auctionID string, auction *Auction) error {
 
-	endorsementPolicy, err := ctx.GetStub().GetStateValidationParameter(auctionID)
+	closedAuctionKey, err := ctx.GetStub().CreateCompositeKey(closedAuctionKeyType, []string{auctionID})
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to create composite key: %v", err)
 	}
 
-	newEndorsementPolicy, err := statebased.NewStateEP(endorsementPolicy)
+	orgsJSON, err := json.Marshal(auction.Orgs)
 	if err != nil {
 		return err
 	}
 
-	err = newEndorsementPolicy.AddOrgs(statebased.RoleTypePeer, orgToEndorse)
+	err = ctx.GetStub().PutState(closedAuctionKey, orgsJSON)
 	if err != nil {
-		return fmt.Errorf("failed to add org to endorsement policy: %v", err)
+		return fmt.Errorf("failed to put closed auction in public data: %v", err)
 	}
-	policy, err := newEndorsementPolicy.Policy()
+
+	everyOrg := *auction
+	everyOrg.EndorsementMode = endorseAll
+
+	return setAssetStateBasedEndorsement(ctx, closedAuctionKey, &everyOrg)
+}
+
+// deleteClosedAuctionKey deletes the key stored by setClosedAuctionEndorsement, which
+// requires the endorsement of every participating organization
+func deleteClosedAuctionKey(ctx contractapi.TransactionContextInterface, auctionID string) error {
+
+	closedAuctionKey, err := ctx.GetStub().CreateCompositeKey(closedAuctionKeyType, []string{auctionID})
 	if err != nil {
-		return fmt.Errorf("failed to create endorsement policy bytes from org: %v", err)
+		return fmt.Errorf("failed to create composite key: %v", err)
 	}
-	err = ctx.GetStub().SetStateValidationParameter(auctionID, policy)
+
+	err = ctx.GetStub().DelState(closedAuctionKey)
 	if err != nil {
-		return fmt.Errorf("failed to set validation parameter on auction: %v", err)
+		return fmt.Errorf("failed to delete closed auction from public data: %v", err)
 	}
 
 	return nil
 }
 
+// auctionEndorsementPolicy creates the endorsement policy of the auction that requires
+// the peers of the participating organizations. The first participating organization
+// is the seller's organization
+func auctionEndorsementPolicy(auction *Auction) (*common.SignaturePolicyEnvelope, error) {
+
+	principals := make([]*msp.MSPPrincipal, len(auction.Orgs))
+	for i, org := range auction.Orgs {
+		principal, err := proto.Marshal(
+			&msp.MSPRole{
+				Role:          msp.MSPRole_PEER,
+				MspIdentifier: org,
+			},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add org to endorsement policy: %v", err)
+		}
+		principals[i] = &msp.MSPPrincipal{
+			PrincipalClassification: msp.MSPPrincipal_ROLE,
+			Principal:               principal,
+		}
+	}
+
+	policy := &common.SignaturePolicyEnvelope{
+		Version:    0,
+		Rule:       participantPolicy(len(auction.Orgs), auction.EndorsementMode, auction.EndorsementThreshold),
+		Identities: principals,
+	}
+
+	return policy, nil
+}
+
 // getCollectionName is an internal helper function to get collection of submitting client identity.
 func getCollectionName(ctx contractapi.TransactionContextInterface) (string, error) {
 
@@ -111,6 +164,310 @@ func verifyClientOrgMatchesPeerOrg(ctx contractapi.TransactionContextInterface)
 	return nil
 }
 
+// putReservePrice stores the reserve price of an auction in the private data collection
+// of the seller's organization, and returns the hash of the reserve price
+func putReservePrice(ctx contractapi.TransactionContextInterface, auctionID string, reserveJSON []byte) (string, error) {
+
+	var reserve ReservePrice
+	err := json.Unmarshal(reserveJSON, &reserve)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal reserve price: %v", err)
+	}
+	if reserve.Price <= 0 {
+		return "", fmt.Errorf("reserve price must be a positive integer")
+	}
+	if reserve.Salt == "" {
+		return "", fmt.Errorf("reserve price needs a salt to keep it private")
+	}
+
+	// the seller has to target their peer to store the reserve price
+	err = verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return "", fmt.Errorf("Cannot store reserve price on this peer, not a member of this org: Error %v", err)
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	reserveKey, err := ctx.GetStub().CreateCompositeKey(reserveKeyType, []string{auctionID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(collection, reserveKey, reserveJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to input reserve price into collection: %v", err)
+	}
+
+	// the private data hash cannot be read in the transaction that writes the private data,
+	// but it is the SHA-256 hash of the value
+	reserveHash := sha256.Sum256(reserveJSON)
+
+	return fmt.Sprintf("%x", reserveHash), nil
+}
+
+// readRevealedReservePrice reads the reserve price from the transient map and checks it
+// against the hash in the auction and in the seller's private data collection. It returns
+// nil if the reserve price is not in the transient map
+func readRevealedReservePrice(ctx contractapi.TransactionContextInterface, auctionID string, auction *Auction) (*ReservePrice, error) {
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+
+	reserveJSON, ok := transientMap["reserve"]
+	if !ok {
+		return nil, nil
+	}
+
+	calculatedReserveHash := fmt.Sprintf("%x", sha256.Sum256(reserveJSON))
+	if calculatedReserveHash != auction.ReserveHash {
+		return nil, fmt.Errorf("hash %s for reserve price does not match hash in auction: %s", calculatedReserveHash, auction.ReserveHash)
+	}
+
+	collection := "_implicit_org_" + auction.SellerOrg
+
+	reserveKey, err := ctx.GetStub().CreateCompositeKey(reserveKeyType, []string{auctionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	reserveHash, err := ctx.GetStub().GetPrivateDataHash(collection, reserveKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reserve price hash from collection: %v", err)
+	}
+	if fmt.Sprintf("%x", reserveHash) != auction.ReserveHash {
+		return nil, fmt.Errorf("reserve price hash in collection does not match hash in auction")
+	}
+
+	var reserve ReservePrice
+	err = json.Unmarshal(reserveJSON, &reserve)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal reserve price: %v", err)
+	}
+
+	return &reserve, nil
+}
+
+// getTxTime returns the transaction timestamp as a Unix time in seconds. The timestamp
+// is set by the client that submits the transaction and is the same on every endorser
+func getTxTime(ctx contractapi.TransactionContextInterface) (int64, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	return txTimestamp.GetSeconds(), nil
+}
+
+// removePrivateBid removes a bid from an open auction and deletes it from the private
+// data collection of the bidder's organization. The bid is read from the transient map
+// and checked against the hashes of the bid, so that every organization can verify that
+// the client removing the bid is the bidder
+func removePrivateBid(ctx contractapi.TransactionContextInterface, auction *Auction, auctionID string, txID string, clientID string) error {
+
+	// bids can only change while bids can still be added to the auction
+	if auction.Status != "open" {
+		return fmt.Errorf("cannot change bids of closed or ended auction")
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now > auction.BiddingDeadline {
+		return fmt.Errorf("cannot change bids after the bidding deadline")
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+
+	transientBidJSON, ok := transientMap["bid"]
+	if !ok {
+		return fmt.Errorf("bid key not found in the transient map")
+	}
+
+	bidKey, err := ctx.GetStub().CreateCompositeKey(bidKeyType, []string{auctionID, txID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	privateBid, bidInAuction := auction.PrivateBids[bidKey]
+	if !bidInAuction {
+		return fmt.Errorf("bid %s has not been submitted to the auction", bidKey)
+	}
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP ID: %v", err)
+	}
+	if privateBid.Org != clientOrgID {
+		return fmt.Errorf("Permission denied, client from org %v did not submit the bid", clientOrgID)
+	}
+
+	// the bid in the transient map has to match the bid in the auction and in the collection
+	calculatedBidHash := fmt.Sprintf("%x", sha256.Sum256(transientBidJSON))
+	if calculatedBidHash != privateBid.Hash {
+		return fmt.Errorf("hash %s for bid JSON %s does not match hash in auction: %s", calculatedBidHash, transientBidJSON, privateBid.Hash)
+	}
+
+	collection := "_implicit_org_" + privateBid.Org
+
+	bidHash, err := ctx.GetStub().GetPrivateDataHash(collection, bidKey)
+	if err != nil {
+		return fmt.Errorf("failed to read bid hash from collection: %v", err)
+	}
+	if fmt.Sprintf("%x", bidHash) != privateBid.Hash {
+		return fmt.Errorf("bid hash in collection does not match hash in auction")
+	}
+
+	var bid FullBid
+	err = json.Unmarshal(transientBidJSON, &bid)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	if bid.Bidder != clientID {
+		return fmt.Errorf("Permission denied, client id %v is not the owner of the bid", clientID)
+	}
+
+	err = ctx.GetStub().DelPrivateData(collection, bidKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete bid from collection: %v", err)
+	}
+
+	delete(auction.PrivateBids, bidKey)
+
+	return nil
+}
+
+// rankedBid is a revealed bid together with its key in the auction
+type rankedBid struct {
+	Key string
+	Bid FullBid
+}
+
+// rankBids returns the revealed bids ordered from the highest to the lowest price
+func rankBids(revealedBids map[string]FullBid) []rankedBid {
+
+	rankedBids := make([]rankedBid, 0, len(revealedBids))
+	for bidKey, bid := range revealedBids {
+		rankedBids = append(rankedBids, rankedBid{Key: bidKey, Bid: bid})
+	}
+
+	sort.Slice(rankedBids, func(i, j int) bool {
+		return bidOutranks(rankedBids[i].Bid.Price, rankedBids[i].Key, rankedBids[j].Bid.Price, rankedBids[j].Key)
+	})
+
+	return rankedBids
+}
+
+// bidOutranks reports whether a bid ranks above another bid. Bids with the same price
+// are ordered by bid key, which contains the transaction ID of the bid, so that every
+// peer resolves ties the same way
+func bidOutranks(price int, bidKey string, otherPrice int, otherBidKey string) bool {
+	if price != otherPrice {
+		return price > otherPrice
+	}
+	return bidKey < otherBidKey
+}
+
+// winningPrice returns the price paid by the highest ranked bidder, before the reserve
+// price is taken into account. In a second price auction the winner pays the second
+// highest revealed price, or the minimum bid if there is no second bid above it
+func winningPrice(auction *Auction, rankedBids []rankedBid) int {
+
+	if auction.AuctionType != secondPriceAuction {
+		return rankedBids[0].Bid.Price
+	}
+
+	price := auction.MinimumBid
+	if len(rankedBids) > 1 && rankedBids[1].Bid.Price > price {
+		price = rankedBids[1].Bid.Price
+	}
+
+	return price
+}
+
+// missingAccountMessage is part of the error the ERC-20 token chaincode returns from BalanceOf
+// for an account that has never held tokens
+const missingAccountMessage = "does not exist"
+
+// payWithToken transfers price tokens from the bidder to the seller with the TransferFrom
+// function of the token chaincode, which uses the allowance of the client that submits the
+// transaction. It returns false without transferring any tokens if the allowance or the
+// balance of the bidder is too small, or if the bidder has no account in the token chaincode.
+// Any other error of the token chaincode, such as a chaincode that is not deployed, is
+// returned so that the settlement is retried instead of counting the bidder as defaulted
+func payWithToken(ctx contractapi.TransactionContextInterface, tokenChaincode string, bidder string, seller string, price int) (bool, error) {
+
+	// the token chaincode identifies accounts by the base64 encoded client ID
+	bidderAccount := base64.StdEncoding.EncodeToString([]byte(bidder))
+	sellerAccount := base64.StdEncoding.EncodeToString([]byte(seller))
+
+	allowance, err := queryToken(ctx, tokenChaincode, "Allowance", bidderAccount, sellerAccount)
+	if err != nil {
+		return false, err
+	}
+	if allowance < price {
+		return false, nil
+	}
+
+	balance, err := queryToken(ctx, tokenChaincode, "BalanceOf", bidderAccount)
+	if err != nil {
+		if strings.Contains(err.Error(), missingAccountMessage) {
+			return false, nil
+		}
+		return false, err
+	}
+	if balance < price {
+		return false, nil
+	}
+
+	_, err = invokeToken(ctx, tokenChaincode, "TransferFrom", bidderAccount, sellerAccount, strconv.Itoa(price))
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// queryToken calls a function of the token chaincode that returns an amount of tokens
+func queryToken(ctx contractapi.TransactionContextInterface, tokenChaincode string, function string, args ...string) (int, error) {
+
+	payload, err := invokeToken(ctx, tokenChaincode, function, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	amount, err := strconv.Atoi(string(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse the result of %s from chaincode %s: %v", function, tokenChaincode, err)
+	}
+
+	return amount, nil
+}
+
+// invokeToken calls a function of the token chaincode on the channel of the auction
+func invokeToken(ctx contractapi.TransactionContextInterface, tokenChaincode string, function string, args ...string) ([]byte, error) {
+
+	invokeArgs := [][]byte{[]byte(function)}
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+
+	response := ctx.GetStub().InvokeChaincode(tokenChaincode, invokeArgs, "")
+	if response.Status != shim.OK {
+		return nil, fmt.Errorf("failed to invoke %s on chaincode %s: %s", function, tokenChaincode, response.Message)
+	}
+
+	return response.Payload, nil
+}
+
 func contains(sli []string, str string) bool {
 	for _, a := range sli {
 		if a == str {
@@ -7,6 +7,7 @@ package commercialpaper
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	ledgerapi "github.com/hyperledger/fabric-samples/commercial-paper/organization/digibank/contract-go/ledger-api"
 )
@@ -47,17 +48,50 @@ type jsonCommercialPaper struct {
 	Key   string `json:"key"`
 }
 
-// CommercialPaper defines a commercial paper
+// Trade records a change of ownership of a commercial paper
+// and the price the buyer paid for it
+type Trade struct {
+	TxID     string `json:"txID"`
+	Seller   string `json:"seller"`
+	Buyer    string `json:"buyer"`
+	Price    int    `json:"price"`
+	DateTime string `json:"dateTime"`
+}
+
+// CommercialPaper defines a commercial paper. The issue and
+// maturity date times are RFC 3339 timestamps, which are kept
+// parsed alongside their JSON string values, together with the
+// error from parsing them when the paper is read. Papers paid for
+// with a cash token name the token chaincode and hold the token
+// accounts of the issuer and the owner
 type CommercialPaper struct {
-	PaperNumber      string `json:"paperNumber"`
-	Issuer           string `json:"issuer"`
-	IssueDateTime    string `json:"issueDateTime"`
-	FaceValue        int    `json:"faceValue"`
-	MaturityDateTime string `json:"maturityDateTime"`
-	Owner            string `json:"owner"`
-	state            State  `metadata:"currentState"`
-	class            string `metadata:"class"`
-	key              string `metadata:"key"`
+	PaperNumber      string  `json:"paperNumber"`
+	Issuer           string  `json:"issuer"`
+	IssueDateTime    string  `json:"issueDateTime"`
+	FaceValue        int     `json:"faceValue"`
+	MaturityDateTime string  `json:"maturityDateTime"`
+	Owner            string  `json:"owner"`
+	TokenChaincode   string  `json:"tokenChaincode,omitempty" metadata:"tokenChaincode,optional"`
+	IssuerAccount    string  `json:"issuerAccount,omitempty" metadata:"issuerAccount,optional"`
+	OwnerAccount     string  `json:"ownerAccount,omitempty" metadata:"ownerAccount,optional"`
+	Trades           []Trade `json:"trades,omitempty" metadata:"trades,optional"`
+	state            State   `metadata:"currentState"`
+	class            string  `metadata:"class"`
+	key              string  `metadata:"key"`
+	issueTime        time.Time
+	maturityTime     time.Time
+	dateTimeErr      error
+}
+
+// ParseDateTime parses an RFC 3339 date time of a commercial paper
+func ParseDateTime(dateTime string) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339, dateTime)
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Date time %s is not an RFC 3339 timestamp", dateTime)
+	}
+
+	return parsed, nil
 }
 
 // UnmarshalJSON special handler for managing JSON marshalling
@@ -72,6 +106,14 @@ func (cp *CommercialPaper) UnmarshalJSON(data []byte) error {
 
 	cp.state = jcp.State
 
+	// papers stored before the date times were checked may hold
+	// values that do not parse. They can still be read, but their
+	// times are left as zero and the parse error is kept so that
+	// the paper cannot be bought or redeemed
+	cp.issueTime = time.Time{}
+	cp.maturityTime = time.Time{}
+	cp.dateTimeErr = cp.SetDateTimes(cp.IssueDateTime, cp.MaturityDateTime)
+
 	return nil
 }
 
@@ -87,6 +129,51 @@ func (cp *CommercialPaper) GetState() State {
 	return cp.state
 }
 
+// SetDateTimes parses and sets the issue and maturity date times
+func (cp *CommercialPaper) SetDateTimes(issueDateTime string, maturityDateTime string) error {
+	issueTime, err := ParseDateTime(issueDateTime)
+
+	if err != nil {
+		return err
+	}
+
+	maturityTime, err := ParseDateTime(maturityDateTime)
+
+	if err != nil {
+		return err
+	}
+
+	cp.IssueDateTime = issueDateTime
+	cp.MaturityDateTime = maturityDateTime
+	cp.issueTime = issueTime
+	cp.maturityTime = maturityTime
+	cp.dateTimeErr = nil
+
+	return nil
+}
+
+// GetIssueTime returns the parsed issue date time
+func (cp *CommercialPaper) GetIssueTime() time.Time {
+	return cp.issueTime
+}
+
+// GetMaturityTime returns the parsed maturity date time, or the
+// zero time if the paper has no valid maturity date time
+func (cp *CommercialPaper) GetMaturityTime() time.Time {
+	return cp.maturityTime
+}
+
+// GetDateTimeError returns the error from parsing the date times
+// when the paper was read, or nil if they are both valid
+func (cp *CommercialPaper) GetDateTimeError() error {
+	return cp.dateTimeErr
+}
+
+// AddTrade adds a change of ownership to the trades of the paper
+func (cp *CommercialPaper) AddTrade(trade Trade) {
+	cp.Trades = append(cp.Trades, trade)
+}
+
 // SetIssued returns the state to issued
 func (cp *CommercialPaper) SetIssued() {
 	cp.state = ISSUED
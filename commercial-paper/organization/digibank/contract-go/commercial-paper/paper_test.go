@@ -6,6 +6,7 @@ package commercialpaper
 
 import (
 	"testing"
+	"time"
 
 	ledgerapi "github.com/hyperledger/fabric-samples/commercial-paper/organization/digibank/contract-go/ledger-api"
 	"github.com/stretchr/testify/assert"
@@ -77,6 +78,32 @@ func TestIsRedeemed(t *testing.T) {
 	assert.False(t, cp.IsRedeemed(), "should be false when status not set to redeemed")
 }
 
+func TestSetDateTimes(t *testing.T) {
+	cp := new(CommercialPaper)
+
+	err := cp.SetDateTimes("2020-05-31T09:00:00Z", "2020-11-30T09:00:00+01:00")
+	assert.Nil(t, err, "should not error for RFC 3339 date times")
+	assert.Equal(t, "2020-05-31T09:00:00Z", cp.IssueDateTime, "should set issue date time")
+	assert.Equal(t, "2020-11-30T09:00:00+01:00", cp.MaturityDateTime, "should set maturity date time")
+	assert.True(t, time.Date(2020, 5, 31, 9, 0, 0, 0, time.UTC).Equal(cp.GetIssueTime()), "should parse issue date time")
+	assert.True(t, time.Date(2020, 11, 30, 8, 0, 0, 0, time.UTC).Equal(cp.GetMaturityTime()), "should parse maturity date time")
+
+	cp = new(CommercialPaper)
+	err = cp.SetDateTimes("2020-05-31", "2020-11-30T09:00:00Z")
+	assert.EqualError(t, err, "Date time 2020-05-31 is not an RFC 3339 timestamp", "should error for date without time")
+	assert.Equal(t, "", cp.IssueDateTime, "should not set date times when one does not parse")
+	assert.True(t, cp.GetMaturityTime().IsZero(), "should not set times when one does not parse")
+}
+
+func TestAddTrade(t *testing.T) {
+	cp := new(CommercialPaper)
+
+	cp.AddTrade(Trade{TxID: "sometxid", Seller: "someowner", Buyer: "someotherowner", Price: 900, DateTime: "2020-06-01T10:00:00Z"})
+	cp.AddTrade(Trade{TxID: "someothertxid", Seller: "someotherowner", Buyer: "someissuer", Price: 1000, DateTime: "2020-12-01T10:00:00Z"})
+	assert.Len(t, cp.Trades, 2, "should add trades to the paper")
+	assert.Equal(t, "someotherowner", cp.Trades[1].Seller, "should add trades in order")
+}
+
 func TestGetSplitKey(t *testing.T) {
 	cp := new(CommercialPaper)
 	cp.PaperNumber = "somepaper"
@@ -98,6 +125,15 @@ func TestSerialize(t *testing.T) {
 	bytes, err := cp.Serialize()
 	assert.Nil(t, err, "should not error on serialize")
 	assert.Equal(t, `{"paperNumber":"somepaper","issuer":"someissuer","issueDateTime":"sometime","faceValue":1000,"maturityDateTime":"somelatertime","owner":"someowner","currentState":2,"class":"org.papernet.commercialpaper","key":"someissuer:somepaper"}`, string(bytes), "should return JSON formatted value")
+
+	cp.TokenChaincode = "token"
+	cp.IssuerAccount = "issueraccount"
+	cp.OwnerAccount = "owneraccount"
+	cp.AddTrade(Trade{TxID: "sometxid", Seller: "someissuer", Buyer: "someowner", Price: 900, DateTime: "2020-06-01T10:00:00Z"})
+
+	bytes, err = cp.Serialize()
+	assert.Nil(t, err, "should not error on serialize with trades")
+	assert.Equal(t, `{"paperNumber":"somepaper","issuer":"someissuer","issueDateTime":"sometime","faceValue":1000,"maturityDateTime":"somelatertime","owner":"someowner","tokenChaincode":"token","issuerAccount":"issueraccount","ownerAccount":"owneraccount","trades":[{"txID":"sometxid","seller":"someissuer","buyer":"someowner","price":900,"dateTime":"2020-06-01T10:00:00Z"}],"currentState":2,"class":"org.papernet.commercialpaper","key":"someissuer:somepaper"}`, string(bytes), "should return JSON formatted value with trades")
 }
 
 func TestDeserialize(t *testing.T) {
@@ -116,8 +152,26 @@ func TestDeserialize(t *testing.T) {
 	cp = new(CommercialPaper)
 	err = Deserialize([]byte(goodJSON), cp)
 	assert.Nil(t, err, "should not return error for deserialize")
+	assert.EqualError(t, cp.GetDateTimeError(), "Date time sometime is not an RFC 3339 timestamp", "should keep the error for date times that do not parse")
+	assert.True(t, cp.GetMaturityTime().IsZero(), "should not set times when one does not parse")
+	expectedCp.dateTimeErr = cp.GetDateTimeError()
 	assert.Equal(t, expectedCp, cp, "should create expected commercial paper")
 
+	datedJSON := `{"paperNumber":"somepaper","issuer":"someissuer","issueDateTime":"2020-05-31T09:00:00Z","faceValue":1000,"maturityDateTime":"2020-11-30T09:00:00Z","owner":"someowner","currentState":2,"class":"org.papernet.commercialpaper","key":"someissuer:somepaper"}`
+	cp = new(CommercialPaper)
+	err = Deserialize([]byte(datedJSON), cp)
+	assert.Nil(t, err, "should not return error for deserialize with RFC 3339 date times")
+	assert.True(t, time.Date(2020, 5, 31, 9, 0, 0, 0, time.UTC).Equal(cp.GetIssueTime()), "should parse issue date time")
+	assert.True(t, time.Date(2020, 11, 30, 9, 0, 0, 0, time.UTC).Equal(cp.GetMaturityTime()), "should parse maturity date time")
+	assert.Nil(t, cp.GetDateTimeError(), "should not keep an error for RFC 3339 date times")
+
+	badMaturityJSON := `{"paperNumber":"somepaper","issuer":"someissuer","issueDateTime":"2020-05-31T09:00:00Z","faceValue":1000,"maturityDateTime":"2020-11-30","owner":"someowner","currentState":2,"class":"org.papernet.commercialpaper","key":"someissuer:somepaper"}`
+	err = Deserialize([]byte(badMaturityJSON), cp)
+	assert.Nil(t, err, "should not return error for deserialize with a maturity date time that does not parse")
+	assert.EqualError(t, cp.GetDateTimeError(), "Date time 2020-11-30 is not an RFC 3339 timestamp", "should keep the error for a maturity date time that does not parse")
+	assert.True(t, cp.GetIssueTime().IsZero(), "should reset the times of a previously read paper")
+	assert.True(t, cp.GetMaturityTime().IsZero(), "should not set the maturity time when it does not parse")
+
 	badJSON := `{"paperNumber":"somepaper","issuer":"someissuer","issueDateTime":"sometime","faceValue":"NaN","maturityDateTime":"somelatertime","owner":"someowner","currentState":2,"class":"org.papernet.commercialpaper","key":"someissuer:somepaper"}`
 	cp = new(CommercialPaper)
 	err = Deserialize([]byte(badJSON), cp)
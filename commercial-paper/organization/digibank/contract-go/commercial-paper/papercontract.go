@@ -6,7 +6,10 @@ package commercialpaper
 
 import (
 	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
@@ -22,21 +25,29 @@ func (c *Contract) Instantiate() {
 	fmt.Println("Instantiated")
 }
 
-// Issue creates a new commercial paper and stores it in the world state
+// Issue creates a new commercial paper and stores it in the world state.
+// The issue and maturity date times are RFC 3339 timestamps and the
+// paper must mature after it is issued. The paper is traded without
+// payment, use IssueWithToken to settle its trades with a cash token
 func (c *Contract) Issue(ctx TransactionContextInterface, issuer string, paperNumber string, issueDateTime string, maturityDateTime string, faceValue int) (*CommercialPaper, error) {
-	paper := CommercialPaper{PaperNumber: paperNumber, Issuer: issuer, IssueDateTime: issueDateTime, FaceValue: faceValue, MaturityDateTime: maturityDateTime, Owner: issuer}
-	paper.SetIssued()
-
-	err := ctx.GetPaperList().AddPaper(&paper)
+	return issue(ctx, issuer, paperNumber, issueDateTime, maturityDateTime, faceValue, "")
+}
 
-	if err != nil {
-		return nil, err
+// IssueWithToken creates a new commercial paper like Issue, and the paper
+// is bought and redeemed with the ERC-20 token of the token chaincode.
+// The client that issues the paper holds the issuer's token account
+func (c *Contract) IssueWithToken(ctx TransactionContextInterface, issuer string, paperNumber string, issueDateTime string, maturityDateTime string, faceValue int, tokenChaincode string) (*CommercialPaper, error) {
+	if tokenChaincode == "" {
+		return nil, fmt.Errorf("Paper %s:%s must name a token chaincode", issuer, paperNumber)
 	}
 
-	return &paper, nil
+	return issue(ctx, issuer, paperNumber, issueDateTime, maturityDateTime, faceValue, tokenChaincode)
 }
 
-// Buy updates a commercial paper to be in trading status and sets the new owner
+// Buy updates a commercial paper to be in trading status and sets the new owner.
+// If the paper is paid for with a token, the client that submits the
+// transaction pays the price to the token account of the current owner
+// and becomes the new owner's account
 func (c *Contract) Buy(ctx TransactionContextInterface, issuer string, paperNumber string, currentOwner string, newOwner string, price int, purchaseDateTime string) (*CommercialPaper, error) {
 	paper, err := ctx.GetPaperList().GetPaper(issuer, paperNumber)
 
@@ -56,6 +67,38 @@ func (c *Contract) Buy(ctx TransactionContextInterface, issuer string, paperNumb
 		return nil, fmt.Errorf("Paper %s:%s is not trading. Current state = %s", issuer, paperNumber, paper.GetState())
 	}
 
+	matured, err := isMatured(ctx, paper)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if matured {
+		return nil, fmt.Errorf("Paper %s:%s cannot be bought after it matured at %s", issuer, paperNumber, paper.MaturityDateTime)
+	}
+
+	if paper.TokenChaincode != "" {
+		buyerAccount, err := ctx.GetClientIdentity().GetID()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get client identity. %s", err.Error())
+		}
+
+		err = invokeToken(ctx, paper.TokenChaincode, "Transfer", paper.OwnerAccount, strconv.Itoa(price))
+
+		if err != nil {
+			return nil, err
+		}
+
+		paper.OwnerAccount = buyerAccount
+	}
+
+	err = addTrade(ctx, paper, currentOwner, newOwner, price)
+
+	if err != nil {
+		return nil, err
+	}
+
 	paper.Owner = newOwner
 
 	err = ctx.GetPaperList().UpdatePaper(paper)
@@ -67,7 +110,9 @@ func (c *Contract) Buy(ctx TransactionContextInterface, issuer string, paperNumb
 	return paper, nil
 }
 
-// Redeem updates a commercial paper status to be redeemed
+// Redeem updates a commercial paper status to be redeemed. If the paper
+// is paid for with a token, the issuer submits the transaction and pays
+// the face value from the issuer's token account to the holder's
 func (c *Contract) Redeem(ctx TransactionContextInterface, issuer string, paperNumber string, redeemingOwner string, redeenDateTime string) (*CommercialPaper, error) {
 	paper, err := ctx.GetPaperList().GetPaper(issuer, paperNumber)
 
@@ -83,6 +128,45 @@ func (c *Contract) Redeem(ctx TransactionContextInterface, issuer string, paperN
 		return nil, fmt.Errorf("Paper %s:%s is already redeemed", issuer, paperNumber)
 	}
 
+	matured, err := isMatured(ctx, paper)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !matured {
+		return nil, fmt.Errorf("Paper %s:%s cannot be redeemed before it matures at %s", issuer, paperNumber, paper.MaturityDateTime)
+	}
+
+	if paper.TokenChaincode != "" {
+		issuerAccount, err := ctx.GetClientIdentity().GetID()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get client identity. %s", err.Error())
+		}
+
+		if issuerAccount != paper.IssuerAccount {
+			return nil, fmt.Errorf("Paper %s:%s can only be redeemed by the holder of the issuer's token account", issuer, paperNumber)
+		}
+
+		// the issuer has nothing to pay for a paper that it holds itself
+		if paper.OwnerAccount != issuerAccount {
+			err = invokeToken(ctx, paper.TokenChaincode, "Transfer", paper.OwnerAccount, strconv.Itoa(paper.FaceValue))
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		paper.OwnerAccount = issuerAccount
+	}
+
+	err = addTrade(ctx, paper, redeemingOwner, paper.Issuer, paper.FaceValue)
+
+	if err != nil {
+		return nil, err
+	}
+
 	paper.Owner = paper.Issuer
 	paper.SetRedeemed()
 
@@ -94,3 +178,113 @@ func (c *Contract) Redeem(ctx TransactionContextInterface, issuer string, paperN
 
 	return paper, nil
 }
+
+// issue creates a new commercial paper and stores it in the world state.
+// If a token chaincode is named, the client that issues the paper holds
+// the issuer's token account
+func issue(ctx TransactionContextInterface, issuer string, paperNumber string, issueDateTime string, maturityDateTime string, faceValue int, tokenChaincode string) (*CommercialPaper, error) {
+	paper := CommercialPaper{PaperNumber: paperNumber, Issuer: issuer, FaceValue: faceValue, Owner: issuer}
+
+	err := paper.SetDateTimes(issueDateTime, maturityDateTime)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !paper.GetMaturityTime().After(paper.GetIssueTime()) {
+		return nil, fmt.Errorf("Paper %s:%s must mature after it is issued", issuer, paperNumber)
+	}
+
+	if tokenChaincode != "" {
+		issuerAccount, err := ctx.GetClientIdentity().GetID()
+
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get client identity. %s", err.Error())
+		}
+
+		paper.TokenChaincode = tokenChaincode
+		paper.IssuerAccount = issuerAccount
+		paper.OwnerAccount = issuerAccount
+	}
+
+	paper.SetIssued()
+
+	err = ctx.GetPaperList().AddPaper(&paper)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &paper, nil
+}
+
+// isMatured returns true if the paper has matured at the time of the
+// transaction. A paper without valid date times is neither matured nor
+// unmatured, and returns an error instead
+func isMatured(ctx TransactionContextInterface, paper *CommercialPaper) (bool, error) {
+	err := paper.GetDateTimeError()
+
+	if err != nil {
+		return false, fmt.Errorf("Paper %s:%s has invalid date times. %s", paper.Issuer, paper.PaperNumber, err.Error())
+	}
+
+	maturityTime := paper.GetMaturityTime()
+
+	if maturityTime.IsZero() {
+		return false, fmt.Errorf("Maturity date time %s is not an RFC 3339 timestamp", paper.MaturityDateTime)
+	}
+
+	txTime, err := getTxTime(ctx)
+
+	if err != nil {
+		return false, err
+	}
+
+	return !txTime.Before(maturityTime), nil
+}
+
+// addTrade records the change of ownership of the paper in this
+// transaction and the price that the buyer paid
+func addTrade(ctx TransactionContextInterface, paper *CommercialPaper, seller string, buyer string, price int) error {
+	txTime, err := getTxTime(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	paper.AddTrade(Trade{TxID: ctx.GetStub().GetTxID(), Seller: seller, Buyer: buyer, Price: price, DateTime: txTime.UTC().Format(time.RFC3339)})
+
+	return nil
+}
+
+// getTxTime returns the transaction timestamp. The timestamp is set by
+// the client that submits the transaction and is the same on every
+// endorsing peer
+func getTxTime(ctx TransactionContextInterface) (time.Time, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to get transaction timestamp. %s", err.Error())
+	}
+
+	return time.Unix(txTimestamp.GetSeconds(), int64(txTimestamp.GetNanos())), nil
+}
+
+// invokeToken calls a function of the token chaincode on the same channel.
+// The token chaincode acts on behalf of the client that submitted this
+// transaction, and an error from it fails the whole transaction
+func invokeToken(ctx TransactionContextInterface, tokenChaincode string, function string, args ...string) error {
+	invokeArgs := [][]byte{[]byte(function)}
+
+	for _, arg := range args {
+		invokeArgs = append(invokeArgs, []byte(arg))
+	}
+
+	response := ctx.GetStub().InvokeChaincode(tokenChaincode, invokeArgs, "")
+
+	if response.Status != shim.OK {
+		return fmt.Errorf("Token chaincode %s failed to %s. %s", tokenChaincode, function, response.Message)
+	}
+
+	return nil
+}
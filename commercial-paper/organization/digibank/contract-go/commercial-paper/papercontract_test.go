@@ -6,9 +6,16 @@ package commercialpaper
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -38,6 +45,79 @@ func (mpl *MockPaperList) UpdatePaper(paper *CommercialPaper) error {
 	return args.Error(0)
 }
 
+type MockStub struct {
+	shim.ChaincodeStubInterface
+	txTime      time.Time
+	invocations []string
+	invokeError string
+	token       *MockToken
+}
+
+func (ms *MockStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: ms.txTime.Unix()}, nil
+}
+
+func (ms *MockStub) GetTxID() string {
+	return "sometxid"
+}
+
+func (ms *MockStub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) peer.Response {
+	invocation := chaincodeName
+
+	for _, arg := range args {
+		invocation += " " + string(arg)
+	}
+
+	ms.invocations = append(ms.invocations, invocation)
+
+	if ms.invokeError != "" {
+		return shim.Error(ms.invokeError)
+	}
+
+	if ms.token != nil {
+		return ms.token.invoke(args)
+	}
+
+	return shim.Success(nil)
+}
+
+// MockToken keeps the balances of the accounts of an ERC-20 token
+// chaincode, and transfers tokens from the account of its client
+type MockToken struct {
+	balances map[string]int
+	client   string
+}
+
+func (mt *MockToken) invoke(args [][]byte) peer.Response {
+	if string(args[0]) != "Transfer" {
+		return shim.Error(fmt.Sprintf("unknown function %s", args[0]))
+	}
+
+	amount, err := strconv.Atoi(string(args[2]))
+
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if mt.balances[mt.client] < amount {
+		return shim.Error("client account has insufficient funds")
+	}
+
+	mt.balances[mt.client] -= amount
+	mt.balances[string(args[1])] += amount
+
+	return shim.Success(nil)
+}
+
+type MockClientIdentity struct {
+	cid.ClientIdentity
+	id string
+}
+
+func (mci *MockClientIdentity) GetID() (string, error) {
+	return mci.id, nil
+}
+
 type MockTransactionContext struct {
 	contractapi.TransactionContext
 	paperList *MockPaperList
@@ -47,11 +127,49 @@ func (mtc *MockTransactionContext) GetPaperList() ListInterface {
 	return mtc.paperList
 }
 
+func newMockTransactionContext(mpl *MockPaperList, txTime string) *MockTransactionContext {
+	ctx := new(MockTransactionContext)
+	ctx.paperList = mpl
+	ctx.SetStub(&MockStub{txTime: mustParseDateTime(txTime)})
+	ctx.SetClientIdentity(&MockClientIdentity{id: "someclient"})
+
+	return ctx
+}
+
+func setTokenClient(ctx *MockTransactionContext, token *MockToken, client string) {
+	ctx.SetClientIdentity(&MockClientIdentity{id: client})
+	token.client = client
+}
+
+func mustParseDateTime(dateTime string) time.Time {
+	parsed, err := ParseDateTime(dateTime)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
+
 func resetPaper(paper *CommercialPaper) {
+	paper.Issuer = "someissuer"
 	paper.Owner = "someowner"
+	paper.FaceValue = 1000
+	paper.SetDateTimes("2019-12-01T10:00:00Z", "2020-12-01T10:00:00Z")
+	paper.TokenChaincode = ""
+	paper.IssuerAccount = ""
+	paper.OwnerAccount = ""
+	paper.Trades = nil
 	paper.SetTrading()
 }
 
+func resetTokenPaper(paper *CommercialPaper) {
+	resetPaper(paper)
+	paper.TokenChaincode = "token"
+	paper.IssuerAccount = "issueraccount"
+	paper.OwnerAccount = "owneraccount"
+}
+
 // #########
 // TESTS
 // #########
@@ -71,15 +189,42 @@ func TestIssue(t *testing.T) {
 	mpl.On("AddPaper", mock.MatchedBy(func(paper *CommercialPaper) bool { sentPaper = paper; return paper.Issuer == "someissuer" })).Return(nil)
 	mpl.On("AddPaper", mock.MatchedBy(func(paper *CommercialPaper) bool { sentPaper = paper; return paper.Issuer == "someotherissuer" })).Return(errors.New("AddPaper error"))
 
-	expectedPaper := CommercialPaper{PaperNumber: "somepaper", Issuer: "someissuer", IssueDateTime: "someissuedate", FaceValue: 1000, MaturityDateTime: "somematuritydate", Owner: "someissuer", state: 1}
-	paper, err = contract.Issue(ctx, "someissuer", "somepaper", "someissuedate", "somematuritydate", 1000)
+	expectedPaper := CommercialPaper{PaperNumber: "somepaper", Issuer: "someissuer", IssueDateTime: "2019-12-01T10:00:00Z", FaceValue: 1000, MaturityDateTime: "2020-12-01T10:00:00Z", Owner: "someissuer", state: 1, issueTime: mustParseDateTime("2019-12-01T10:00:00Z"), maturityTime: mustParseDateTime("2020-12-01T10:00:00Z")}
+	paper, err = contract.Issue(ctx, "someissuer", "somepaper", "2019-12-01T10:00:00Z", "2020-12-01T10:00:00Z", 1000)
 	assert.Nil(t, err, "should not error when add paper does not error")
 	assert.Equal(t, sentPaper, paper, "should send the same paper as it returns to add paper")
 	assert.Equal(t, expectedPaper, *paper, "should correctly configure paper")
 
-	paper, err = contract.Issue(ctx, "someotherissuer", "somepaper", "someissuedate", "somematuritydate", 1000)
+	paper, err = contract.Issue(ctx, "someotherissuer", "somepaper", "2019-12-01T10:00:00Z", "2020-12-01T10:00:00Z", 1000)
 	assert.EqualError(t, err, "AddPaper error", "should return error when add paper fails")
 	assert.Nil(t, paper, "should not return paper when fails")
+
+	paper, err = contract.Issue(ctx, "someissuer", "somepaper", "someissuedate", "2020-12-01T10:00:00Z", 1000)
+	assert.EqualError(t, err, "Date time someissuedate is not an RFC 3339 timestamp", "should return error when issue date time is not RFC 3339")
+	assert.Nil(t, paper, "should not return paper when issue date time is not RFC 3339")
+
+	paper, err = contract.Issue(ctx, "someissuer", "somepaper", "2019-12-01T10:00:00Z", "somematuritydate", 1000)
+	assert.EqualError(t, err, "Date time somematuritydate is not an RFC 3339 timestamp", "should return error when maturity date time is not RFC 3339")
+	assert.Nil(t, paper, "should not return paper when maturity date time is not RFC 3339")
+
+	paper, err = contract.Issue(ctx, "someissuer", "somepaper", "2019-12-01T10:00:00Z", "2019-12-01T10:00:00Z", 1000)
+	assert.EqualError(t, err, "Paper someissuer:somepaper must mature after it is issued", "should return error when paper matures when it is issued")
+	assert.Nil(t, paper, "should not return paper when it matures when it is issued")
+
+	paper, err = contract.Issue(ctx, "someissuer", "somepaper", "2019-12-01T10:00:00Z", "2019-06-01T10:00:00Z", 1000)
+	assert.EqualError(t, err, "Paper someissuer:somepaper must mature after it is issued", "should return error when paper matures before it is issued")
+	assert.Nil(t, paper, "should not return paper when it matures before it is issued")
+
+	ctx = newMockTransactionContext(mpl, "2019-12-01T10:00:00Z")
+	paper, err = contract.IssueWithToken(ctx, "someissuer", "somepaper", "2019-12-01T10:00:00Z", "2020-12-01T10:00:00Z", 1000, "")
+	assert.EqualError(t, err, "Paper someissuer:somepaper must name a token chaincode", "should return error when the token chaincode is not named")
+	assert.Nil(t, paper, "should not return paper when the token chaincode is not named")
+
+	paper, err = contract.IssueWithToken(ctx, "someissuer", "somepaper", "2019-12-01T10:00:00Z", "2020-12-01T10:00:00Z", 1000, "token")
+	assert.Nil(t, err, "should not error when issuing paper paid for with a token")
+	assert.Equal(t, "token", paper.TokenChaincode, "should set the token chaincode of the paper")
+	assert.Equal(t, "someclient", paper.IssuerAccount, "should set the issuer account to the issuing client")
+	assert.Equal(t, "someclient", paper.OwnerAccount, "should set the owner account to the issuing client")
 }
 
 func TestBuy(t *testing.T) {
@@ -87,8 +232,7 @@ func TestBuy(t *testing.T) {
 	var err error
 
 	mpl := new(MockPaperList)
-	ctx := new(MockTransactionContext)
-	ctx.paperList = mpl
+	ctx := newMockTransactionContext(mpl, "2020-06-01T10:00:00Z")
 
 	contract := new(Contract)
 
@@ -132,6 +276,27 @@ func TestBuy(t *testing.T) {
 	assert.Equal(t, "someotherowner", paper.Owner, "should update the owner of the paper")
 	assert.True(t, paper.IsTrading(), "should mark issued paper as trading")
 	assert.Equal(t, sentPaper, paper, "should update same paper as it returns in the world state")
+	assert.Equal(t, []Trade{{TxID: "sometxid", Seller: "someowner", Buyer: "someotherowner", Price: 100, DateTime: "2020-06-01T10:00:00Z"}}, paper.Trades, "should record the trade of the paper")
+
+	resetPaper(wsPaper)
+	ctx = newMockTransactionContext(mpl, "2020-12-01T10:00:01Z")
+	paper, err = contract.Buy(ctx, "someissuer", "somepaper", "someowner", "someotherowner", 100, "2020-12-01T10:00:01Z")
+	assert.EqualError(t, err, "Paper someissuer:somepaper cannot be bought after it matured at 2020-12-01T10:00:00Z", "should error when paper has matured")
+	assert.Nil(t, paper, "should not return paper when it has matured")
+
+	resetPaper(wsPaper)
+	wsPaper.MaturityDateTime = "somematuritydate"
+	wsPaper.maturityTime = time.Time{}
+	paper, err = contract.Buy(ctx, "someissuer", "somepaper", "someowner", "someotherowner", 100, "2020-12-01T10:00:01Z")
+	assert.EqualError(t, err, "Maturity date time somematuritydate is not an RFC 3339 timestamp", "should error when maturity date time is not known")
+	assert.Nil(t, paper, "should not return paper when maturity date time is not known")
+
+	resetPaper(wsPaper)
+	err = Deserialize([]byte(`{"paperNumber":"somepaper","issuer":"someissuer","issueDateTime":"someissuedate","faceValue":1000,"maturityDateTime":"2020-12-01T10:00:00Z","owner":"someowner","currentState":2}`), wsPaper)
+	assert.Nil(t, err, "should read a paper with an issue date time that does not parse")
+	paper, err = contract.Buy(ctx, "someissuer", "somepaper", "someowner", "someotherowner", 100, "2020-06-01T10:00:00Z")
+	assert.EqualError(t, err, "Paper someissuer:somepaper has invalid date times. Date time someissuedate is not an RFC 3339 timestamp", "should error when issue date time does not parse")
+	assert.Nil(t, paper, "should not return paper when issue date time does not parse")
 }
 
 func TestRedeem(t *testing.T) {
@@ -139,8 +304,7 @@ func TestRedeem(t *testing.T) {
 	var err error
 
 	mpl := new(MockPaperList)
-	ctx := new(MockTransactionContext)
-	ctx.paperList = mpl
+	ctx := newMockTransactionContext(mpl, "2021-12-10T10:00:00Z")
 
 	contract := new(Contract)
 
@@ -182,4 +346,152 @@ func TestRedeem(t *testing.T) {
 	assert.Nil(t, err, "should not error on good redeem")
 	assert.True(t, paper.IsRedeemed(), "should return redeemed paper")
 	assert.Equal(t, sentPaper, paper, "should update same paper as it returns in the world state")
+	assert.Equal(t, "someissuer", paper.Owner, "should return the paper to the issuer")
+	assert.Equal(t, []Trade{{TxID: "sometxid", Seller: "someowner", Buyer: "someissuer", Price: 1000, DateTime: "2021-12-10T10:00:00Z"}}, paper.Trades, "should record the redemption of the paper")
+
+	resetPaper(wsPaper)
+	ctx = newMockTransactionContext(mpl, "2020-12-01T09:59:59Z")
+	paper, err = contract.Redeem(ctx, "someissuer", "somepaper", "someowner", "2020-12-01T09:59:59Z")
+	assert.EqualError(t, err, "Paper someissuer:somepaper cannot be redeemed before it matures at 2020-12-01T10:00:00Z", "should error when paper has not matured")
+	assert.Nil(t, paper, "should not return paper when it has not matured")
+
+	resetPaper(wsPaper)
+	ctx = newMockTransactionContext(mpl, "2020-12-01T10:00:00Z")
+	paper, err = contract.Redeem(ctx, "someissuer", "somepaper", "someowner", "2020-12-01T10:00:00Z")
+	assert.Nil(t, err, "should not error when redeemed at maturity")
+	assert.True(t, paper.IsRedeemed(), "should return redeemed paper at maturity")
+
+	// a paper stored with a maturity date time that does not parse
+	// has not matured since the zero time, and cannot be redeemed
+	resetPaper(wsPaper)
+	err = Deserialize([]byte(`{"paperNumber":"somepaper","issuer":"someissuer","issueDateTime":"2019-12-01T10:00:00Z","faceValue":1000,"maturityDateTime":"somematuritydate","owner":"someowner","currentState":2}`), wsPaper)
+	assert.Nil(t, err, "should read a paper with a maturity date time that does not parse")
+	paper, err = contract.Redeem(ctx, "someissuer", "somepaper", "someowner", "2020-12-01T10:00:00Z")
+	assert.EqualError(t, err, "Paper someissuer:somepaper has invalid date times. Date time somematuritydate is not an RFC 3339 timestamp", "should error when maturity date time does not parse")
+	assert.Nil(t, paper, "should not return paper when maturity date time does not parse")
+	assert.False(t, wsPaper.IsRedeemed(), "should not redeem paper when maturity date time does not parse")
+}
+
+func TestBuyWithToken(t *testing.T) {
+	var paper *CommercialPaper
+	var err error
+
+	mpl := new(MockPaperList)
+	ctx := newMockTransactionContext(mpl, "2020-06-01T10:00:00Z")
+	ctx.SetClientIdentity(&MockClientIdentity{id: "buyeraccount"})
+	stub := ctx.GetStub().(*MockStub)
+
+	contract := new(Contract)
+
+	wsPaper := new(CommercialPaper)
+	resetTokenPaper(wsPaper)
+
+	mpl.On("GetPaper", "someissuer", "somepaper").Return(wsPaper, nil)
+	mpl.On("UpdatePaper", wsPaper).Return(nil)
+
+	stub.invokeError = "transfer amount cannot be negative"
+	paper, err = contract.Buy(ctx, "someissuer", "somepaper", "someowner", "someotherowner", -100, "2020-06-01T10:00:00Z")
+	assert.EqualError(t, err, "Token chaincode token failed to Transfer. transfer amount cannot be negative", "should error when the token transfer fails")
+	assert.Nil(t, paper, "should not return paper when the token transfer fails")
+	stub.invokeError = ""
+	stub.invocations = nil
+
+	resetTokenPaper(wsPaper)
+	paper, err = contract.Buy(ctx, "someissuer", "somepaper", "someowner", "someotherowner", 900, "2020-06-01T10:00:00Z")
+	assert.Nil(t, err, "should not error when the buyer pays the owner")
+	assert.Equal(t, []string{"token Transfer owneraccount 900"}, stub.invocations, "should transfer the price from the buyer to the owner")
+	assert.Equal(t, "buyeraccount", paper.OwnerAccount, "should set the owner account to the buyer")
+	assert.Equal(t, "issueraccount", paper.IssuerAccount, "should keep the issuer account")
+	assert.Equal(t, []Trade{{TxID: "sometxid", Seller: "someowner", Buyer: "someotherowner", Price: 900, DateTime: "2020-06-01T10:00:00Z"}}, paper.Trades, "should record the price paid for the paper")
+}
+
+func TestRedeemWithToken(t *testing.T) {
+	var paper *CommercialPaper
+	var err error
+
+	mpl := new(MockPaperList)
+	ctx := newMockTransactionContext(mpl, "2021-12-10T10:00:00Z")
+	stub := ctx.GetStub().(*MockStub)
+
+	contract := new(Contract)
+
+	wsPaper := new(CommercialPaper)
+	resetTokenPaper(wsPaper)
+
+	mpl.On("GetPaper", "someissuer", "somepaper").Return(wsPaper, nil)
+	mpl.On("UpdatePaper", wsPaper).Return(nil)
+
+	ctx.SetClientIdentity(&MockClientIdentity{id: "owneraccount"})
+	paper, err = contract.Redeem(ctx, "someissuer", "somepaper", "someowner", "2021-12-10T10:00:00Z")
+	assert.EqualError(t, err, "Paper someissuer:somepaper can only be redeemed by the holder of the issuer's token account", "should error when the client is not the issuer")
+	assert.Nil(t, paper, "should not return paper when the client is not the issuer")
+	assert.Empty(t, stub.invocations, "should not transfer tokens when the client is not the issuer")
+
+	ctx.SetClientIdentity(&MockClientIdentity{id: "issueraccount"})
+	stub.invokeError = "client account issueraccount has insufficient funds"
+	resetTokenPaper(wsPaper)
+	paper, err = contract.Redeem(ctx, "someissuer", "somepaper", "someowner", "2021-12-10T10:00:00Z")
+	assert.EqualError(t, err, "Token chaincode token failed to Transfer. client account issueraccount has insufficient funds", "should error when the issuer cannot pay the face value")
+	assert.Nil(t, paper, "should not return paper when the token transfer fails")
+	stub.invokeError = ""
+	stub.invocations = nil
+
+	resetTokenPaper(wsPaper)
+	paper, err = contract.Redeem(ctx, "someissuer", "somepaper", "someowner", "2021-12-10T10:00:00Z")
+	assert.Nil(t, err, "should not error when the issuer pays the holder")
+	assert.Equal(t, []string{"token Transfer owneraccount 1000"}, stub.invocations, "should transfer the face value from the issuer to the holder")
+	assert.Equal(t, "issueraccount", paper.OwnerAccount, "should return the owner account to the issuer")
+	assert.True(t, paper.IsRedeemed(), "should return redeemed paper")
+	assert.Equal(t, []Trade{{TxID: "sometxid", Seller: "someowner", Buyer: "someissuer", Price: 1000, DateTime: "2021-12-10T10:00:00Z"}}, paper.Trades, "should record the face value paid for the paper")
+	stub.invocations = nil
+
+	resetTokenPaper(wsPaper)
+	wsPaper.Owner = "someissuer"
+	wsPaper.OwnerAccount = "issueraccount"
+	paper, err = contract.Redeem(ctx, "someissuer", "somepaper", "someissuer", "2021-12-10T10:00:00Z")
+	assert.Nil(t, err, "should not error when the issuer redeems a paper it holds")
+	assert.Empty(t, stub.invocations, "should not transfer tokens when the issuer holds the paper")
+	assert.True(t, paper.IsRedeemed(), "should return redeemed paper held by the issuer")
+}
+
+func TestTokenSettlement(t *testing.T) {
+	var paper *CommercialPaper
+	var err error
+
+	mpl := new(MockPaperList)
+	ctx := newMockTransactionContext(mpl, "2020-05-31T09:00:00Z")
+	token := &MockToken{balances: map[string]int{"issueraccount": 200, "buyeraccount": 5000}}
+	ctx.GetStub().(*MockStub).token = token
+
+	contract := new(Contract)
+
+	wsPaper := new(CommercialPaper)
+
+	mpl.On("AddPaper", mock.Anything).Run(func(args mock.Arguments) { *wsPaper = *args.Get(0).(*CommercialPaper) }).Return(nil)
+	mpl.On("GetPaper", "MagnetoCorp", "00001").Return(wsPaper, nil)
+	mpl.On("UpdatePaper", wsPaper).Return(nil)
+
+	setTokenClient(ctx, token, "issueraccount")
+	_, err = contract.IssueWithToken(ctx, "MagnetoCorp", "00001", "2020-05-31T09:00:00Z", "2020-11-30T09:00:00Z", 5000, "token")
+	assert.Nil(t, err, "should not error when issuing the paper")
+
+	setTokenClient(ctx, token, "buyeraccount")
+	ctx.GetStub().(*MockStub).txTime = mustParseDateTime("2020-06-01T09:00:00Z")
+	_, err = contract.Buy(ctx, "MagnetoCorp", "00001", "MagnetoCorp", "DigiBank", 4900, "2020-06-01T09:00:00Z")
+	assert.Nil(t, err, "should not error when the buyer pays the price")
+	assert.Equal(t, map[string]int{"issueraccount": 5100, "buyeraccount": 100}, token.balances, "should pay the price to the issuer")
+
+	// the holder cannot redeem the paper and take the face value from the issuer
+	ctx.GetStub().(*MockStub).txTime = mustParseDateTime("2020-11-30T09:00:00Z")
+	paper, err = contract.Redeem(ctx, "MagnetoCorp", "00001", "DigiBank", "2020-11-30T09:00:00Z")
+	assert.EqualError(t, err, "Paper MagnetoCorp:00001 can only be redeemed by the holder of the issuer's token account", "should error when the holder redeems the paper")
+	assert.Nil(t, paper, "should not return paper when the holder redeems the paper")
+
+	setTokenClient(ctx, token, "issueraccount")
+	paper, err = contract.Redeem(ctx, "MagnetoCorp", "00001", "DigiBank", "2020-11-30T09:00:00Z")
+	assert.Nil(t, err, "should not error when the issuer pays the face value")
+	assert.Equal(t, map[string]int{"issueraccount": 100, "buyeraccount": 5100}, token.balances, "should pay the face value to the holder")
+	assert.True(t, paper.IsRedeemed(), "should return redeemed paper")
+	assert.Equal(t, "MagnetoCorp", paper.Owner, "should return the paper to the issuer")
+	assert.Len(t, paper.Trades, 2, "should record the purchase and the redemption of the paper")
 }
@@ -4,7 +4,10 @@ go 1.13
 
 require (
 	github.com/go-openapi/jsonreference v0.19.3 // indirect
+	github.com/golang/protobuf v1.3.2
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20200424173110-d7076418f212
 	github.com/hyperledger/fabric-contract-api-go v1.1.0
+	github.com/hyperledger/fabric-protos-go v0.0.0-20200424173316-dd554ba3746e
 	github.com/mailru/easyjson v0.7.0 // indirect
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/tools v0.1.0 // indirect
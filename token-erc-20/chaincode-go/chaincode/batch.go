@@ -0,0 +1,157 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for options
+const maxBatchSizeKey = "maxBatchSize"
+
+// defaultMaxBatchSize is the maximum number of recipients in a BatchTransfer until SetMaxBatchSize is called
+const defaultMaxBatchSize = 100
+
+// batchTransferEvent provides an organized struct for emitting BatchTransfer events
+type batchTransferEvent struct {
+	From   string   `json:"from"`
+	To     []string `json:"to"`
+	Values []int    `json:"values"`
+	Total  int      `json:"total"`
+}
+
+// BatchTransfer transfers amounts[i] tokens from the client account to recipients[i] for every i in a single transaction
+// Either every transfer succeeds or none of them does
+// recipient accounts must be valid clientIDs as returned by the ClientAccountID() function
+// A transaction can only carry one chaincode event, so this function triggers a single BatchTransfer event summarizing all transfers
+func (s *SmartContract) BatchTransfer(ctx contractapi.TransactionContextInterface, recipients []string, amounts []int) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if len(recipients) == 0 {
+		return fmt.Errorf("batch must contain at least one recipient")
+	}
+	if len(recipients) != len(amounts) {
+		return fmt.Errorf("number of recipients %d does not match number of amounts %d", len(recipients), len(amounts))
+	}
+
+	maxBatchSize, err := maxBatchSizeHelper(ctx)
+	if err != nil {
+		return err
+	}
+	if len(recipients) > maxBatchSize {
+		return fmt.Errorf("batch of %d recipients exceeds the maximum batch size of %d", len(recipients), maxBatchSize)
+	}
+
+	// Validate every leg and compute the total before touching any balance
+	total := 0
+	seen := make(map[string]bool)
+	for i, recipient := range recipients {
+		if seen[recipient] {
+			return fmt.Errorf("recipient %s appears more than once in the batch", recipient)
+		}
+		seen[recipient] = true
+
+		err = validateTransfer(ctx, clientID, recipient, amounts[i])
+		if err != nil {
+			return fmt.Errorf("failed to transfer to recipient %s: %w", recipient, err)
+		}
+
+		total, err = add(total, amounts[i])
+		if err != nil {
+			return fmt.Errorf("failed to compute batch total: %w", err)
+		}
+	}
+
+	err = debitHelper(ctx, clientID, total)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %w", err)
+	}
+
+	for i, recipient := range recipients {
+		err = creditHelper(ctx, recipient, amounts[i])
+		if err != nil {
+			return fmt.Errorf("failed to transfer to recipient %s: %w", recipient, err)
+		}
+	}
+
+	// Emit the BatchTransfer event
+	transferEvent := batchTransferEvent{clientID, recipients, amounts, total}
+	transferEventJSON, err := json.Marshal(transferEvent)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("BatchTransfer", transferEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("client %s transferred %d tokens to %d recipients", clientID, total, len(recipients))
+
+	return nil
+}
+
+// SetMaxBatchSize sets the maximum number of recipients accepted by BatchTransfer
+// Only clients holding the admin role can change the maximum batch size
+func (s *SmartContract) SetMaxBatchSize(ctx contractapi.TransactionContextInterface, size int) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	admin, err := requireRole(ctx, AdminRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to set the maximum batch size: %v", err)
+	}
+
+	if size <= 0 {
+		return fmt.Errorf("maximum batch size must be a positive integer")
+	}
+
+	err = ctx.GetStub().PutState(maxBatchSizeKey, []byte(strconv.Itoa(size)))
+	if err != nil {
+		return fmt.Errorf("failed to set maximum batch size: %v", err)
+	}
+
+	log.Printf("client %s set the maximum batch size to %d", admin, size)
+
+	return nil
+}
+
+// MaxBatchSize returns the maximum number of recipients accepted by BatchTransfer
+func (s *SmartContract) MaxBatchSize(ctx contractapi.TransactionContextInterface) (int, error) {
+	return maxBatchSizeHelper(ctx)
+}
+
+// Helper Functions
+
+// maxBatchSizeHelper reads the maximum batch size from the world state, falling back to the default
+func maxBatchSizeHelper(ctx contractapi.TransactionContextInterface) (int, error) {
+	maxBatchSizeBytes, err := ctx.GetStub().GetState(maxBatchSizeKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read maximum batch size from world state: %v", err)
+	}
+	if maxBatchSizeBytes == nil {
+		return defaultMaxBatchSize, nil
+	}
+
+	maxBatchSize, err := strconv.Atoi(string(maxBatchSizeBytes))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse maximum batch size: %v", err)
+	}
+
+	return maxBatchSize, nil
+}
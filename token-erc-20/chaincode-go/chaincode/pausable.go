@@ -0,0 +1,281 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for the pause state
+const pausedKey = "paused"
+
+// Define objectType names for prefix
+const frozenPrefix = "frozen"
+
+// pauseEvent provides an organized struct for emitting Paused and Unpaused events
+type pauseEvent struct {
+	Account string `json:"account"`
+}
+
+// freezeEvent provides an organized struct for emitting AccountFrozen and AccountUnfrozen events
+type freezeEvent struct {
+	Account string `json:"account"`
+	Sender  string `json:"sender"`
+}
+
+// Pause halts all token movements until Unpause is called
+// Only clients holding the pauser role can pause the contract
+// This function triggers a Paused event
+func (s *SmartContract) Pause(ctx contractapi.TransactionContextInterface) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	pauser, err := requireRole(ctx, PauserRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to pause the contract: %v", err)
+	}
+
+	paused, err := isPausedHelper(ctx)
+	if err != nil {
+		return err
+	}
+	if paused {
+		return fmt.Errorf("contract is already paused")
+	}
+
+	err = ctx.GetStub().PutState(pausedKey, []byte("true"))
+	if err != nil {
+		return fmt.Errorf("failed to set pause state: %v", err)
+	}
+
+	// Emit the Paused event
+	err = setPauseEvent(ctx, "Paused", pauser)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("contract paused by %s", pauser)
+
+	return nil
+}
+
+// Unpause resumes token movements after a call to Pause
+// Only clients holding the pauser role can unpause the contract
+// This function triggers an Unpaused event
+func (s *SmartContract) Unpause(ctx contractapi.TransactionContextInterface) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	pauser, err := requireRole(ctx, PauserRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to unpause the contract: %v", err)
+	}
+
+	paused, err := isPausedHelper(ctx)
+	if err != nil {
+		return err
+	}
+	if !paused {
+		return fmt.Errorf("contract is not paused")
+	}
+
+	err = ctx.GetStub().DelState(pausedKey)
+	if err != nil {
+		return fmt.Errorf("failed to clear pause state: %v", err)
+	}
+
+	// Emit the Unpaused event
+	err = setPauseEvent(ctx, "Unpaused", pauser)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("contract unpaused by %s", pauser)
+
+	return nil
+}
+
+// Paused returns true if token movements are currently halted
+func (s *SmartContract) Paused(ctx contractapi.TransactionContextInterface) (bool, error) {
+	return isPausedHelper(ctx)
+}
+
+// FreezeAccount prevents the given account from sending, receiving, minting or burning tokens
+// Only clients holding the admin role can freeze accounts
+// This function triggers an AccountFrozen event
+func (s *SmartContract) FreezeAccount(ctx contractapi.TransactionContextInterface, account string) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	admin, err := requireRole(ctx, AdminRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to freeze accounts: %v", err)
+	}
+
+	frozen, err := isFrozenHelper(ctx, account)
+	if err != nil {
+		return err
+	}
+	if frozen {
+		return fmt.Errorf("account %s is already frozen", account)
+	}
+
+	frozenKey, err := ctx.GetStub().CreateCompositeKey(frozenPrefix, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", frozenPrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(frozenKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to freeze account %s: %v", account, err)
+	}
+
+	// Emit the AccountFrozen event
+	err = setFreezeEvent(ctx, "AccountFrozen", account, admin)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s froze account %s", admin, account)
+
+	return nil
+}
+
+// UnfreezeAccount lifts a freeze previously placed on the given account
+// Only clients holding the admin role can unfreeze accounts
+// This function triggers an AccountUnfrozen event
+func (s *SmartContract) UnfreezeAccount(ctx contractapi.TransactionContextInterface, account string) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	admin, err := requireRole(ctx, AdminRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to unfreeze accounts: %v", err)
+	}
+
+	frozen, err := isFrozenHelper(ctx, account)
+	if err != nil {
+		return err
+	}
+	if !frozen {
+		return fmt.Errorf("account %s is not frozen", account)
+	}
+
+	frozenKey, err := ctx.GetStub().CreateCompositeKey(frozenPrefix, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", frozenPrefix, err)
+	}
+
+	err = ctx.GetStub().DelState(frozenKey)
+	if err != nil {
+		return fmt.Errorf("failed to unfreeze account %s: %v", account, err)
+	}
+
+	// Emit the AccountUnfrozen event
+	err = setFreezeEvent(ctx, "AccountUnfrozen", account, admin)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s unfroze account %s", admin, account)
+
+	return nil
+}
+
+// IsFrozen returns true if the given account is frozen
+func (s *SmartContract) IsFrozen(ctx contractapi.TransactionContextInterface, account string) (bool, error) {
+	return isFrozenHelper(ctx, account)
+}
+
+// Helper Functions
+
+// isPausedHelper reads the pause state from the world state
+func isPausedHelper(ctx contractapi.TransactionContextInterface) (bool, error) {
+	pausedBytes, err := ctx.GetStub().GetState(pausedKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read pause state from world state: %v", err)
+	}
+
+	return pausedBytes != nil, nil
+}
+
+// isFrozenHelper reads the freeze state of the account from the world state
+func isFrozenHelper(ctx contractapi.TransactionContextInterface, account string) (bool, error) {
+	frozenKey, err := ctx.GetStub().CreateCompositeKey(frozenPrefix, []string{account})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", frozenPrefix, err)
+	}
+
+	frozenBytes, err := ctx.GetStub().GetState(frozenKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read freeze state of account %s from world state: %v", account, err)
+	}
+
+	return frozenBytes != nil, nil
+}
+
+// checkTokenMovement returns an error if the contract is paused or if any of the accounts is frozen
+// Dependant functions include Mint, Burn and transferHelper
+func checkTokenMovement(ctx contractapi.TransactionContextInterface, accounts ...string) error {
+	paused, err := isPausedHelper(ctx)
+	if err != nil {
+		return err
+	}
+	if paused {
+		return fmt.Errorf("contract is paused")
+	}
+
+	for _, account := range accounts {
+		frozen, err := isFrozenHelper(ctx, account)
+		if err != nil {
+			return err
+		}
+		if frozen {
+			return fmt.Errorf("account %s is frozen", account)
+		}
+	}
+
+	return nil
+}
+
+// setPauseEvent emits a Paused or Unpaused event for the account that changed the pause state
+func setPauseEvent(ctx contractapi.TransactionContextInterface, name string, account string) error {
+	pauseEventJSON, err := json.Marshal(pauseEvent{account})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, pauseEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// setFreezeEvent emits an AccountFrozen or AccountUnfrozen event
+func setFreezeEvent(ctx contractapi.TransactionContextInterface, name string, account string, sender string) error {
+	freezeEventJSON, err := json.Marshal(freezeEvent{account, sender})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, freezeEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
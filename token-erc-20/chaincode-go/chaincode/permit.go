@@ -0,0 +1,205 @@
+package chaincode
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const certificatePrefix = "certificate"
+const noncePrefix = "nonce"
+
+// ecdsaSignature is the ASN.1 structure of a DER encoded ECDSA signature
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// RegisterCertificate stores the X.509 certificate of the submitting client on the ledger
+// Permits signed by the client are verified against this certificate
+// The certificate must hold an ECDSA public key
+func (s *SmartContract) RegisterCertificate(ctx contractapi.TransactionContextInterface) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	certificate, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return fmt.Errorf("failed to get client certificate: %v", err)
+	}
+	if certificate == nil {
+		return fmt.Errorf("client certificate is not available")
+	}
+	if _, ok := certificate.PublicKey.(*ecdsa.PublicKey); !ok {
+		return fmt.Errorf("client certificate does not hold an ECDSA public key")
+	}
+
+	certificateKey, err := ctx.GetStub().CreateCompositeKey(certificatePrefix, []string{clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", certificatePrefix, err)
+	}
+
+	certificatePEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+	err = ctx.GetStub().PutState(certificateKey, certificatePEM)
+	if err != nil {
+		return fmt.Errorf("failed to register certificate of client %s: %v", clientID, err)
+	}
+
+	log.Printf("client %s registered its certificate", clientID)
+
+	return nil
+}
+
+// Permit sets the allowance of the spender over the owner's tokens using a signature of the owner instead of
+// a transaction submitted by the owner, so that any client can relay the approval
+// The signature is a base64 encoded, DER encoded ECDSA signature over the SHA-256 hash of PermitPayload,
+// made with the key of the certificate the owner registered with RegisterCertificate
+// nonce must equal the current value of Nonces for the owner, and deadline is a Unix time in seconds
+// after which the permit can no longer be used
+// This function triggers an Approval event
+func (s *SmartContract) Permit(ctx contractapi.TransactionContextInterface, owner string, spender string, value int, nonce int, deadline int64, signature string) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Check the permit has not expired, using the transaction timestamp so that all endorsers agree
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now > deadline {
+		return fmt.Errorf("permit expired at %d", deadline)
+	}
+
+	currentNonce, err := noncesHelper(ctx, owner)
+	if err != nil {
+		return err
+	}
+	if nonce != currentNonce {
+		return fmt.Errorf("invalid nonce %d for owner %s, expected %d", nonce, owner, currentNonce)
+	}
+
+	publicKey, err := registeredPublicKey(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("failed to decode signature: %v", err)
+	}
+
+	var sig ecdsaSignature
+	rest, err := asn1.Unmarshal(signatureBytes, &sig)
+	if err != nil || len(rest) != 0 || sig.R == nil || sig.S == nil {
+		return fmt.Errorf("signature is not a DER encoded ECDSA signature")
+	}
+
+	payload := permitPayload(ctx.GetStub().GetChannelID(), owner, spender, value, nonce, deadline)
+	digest := sha256.Sum256([]byte(payload))
+	if !ecdsa.Verify(publicKey, digest[:], sig.R, sig.S) {
+		return fmt.Errorf("invalid signature for owner %s", owner)
+	}
+
+	// Consume the nonce so that the permit cannot be replayed
+	nonceKey, err := ctx.GetStub().CreateCompositeKey(noncePrefix, []string{owner})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", noncePrefix, err)
+	}
+	err = ctx.GetStub().PutState(nonceKey, []byte(strconv.Itoa(currentNonce+1)))
+	if err != nil {
+		return fmt.Errorf("failed to update nonce of owner %s: %v", owner, err)
+	}
+
+	return approveHelper(ctx, owner, spender, value)
+}
+
+// PermitPayload returns the canonical payload that the owner signs to create a permit
+func (s *SmartContract) PermitPayload(ctx contractapi.TransactionContextInterface, owner string, spender string, value int, nonce int, deadline int64) (string, error) {
+	return permitPayload(ctx.GetStub().GetChannelID(), owner, spender, value, nonce, deadline), nil
+}
+
+// Nonces returns the nonce that the next permit of the owner must use
+func (s *SmartContract) Nonces(ctx contractapi.TransactionContextInterface, owner string) (int, error) {
+	return noncesHelper(ctx, owner)
+}
+
+// Helper Functions
+
+// permitPayload builds the canonical payload of a permit
+// The channel ID is included so that a permit cannot be replayed on another channel
+func permitPayload(channelID string, owner string, spender string, value int, nonce int, deadline int64) string {
+	return fmt.Sprintf("Permit\nchannel:%s\nowner:%s\nspender:%s\nvalue:%d\nnonce:%d\ndeadline:%d", channelID, owner, spender, value, nonce, deadline)
+}
+
+// noncesHelper reads the current permit nonce of the owner from the world state
+func noncesHelper(ctx contractapi.TransactionContextInterface, owner string) (int, error) {
+	nonceKey, err := ctx.GetStub().CreateCompositeKey(noncePrefix, []string{owner})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", noncePrefix, err)
+	}
+
+	nonceBytes, err := ctx.GetStub().GetState(nonceKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read nonce of owner %s from world state: %v", owner, err)
+	}
+
+	nonce, err := parseAmount(nonceBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read nonce of owner %s: %w", owner, err)
+	}
+
+	return nonce, nil
+}
+
+// registeredPublicKey returns the ECDSA public key of the certificate registered by the owner
+func registeredPublicKey(ctx contractapi.TransactionContextInterface, owner string) (*ecdsa.PublicKey, error) {
+	certificateKey, err := ctx.GetStub().CreateCompositeKey(certificatePrefix, []string{owner})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the composite key for prefix %s: %v", certificatePrefix, err)
+	}
+
+	certificatePEM, err := ctx.GetStub().GetState(certificateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate of owner %s from world state: %v", owner, err)
+	}
+	if certificatePEM == nil {
+		return nil, fmt.Errorf("owner %s has not registered a certificate", owner)
+	}
+
+	block, _ := pem.Decode(certificatePEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode certificate of owner %s", owner)
+	}
+
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate of owner %s: %v", owner, err)
+	}
+
+	publicKey, ok := certificate.PublicKey.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("certificate of owner %s does not hold an ECDSA public key", owner)
+	}
+
+	return publicKey, nil
+}
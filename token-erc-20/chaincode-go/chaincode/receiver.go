@@ -0,0 +1,67 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// onTokenReceivedFunction is the function TransferAndCall invokes on the receiving chaincode
+const onTokenReceivedFunction = "OnTokenReceived"
+
+// TransferAndCall transfers tokens from the client account to the recipient account, and then notifies the
+// recipient chaincode by invoking its OnTokenReceived(from, to, amount, data) function on the same channel.
+// The recipient account is chosen by the client, for example the client ID of an escrow agent or a seller,
+// and the recipient chaincode can check it before accepting the tokens. The whole transaction fails if the
+// recipient chaincode returns an error, so a receiving contract such as an escrow or auction can reject
+// tokens it does not expect
+// This function triggers a Transfer event
+func (s *SmartContract) TransferAndCall(ctx contractapi.TransactionContextInterface, recipientChaincode string, recipient string, amount int, data string) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if recipientChaincode == "" {
+		return fmt.Errorf("recipient chaincode name must not be empty")
+	}
+
+	err = transferHelper(ctx, clientID, recipient, amount)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %w", err)
+	}
+
+	// Notify the recipient chaincode once the tokens have moved, an empty channel name invokes it on the
+	// current channel
+	args := [][]byte{[]byte(onTokenReceivedFunction), []byte(clientID), []byte(recipient), []byte(strconv.Itoa(amount)), []byte(data)}
+	response := ctx.GetStub().InvokeChaincode(recipientChaincode, args, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("recipient chaincode %s rejected the tokens: %s", recipientChaincode, response.Message)
+	}
+
+	// Emit the Transfer event
+	transferEvent := event{clientID, recipient, amount}
+	transferEventJSON, err := json.Marshal(transferEvent)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Transfer", transferEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("client %s transferred %d tokens to account %s of chaincode %s", clientID, amount, recipient, recipientChaincode)
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define role names stored in the role registry
+const (
+	AdminRole  = "admin"
+	MinterRole = "minter"
+	BurnerRole = "burner"
+	PauserRole = "pauser"
+)
+
+// roleEvent provides an organized struct for emitting role change events
+type roleEvent struct {
+	Role    string `json:"role"`
+	Account string `json:"account"`
+	Sender  string `json:"sender"`
+}
+
+// GrantRole grants a role to the given account
+// Only clients holding the admin role can grant roles
+// This function triggers a RoleGranted event
+func (s *SmartContract) GrantRole(ctx contractapi.TransactionContextInterface, role string, account string) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	admin, err := requireRole(ctx, AdminRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to grant roles: %v", err)
+	}
+
+	hasRole, err := hasRoleHelper(ctx, role, account)
+	if err != nil {
+		return err
+	}
+	if hasRole {
+		return fmt.Errorf("account %s already has role %s", account, role)
+	}
+
+	return grantRoleHelper(ctx, role, account, admin)
+}
+
+// RevokeRole revokes a role from the given account
+// Only clients holding the admin role can revoke roles
+// This function triggers a RoleRevoked event
+func (s *SmartContract) RevokeRole(ctx contractapi.TransactionContextInterface, role string, account string) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	admin, err := requireRole(ctx, AdminRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to revoke roles: %v", err)
+	}
+
+	hasRole, err := hasRoleHelper(ctx, role, account)
+	if err != nil {
+		return err
+	}
+	if !hasRole {
+		return fmt.Errorf("account %s does not have role %s", account, role)
+	}
+
+	roleKey, err := ctx.GetStub().CreateCompositeKey(rolePrefix, []string{role, account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", rolePrefix, err)
+	}
+
+	err = ctx.GetStub().DelState(roleKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete role %s for account %s: %v", role, account, err)
+	}
+
+	// Emit the RoleRevoked event
+	revokedEvent := roleEvent{role, account, admin}
+	revokedEventJSON, err := json.Marshal(revokedEvent)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("RoleRevoked", revokedEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("client %s revoked role %s from account %s", admin, role, account)
+
+	return nil
+}
+
+// HasRole returns true if the given account holds the role
+func (s *SmartContract) HasRole(ctx contractapi.TransactionContextInterface, role string, account string) (bool, error) {
+	return hasRoleHelper(ctx, role, account)
+}
+
+// Helper Functions
+
+// requireRole checks that the submitting client holds the role and returns its client ID
+func requireRole(ctx contractapi.TransactionContextInterface, role string) (string, error) {
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	hasRole, err := hasRoleHelper(ctx, role, clientID)
+	if err != nil {
+		return "", err
+	}
+	if !hasRole {
+		return "", fmt.Errorf("client %s does not have role %s", clientID, role)
+	}
+
+	return clientID, nil
+}
+
+// hasRoleHelper reads the role registry entry for the account
+func hasRoleHelper(ctx contractapi.TransactionContextInterface, role string, account string) (bool, error) {
+
+	err := validateRole(role)
+	if err != nil {
+		return false, err
+	}
+
+	roleKey, err := ctx.GetStub().CreateCompositeKey(rolePrefix, []string{role, account})
+	if err != nil {
+		return false, fmt.Errorf("failed to create the composite key for prefix %s: %v", rolePrefix, err)
+	}
+
+	roleBytes, err := ctx.GetStub().GetState(roleKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to read role %s for account %s from world state: %v", role, account, err)
+	}
+
+	return roleBytes != nil, nil
+}
+
+// grantRoleHelper writes the role registry entry for the account and emits a RoleGranted event
+func grantRoleHelper(ctx contractapi.TransactionContextInterface, role string, account string, sender string) error {
+
+	err := validateRole(role)
+	if err != nil {
+		return err
+	}
+
+	roleKey, err := ctx.GetStub().CreateCompositeKey(rolePrefix, []string{role, account})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", rolePrefix, err)
+	}
+
+	err = ctx.GetStub().PutState(roleKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to grant role %s to account %s: %v", role, account, err)
+	}
+
+	// Emit the RoleGranted event
+	grantedEvent := roleEvent{role, account, sender}
+	grantedEventJSON, err := json.Marshal(grantedEvent)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("RoleGranted", grantedEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("client %s granted role %s to account %s", sender, role, account)
+
+	return nil
+}
+
+// validateRole checks that the role is one of the roles known to the registry
+func validateRole(role string) error {
+	switch role {
+	case AdminRole, MinterRole, BurnerRole, PauserRole:
+		return nil
+	default:
+		return fmt.Errorf("unknown role %s", role)
+	}
+}
@@ -0,0 +1,60 @@
+package chaincode
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// maxInt is the largest value an int can hold on the platform running the chaincode
+const maxInt = int(^uint(0) >> 1)
+
+// Errors returned by the checked arithmetic helpers
+// Callers can match them with errors.Is to tell arithmetic failures apart from ledger failures
+var (
+	// ErrOverflow is returned when an addition would exceed the largest representable amount
+	ErrOverflow = errors.New("arithmetic overflow")
+	// ErrUnderflow is returned when a subtraction would result in a negative amount
+	ErrUnderflow = errors.New("arithmetic underflow")
+	// ErrCorruptAmount is returned when an amount stored in the world state is not a non-negative integer
+	ErrCorruptAmount = errors.New("corrupt amount")
+)
+
+// add returns a + b for non-negative amounts, or ErrOverflow if the sum does not fit in an int
+func add(a int, b int) (int, error) {
+	if a < 0 || b < 0 {
+		return 0, fmt.Errorf("cannot add negative amounts %d and %d", a, b)
+	}
+	if a > maxInt-b {
+		return 0, fmt.Errorf("%w: %d + %d", ErrOverflow, a, b)
+	}
+
+	return a + b, nil
+}
+
+// sub returns a - b for non-negative amounts, or ErrUnderflow if the difference would be negative
+func sub(a int, b int) (int, error) {
+	if a < 0 || b < 0 {
+		return 0, fmt.Errorf("cannot subtract negative amounts %d and %d", a, b)
+	}
+	if b > a {
+		return 0, fmt.Errorf("%w: %d - %d", ErrUnderflow, a, b)
+	}
+
+	return a - b, nil
+}
+
+// parseAmount converts the bytes of a balance, allowance or totalSupply read from the world state into an int
+// A missing value is treated as zero, while anything that is not a non-negative integer returns ErrCorruptAmount
+func parseAmount(amountBytes []byte) (int, error) {
+	if amountBytes == nil {
+		return 0, nil
+	}
+
+	amount, err := strconv.Atoi(string(amountBytes))
+	if err != nil || amount < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrCorruptAmount, amountBytes)
+	}
+
+	return amount, nil
+}
@@ -0,0 +1,104 @@
+package chaincode
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    int
+		want    int
+		wantErr error
+	}{
+		{"zero", 0, 0, 0, nil},
+		{"small", 2, 3, 5, nil},
+		{"max plus zero", maxInt, 0, maxInt, nil},
+		{"zero plus max", 0, maxInt, maxInt, nil},
+		{"just fits", maxInt - 1, 1, maxInt, nil},
+		{"overflow by one", maxInt, 1, 0, ErrOverflow},
+		{"overflow both large", maxInt/2 + 1, maxInt/2 + 1, 0, ErrOverflow},
+		{"max plus max", maxInt, maxInt, 0, ErrOverflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := add(tt.a, tt.b)
+			if tt.wantErr != nil {
+				require.True(t, errors.Is(err, tt.wantErr), "expected %v, got %v", tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := add(-1, 1)
+	require.EqualError(t, err, "cannot add negative amounts -1 and 1")
+}
+
+func TestSub(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    int
+		want    int
+		wantErr error
+	}{
+		{"zero", 0, 0, 0, nil},
+		{"small", 5, 3, 2, nil},
+		{"to zero", 7, 7, 0, nil},
+		{"max minus max", maxInt, maxInt, 0, nil},
+		{"max minus zero", maxInt, 0, maxInt, nil},
+		{"underflow by one", 0, 1, 0, ErrUnderflow},
+		{"underflow large", 1, maxInt, 0, ErrUnderflow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sub(tt.a, tt.b)
+			if tt.wantErr != nil {
+				require.True(t, errors.Is(err, tt.wantErr), "expected %v, got %v", tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := sub(1, -1)
+	require.EqualError(t, err, "cannot subtract negative amounts 1 and -1")
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		bytes   []byte
+		want    int
+		wantErr error
+	}{
+		{"missing", nil, 0, nil},
+		{"zero", []byte("0"), 0, nil},
+		{"positive", []byte("1000"), 1000, nil},
+		{"max", []byte(strconv.Itoa(maxInt)), maxInt, nil},
+		{"empty", []byte{}, 0, ErrCorruptAmount},
+		{"not a number", []byte("abc"), 0, ErrCorruptAmount},
+		{"negative", []byte("-5"), 0, ErrCorruptAmount},
+		{"beyond max", []byte(strconv.Itoa(maxInt) + "0"), 0, ErrCorruptAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAmount(tt.bytes)
+			if tt.wantErr != nil {
+				require.True(t, errors.Is(err, tt.wantErr), "expected %v, got %v", tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
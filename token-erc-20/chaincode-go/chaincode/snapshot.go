@@ -0,0 +1,233 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const snapshotPrefix = "snapshot"
+const snapshotBalancePrefix = "snapshotBalance"
+
+// Holder describes the balance of a single token holder
+type Holder struct {
+	Account string `json:"account"`
+	Balance int    `json:"balance"`
+}
+
+// HoldersQueryResult structure used for returning paginated holder listings and metadata
+type HoldersQueryResult struct {
+	Holders             []*Holder `json:"holders"`
+	FetchedRecordsCount int32     `json:"fetchedRecordsCount"`
+	Bookmark            string    `json:"bookmark"`
+}
+
+// snapshotEvent provides an organized struct for emitting Snapshot events
+type snapshotEvent struct {
+	ID      string `json:"id"`
+	Holders int    `json:"holders"`
+}
+
+// GetHolders returns a page of token holders and their balances
+// Pass an empty bookmark to get the first page, and the returned bookmark to get the next one
+// Paginated queries are only valid for read only transactions
+func (s *SmartContract) GetHolders(ctx contractapi.TransactionContextInterface, pageSize int, bookmark string) (*HoldersQueryResult, error) {
+
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be a positive integer")
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(balancePrefix, []string{}, int32(pageSize), bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get holders from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	holders := []*Holder{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		holder, err := parseHolder(ctx, queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return nil, err
+		}
+		holders = append(holders, holder)
+	}
+
+	return &HoldersQueryResult{
+		Holders:             holders,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// MigrateBalance moves the balance of an account stored under the raw account id by earlier
+// versions of the contract to the balance composite key, so the account is listed by GetHolders and Snapshot
+// Legacy balances are also moved when the account is next debited or credited
+func (s *SmartContract) MigrateBalance(ctx contractapi.TransactionContextInterface, account string) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	balanceKey, balanceBytes, legacy, err := readBalance(ctx, account)
+	if err != nil {
+		return fmt.Errorf("failed to read account %s from world state: %v", account, err)
+	}
+	if !legacy {
+		return fmt.Errorf("the account %s has no legacy balance", account)
+	}
+
+	balance, err := parseAmount(balanceBytes)
+	if err != nil {
+		return fmt.Errorf("failed to read balance of account %s: %w", account, err)
+	}
+
+	return putBalance(ctx, account, balanceKey, legacy, balance)
+}
+
+// Snapshot records the balance of every holder under the given snapshot id
+// The recorded balances can later be read with BalanceOfAt, for example to compute dividends or voting power
+// Only clients holding the admin role can take snapshots
+// This function triggers a Snapshot event
+func (s *SmartContract) Snapshot(ctx contractapi.TransactionContextInterface, id string) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	admin, err := requireRole(ctx, AdminRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to take snapshots: %v", err)
+	}
+
+	if id == "" {
+		return fmt.Errorf("snapshot id must not be empty")
+	}
+
+	snapshotKey, err := ctx.GetStub().CreateCompositeKey(snapshotPrefix, []string{id})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", snapshotPrefix, err)
+	}
+
+	snapshotBytes, err := ctx.GetStub().GetState(snapshotKey)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot %s from world state: %v", id, err)
+	}
+	if snapshotBytes != nil {
+		return fmt.Errorf("snapshot %s already exists", id)
+	}
+
+	// Paginated queries are not allowed in update transactions, so walk the full balance range
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(balancePrefix, []string{})
+	if err != nil {
+		return fmt.Errorf("failed to get holders from world state: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	holderCount := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		holder, err := parseHolder(ctx, queryResponse.Key, queryResponse.Value)
+		if err != nil {
+			return err
+		}
+
+		snapshotBalanceKey, err := ctx.GetStub().CreateCompositeKey(snapshotBalancePrefix, []string{id, holder.Account})
+		if err != nil {
+			return fmt.Errorf("failed to create the composite key for prefix %s: %v", snapshotBalancePrefix, err)
+		}
+
+		err = ctx.GetStub().PutState(snapshotBalanceKey, queryResponse.Value)
+		if err != nil {
+			return fmt.Errorf("failed to record balance of account %s in snapshot %s: %v", holder.Account, id, err)
+		}
+		holderCount++
+	}
+
+	err = ctx.GetStub().PutState(snapshotKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to record snapshot %s: %v", id, err)
+	}
+
+	// Emit the Snapshot event
+	snapshotEventJSON, err := json.Marshal(snapshotEvent{id, holderCount})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Snapshot", snapshotEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("client %s recorded snapshot %s of %d holders", admin, id, holderCount)
+
+	return nil
+}
+
+// BalanceOfAt returns the balance of the given account when the snapshot was taken
+// Accounts that did not hold tokens at that time have a balance of 0
+func (s *SmartContract) BalanceOfAt(ctx contractapi.TransactionContextInterface, account string, snapshotID string) (int, error) {
+
+	snapshotKey, err := ctx.GetStub().CreateCompositeKey(snapshotPrefix, []string{snapshotID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", snapshotPrefix, err)
+	}
+
+	snapshotBytes, err := ctx.GetStub().GetState(snapshotKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read snapshot %s from world state: %v", snapshotID, err)
+	}
+	if snapshotBytes == nil {
+		return 0, fmt.Errorf("the snapshot %s does not exist", snapshotID)
+	}
+
+	snapshotBalanceKey, err := ctx.GetStub().CreateCompositeKey(snapshotBalancePrefix, []string{snapshotID, account})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create the composite key for prefix %s: %v", snapshotBalancePrefix, err)
+	}
+
+	balanceBytes, err := ctx.GetStub().GetState(snapshotBalanceKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read balance of account %s in snapshot %s: %v", account, snapshotID, err)
+	}
+
+	balance, err := parseAmount(balanceBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read balance of account %s in snapshot %s: %w", account, snapshotID, err)
+	}
+
+	return balance, nil
+}
+
+// Helper Functions
+
+// parseHolder converts a balance key and value read from the world state into a Holder
+func parseHolder(ctx contractapi.TransactionContextInterface, balanceKey string, balanceBytes []byte) (*Holder, error) {
+	_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(balanceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to split the composite key %s: %v", balanceKey, err)
+	}
+	if len(compositeKeyParts) != 1 {
+		return nil, fmt.Errorf("balance key %s is malformed", balanceKey)
+	}
+
+	balance, err := parseAmount(balanceBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read balance of account %s: %w", compositeKeyParts[0], err)
+	}
+
+	return &Holder{Account: compositeKeyParts[0], Balance: balance}, nil
+}
@@ -11,10 +11,19 @@ import (
 )
 
 // Define key names for options
+const nameKey = "name"
+const symbolKey = "symbol"
+const decimalsKey = "decimals"
 const totalSupplyKey = "totalSupply"
 
 // Define objectType names for prefix
 const allowancePrefix = "allowance"
+const balancePrefix = "balance"
+const rolePrefix = "role"
+
+// adminMSPID is the organization whose clients may initialize the contract
+// All further authorization is managed through the on-ledger role registry
+const adminMSPID = "Org1MSP"
 
 // SmartContract provides functions for transferring tokens between accounts
 type SmartContract struct {
@@ -28,46 +37,110 @@ type event struct {
 	Value int    `json:"value"`
 }
 
-// Mint creates new tokens and adds them to minter's account balance
-// This function triggers a Transfer event
-func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount int) error {
+// Initialize sets the token name, symbol and decimals and grants the admin role to the submitting client
+// It can only be called once, by a client of the admin organization
+// The initial admin then uses GrantRole to appoint minters, burners and pausers
+// This function triggers a RoleGranted event
+func (s *SmartContract) Initialize(ctx contractapi.TransactionContextInterface, name string, symbol string, decimals int) error {
 
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
+	// Check initializer authorization - this sample assumes Org1 is the central banker that bootstraps the contract
 	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
 	if err != nil {
 		return fmt.Errorf("failed to get MSPID: %v", err)
 	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to mint new tokens")
+	if clientMSPID != adminMSPID {
+		return fmt.Errorf("client is not authorized to initialize the contract")
+	}
+
+	// Check contract options are not already set, client is not authorized to change them once initialized
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return err
+	}
+	if initialized {
+		return fmt.Errorf("contract has already been initialized")
+	}
+
+	if name == "" || symbol == "" {
+		return fmt.Errorf("token name and symbol must not be empty")
+	}
+	if decimals < 0 {
+		return fmt.Errorf("decimals cannot be negative")
 	}
 
 	// Get ID of submitting client identity
-	minter, err := ctx.GetClientIdentity().GetID()
+	admin, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
 		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
+	err = ctx.GetStub().PutState(nameKey, []byte(name))
+	if err != nil {
+		return fmt.Errorf("failed to set token name: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(symbolKey, []byte(symbol))
+	if err != nil {
+		return fmt.Errorf("failed to set symbol: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(decimalsKey, []byte(strconv.Itoa(decimals)))
+	if err != nil {
+		return fmt.Errorf("failed to set decimals: %v", err)
+	}
+
+	err = grantRoleHelper(ctx, AdminRole, admin, admin)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("contract initialized as %s (%s) with %d decimals and admin %s", name, symbol, decimals, admin)
+
+	return nil
+}
+
+// Mint creates new tokens and adds them to minter's account balance
+// This function triggers a Transfer event
+func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount int) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Check minter authorization - only clients holding the minter role can mint new tokens
+	minter, err := requireRole(ctx, MinterRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to mint new tokens: %v", err)
+	}
+
 	if amount <= 0 {
 		return fmt.Errorf("mint amount must be a positive integer")
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(minter)
+	// Check minting is not halted by a pause or an account freeze
+	err = checkTokenMovement(ctx, minter)
 	if err != nil {
-		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+		return fmt.Errorf("failed to mint: %v", err)
 	}
 
-	var currentBalance int
+	minterKey, currentBalanceBytes, legacy, err := readBalance(ctx, minter)
+	if err != nil {
+		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+	}
 
 	// If minter current balance doesn't yet exist, we'll create it with a current balance of 0
-	if currentBalanceBytes == nil {
-		currentBalance = 0
-	} else {
-		currentBalance, _ = strconv.Atoi(string(currentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	currentBalance, err := parseAmount(currentBalanceBytes)
+	if err != nil {
+		return fmt.Errorf("failed to read minter account %s balance: %w", minter, err)
 	}
 
-	updatedBalance := currentBalance + amount
+	updatedBalance, err := add(currentBalance, amount)
+	if err != nil {
+		return fmt.Errorf("failed to update minter account %s balance: %w", minter, err)
+	}
 
-	err = ctx.GetStub().PutState(minter, []byte(strconv.Itoa(updatedBalance)))
+	err = putBalance(ctx, minter, minterKey, legacy, updatedBalance)
 	if err != nil {
 		return err
 	}
@@ -78,17 +151,17 @@ func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount
 		return fmt.Errorf("failed to retrieve total token supply: %v", err)
 	}
 
-	var totalSupply int
-
 	// If no tokens have been minted, initialize the totalSupply
-	if totalSupplyBytes == nil {
-		totalSupply = 0
-	} else {
-		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	totalSupply, err := parseAmount(totalSupplyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to read total token supply: %w", err)
 	}
 
 	// Add the mint amount to the total supply and update the state
-	totalSupply += amount
+	totalSupply, err = add(totalSupply, amount)
+	if err != nil {
+		return fmt.Errorf("failed to update total token supply: %w", err)
+	}
 	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
 	if err != nil {
 		return err
@@ -114,42 +187,48 @@ func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount
 // This function triggers a Transfer event
 func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount int) error {
 
-	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to burn new tokens
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	err := requireInitialized(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get MSPID: %v", err)
-	}
-	if clientMSPID != "Org1MSP" {
-		return fmt.Errorf("client is not authorized to mint new tokens")
+		return err
 	}
 
-	// Get ID of submitting client identity
-	minter, err := ctx.GetClientIdentity().GetID()
+	// Check burner authorization - only clients holding the burner role can burn tokens
+	minter, err := requireRole(ctx, BurnerRole)
 	if err != nil {
-		return fmt.Errorf("failed to get client id: %v", err)
+		return fmt.Errorf("client is not authorized to burn tokens: %v", err)
 	}
 
 	if amount <= 0 {
 		return errors.New("burn amount must be a positive integer")
 	}
 
-	currentBalanceBytes, err := ctx.GetStub().GetState(minter)
+	// Check burning is not halted by a pause or an account freeze
+	err = checkTokenMovement(ctx, minter)
 	if err != nil {
-		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+		return fmt.Errorf("failed to burn: %v", err)
 	}
 
-	var currentBalance int
+	minterKey, currentBalanceBytes, legacy, err := readBalance(ctx, minter)
+	if err != nil {
+		return fmt.Errorf("failed to read minter account %s from world state: %v", minter, err)
+	}
 
 	// Check if minter current balance exists
 	if currentBalanceBytes == nil {
 		return errors.New("The balance does not exist")
 	}
 
-	currentBalance, _ = strconv.Atoi(string(currentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	currentBalance, err := parseAmount(currentBalanceBytes)
+	if err != nil {
+		return fmt.Errorf("failed to read minter account %s balance: %w", minter, err)
+	}
 
-	updatedBalance := currentBalance - amount
+	updatedBalance, err := sub(currentBalance, amount)
+	if err != nil {
+		return fmt.Errorf("failed to update minter account %s balance: %w", minter, err)
+	}
 
-	err = ctx.GetStub().PutState(minter, []byte(strconv.Itoa(updatedBalance)))
+	err = putBalance(ctx, minter, minterKey, legacy, updatedBalance)
 	if err != nil {
 		return err
 	}
@@ -165,10 +244,16 @@ func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount
 		return errors.New("totalSupply does not exist")
 	}
 
-	totalSupply, _ := strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	totalSupply, err := parseAmount(totalSupplyBytes)
+	if err != nil {
+		return fmt.Errorf("failed to read total token supply: %w", err)
+	}
 
 	// Subtract the burn amount to the total supply and update the state
-	totalSupply -= amount
+	totalSupply, err = sub(totalSupply, amount)
+	if err != nil {
+		return fmt.Errorf("failed to update total token supply: %w", err)
+	}
 	err = ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(totalSupply)))
 	if err != nil {
 		return err
@@ -195,6 +280,11 @@ func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, amount
 // This function triggers a Transfer event
 func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, amount int) error {
 
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Get ID of submitting client identity
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
@@ -203,7 +293,7 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, re
 
 	err = transferHelper(ctx, clientID, recipient, amount)
 	if err != nil {
-		return fmt.Errorf("failed to transfer: %v", err)
+		return fmt.Errorf("failed to transfer: %w", err)
 	}
 
 	// Emit the Transfer event
@@ -222,7 +312,7 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, re
 
 // BalanceOf returns the balance of the given account
 func (s *SmartContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (int, error) {
-	balanceBytes, err := ctx.GetStub().GetState(account)
+	_, balanceBytes, _, err := readBalance(ctx, account)
 	if err != nil {
 		return 0, fmt.Errorf("failed to read from world state: %v", err)
 	}
@@ -230,7 +320,10 @@ func (s *SmartContract) BalanceOf(ctx contractapi.TransactionContextInterface, a
 		return 0, fmt.Errorf("the account %s does not exist", account)
 	}
 
-	balance, _ := strconv.Atoi(string(balanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	balance, err := parseAmount(balanceBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read balance of account %s: %w", account, err)
+	}
 
 	return balance, nil
 }
@@ -244,7 +337,7 @@ func (s *SmartContract) ClientAccountBalance(ctx contractapi.TransactionContextI
 		return 0, fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	balanceBytes, err := ctx.GetStub().GetState(clientID)
+	_, balanceBytes, _, err := readBalance(ctx, clientID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to read from world state: %v", err)
 	}
@@ -252,7 +345,10 @@ func (s *SmartContract) ClientAccountBalance(ctx contractapi.TransactionContextI
 		return 0, fmt.Errorf("the account %s does not exist", clientID)
 	}
 
-	balance, _ := strconv.Atoi(string(balanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	balance, err := parseAmount(balanceBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read balance of account %s: %w", clientID, err)
+	}
 
 	return balance, nil
 }
@@ -280,13 +376,10 @@ func (s *SmartContract) TotalSupply(ctx contractapi.TransactionContextInterface)
 		return 0, fmt.Errorf("failed to retrieve total token supply: %v", err)
 	}
 
-	var totalSupply int
-
 	// If no tokens have been minted, return 0
-	if totalSupplyBytes == nil {
-		totalSupply = 0
-	} else {
-		totalSupply, _ = strconv.Atoi(string(totalSupplyBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	totalSupply, err := parseAmount(totalSupplyBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read total token supply: %w", err)
 	}
 
 	log.Printf("TotalSupply: %d tokens", totalSupply)
@@ -299,38 +392,18 @@ func (s *SmartContract) TotalSupply(ctx contractapi.TransactionContextInterface)
 // This function triggers an Approval event
 func (s *SmartContract) Approve(ctx contractapi.TransactionContextInterface, spender string, value int) error {
 
-	// Get ID of submitting client identity
-	owner, err := ctx.GetClientIdentity().GetID()
-	if err != nil {
-		return fmt.Errorf("failed to get client id: %v", err)
-	}
-
-	// Create allowanceKey
-	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
-	if err != nil {
-		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
-	}
-
-	// Update the state of the smart contract by adding the allowanceKey and value
-	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(value)))
+	err := requireInitialized(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to update state of smart contract for key %s: %v", allowanceKey, err)
+		return err
 	}
 
-	// Emit the Approval event
-	approvalEvent := event{owner, spender, value}
-	approvalEventJSON, err := json.Marshal(approvalEvent)
-	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
-	}
-	err = ctx.GetStub().SetEvent("Approval", approvalEventJSON)
+	// Get ID of submitting client identity
+	owner, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
+		return fmt.Errorf("failed to get client id: %v", err)
 	}
 
-	log.Printf("client %s approved a withdrawal allowance of %d for spender %s", owner, value, spender)
-
-	return nil
+	return approveHelper(ctx, owner, spender, value)
 }
 
 // Allowance returns the amount still available for the spender to withdraw from the owner
@@ -348,13 +421,10 @@ func (s *SmartContract) Allowance(ctx contractapi.TransactionContextInterface, o
 		return 0, fmt.Errorf("failed to read allowance for %s from world state: %v", allowanceKey, err)
 	}
 
-	var allowance int
-
 	// If no current allowance, set allowance to 0
-	if allowanceBytes == nil {
-		allowance = 0
-	} else {
-		allowance, err = strconv.Atoi(string(allowanceBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	allowance, err := parseAmount(allowanceBytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read allowance for %s: %w", allowanceKey, err)
 	}
 
 	log.Printf("The allowance left for spender %s to withdraw from owner %s: %d", spender, owner, allowance)
@@ -366,6 +436,11 @@ func (s *SmartContract) Allowance(ctx contractapi.TransactionContextInterface, o
 // This function triggers a Transfer event
 func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
 
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
 	// Get ID of submitting client identity
 	spender, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
@@ -378,14 +453,22 @@ func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
 	}
 
+	// Check the spender is not frozen, the owner and recipient are checked by transferHelper
+	err = checkTokenMovement(ctx, spender)
+	if err != nil {
+		return fmt.Errorf("failed to transfer: %v", err)
+	}
+
 	// Retrieve the allowance of the spender
 	currentAllowanceBytes, err := ctx.GetStub().GetState(allowanceKey)
 	if err != nil {
 		return fmt.Errorf("failed to retrieve the allowance for %s from world state: %v", allowanceKey, err)
 	}
 
-	var currentAllowance int
-	currentAllowance, _ = strconv.Atoi(string(currentAllowanceBytes)) // Error handling not needed since Itoa() was used when setting the totalSupply, guaranteeing it was an integer.
+	currentAllowance, err := parseAmount(currentAllowanceBytes)
+	if err != nil {
+		return fmt.Errorf("failed to read the allowance for %s: %w", allowanceKey, err)
+	}
 
 	// Check if transferred value is less than allowance
 	if currentAllowance < value {
@@ -395,11 +478,14 @@ func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface
 	// Initiate the transfer
 	err = transferHelper(ctx, from, to, value)
 	if err != nil {
-		return fmt.Errorf("failed to transfer: %v", err)
+		return fmt.Errorf("failed to transfer: %w", err)
 	}
 
 	// Decrease the allowance
-	updatedAllowance := currentAllowance - value
+	updatedAllowance, err := sub(currentAllowance, value)
+	if err != nil {
+		return fmt.Errorf("failed to decrease the allowance for %s: %w", allowanceKey, err)
+	}
 	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(updatedAllowance)))
 	if err != nil {
 		return err
@@ -421,12 +507,107 @@ func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface
 	return nil
 }
 
+// Name returns a descriptive name for fungible tokens in this contract
+func (s *SmartContract) Name(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	bytes, err := ctx.GetStub().GetState(nameKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Name bytes: %v", err)
+	}
+
+	return string(bytes), nil
+}
+
+// Symbol returns an abbreviated name for fungible tokens in this contract
+func (s *SmartContract) Symbol(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	bytes, err := ctx.GetStub().GetState(symbolKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get Symbol bytes: %v", err)
+	}
+
+	return string(bytes), nil
+}
+
+// Decimals returns the number of decimals used to get its user representation
+// For example, if decimals equals 2, a balance of 505 tokens should be displayed to a user as 5.05
+func (s *SmartContract) Decimals(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	bytes, err := ctx.GetStub().GetState(decimalsKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get Decimals bytes: %v", err)
+	}
+	if bytes == nil {
+		return 0, nil
+	}
+
+	decimals, err := strconv.Atoi(string(bytes))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse decimals: %v", err)
+	}
+
+	return decimals, nil
+}
+
 // Helper Functions
 
 // transferHelper is a helper function that transfers tokens from the "from" address to the "to" address
 // Dependant functions include Transfer and TransferFrom
 func transferHelper(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
 
+	err := validateTransfer(ctx, from, to, value)
+	if err != nil {
+		return err
+	}
+
+	err = debitHelper(ctx, from, value)
+	if err != nil {
+		return err
+	}
+
+	return creditHelper(ctx, to, value)
+}
+
+// approveHelper is a helper function that sets the allowance of the spender over the owner's tokens
+// Dependant functions include Approve and Permit
+func approveHelper(ctx contractapi.TransactionContextInterface, owner string, spender string, value int) error {
+
+	if value < 0 {
+		return fmt.Errorf("allowance value cannot be negative")
+	}
+
+	// Create allowanceKey
+	allowanceKey, err := ctx.GetStub().CreateCompositeKey(allowancePrefix, []string{owner, spender})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", allowancePrefix, err)
+	}
+
+	// Update the state of the smart contract by adding the allowanceKey and value
+	err = ctx.GetStub().PutState(allowanceKey, []byte(strconv.Itoa(value)))
+	if err != nil {
+		return fmt.Errorf("failed to update state of smart contract for key %s: %v", allowanceKey, err)
+	}
+
+	// Emit the Approval event
+	approvalEvent := event{owner, spender, value}
+	approvalEventJSON, err := json.Marshal(approvalEvent)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent("Approval", approvalEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	log.Printf("client %s approved a withdrawal allowance of %d for spender %s", owner, value, spender)
+
+	return nil
+}
+
+// validateTransfer checks that value can be moved from the "from" address to the "to" address
+// Dependant functions include transferHelper and BatchTransfer
+func validateTransfer(ctx contractapi.TransactionContextInterface, from string, to string, value int) error {
+
 	if from == to {
 		return fmt.Errorf("cannot transfer to and from same client account")
 	}
@@ -435,7 +616,15 @@ func transferHelper(ctx contractapi.TransactionContextInterface, from string, to
 		return fmt.Errorf("transfer amount cannot be negative")
 	}
 
-	fromCurrentBalanceBytes, err := ctx.GetStub().GetState(from)
+	return checkTokenMovement(ctx, from, to)
+}
+
+// debitHelper subtracts value from the balance of the "from" address
+// A key can only be read once per transaction since reads do not see the transaction's own writes,
+// so callers moving tokens out of one account to several recipients debit the total in a single call
+func debitHelper(ctx contractapi.TransactionContextInterface, from string, value int) error {
+
+	fromKey, fromCurrentBalanceBytes, legacy, err := readBalance(ctx, from)
 	if err != nil {
 		return fmt.Errorf("failed to read client account %s from world state: %v", from, err)
 	}
@@ -444,40 +633,124 @@ func transferHelper(ctx contractapi.TransactionContextInterface, from string, to
 		return fmt.Errorf("client account %s has no balance", from)
 	}
 
-	fromCurrentBalance, _ := strconv.Atoi(string(fromCurrentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	fromCurrentBalance, err := parseAmount(fromCurrentBalanceBytes)
+	if err != nil {
+		return fmt.Errorf("failed to read client account %s balance: %w", from, err)
+	}
 
 	if fromCurrentBalance < value {
 		return fmt.Errorf("client account %s has insufficient funds", from)
 	}
 
-	toCurrentBalanceBytes, err := ctx.GetStub().GetState(to)
+	fromUpdatedBalance, err := sub(fromCurrentBalance, value)
+	if err != nil {
+		return fmt.Errorf("failed to debit client account %s: %w", from, err)
+	}
+
+	err = putBalance(ctx, from, fromKey, legacy, fromUpdatedBalance)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s balance updated from %d to %d", from, fromCurrentBalance, fromUpdatedBalance)
+
+	return nil
+}
+
+// creditHelper adds value to the balance of the "to" address
+func creditHelper(ctx contractapi.TransactionContextInterface, to string, value int) error {
+
+	toKey, toCurrentBalanceBytes, legacy, err := readBalance(ctx, to)
 	if err != nil {
 		return fmt.Errorf("failed to read recipient account %s from world state: %v", to, err)
 	}
 
-	var toCurrentBalance int
 	// If recipient current balance doesn't yet exist, we'll create it with a current balance of 0
-	if toCurrentBalanceBytes == nil {
-		toCurrentBalance = 0
-	} else {
-		toCurrentBalance, _ = strconv.Atoi(string(toCurrentBalanceBytes)) // Error handling not needed since Itoa() was used when setting the account balance, guaranteeing it was an integer.
+	toCurrentBalance, err := parseAmount(toCurrentBalanceBytes)
+	if err != nil {
+		return fmt.Errorf("failed to read recipient account %s balance: %w", to, err)
 	}
 
-	fromUpdatedBalance := fromCurrentBalance - value
-	toUpdatedBalance := toCurrentBalance + value
+	toUpdatedBalance, err := add(toCurrentBalance, value)
+	if err != nil {
+		return fmt.Errorf("failed to credit recipient account %s: %w", to, err)
+	}
 
-	err = ctx.GetStub().PutState(from, []byte(strconv.Itoa(fromUpdatedBalance)))
+	err = putBalance(ctx, to, toKey, legacy, toUpdatedBalance)
 	if err != nil {
 		return err
 	}
 
-	err = ctx.GetStub().PutState(to, []byte(strconv.Itoa(toUpdatedBalance)))
+	log.Printf("recipient %s balance updated from %d to %d", to, toCurrentBalance, toUpdatedBalance)
+
+	return nil
+}
+
+// readBalance returns the balance key of the account and the balance stored under it.
+// Balances written before they were stored under composite keys are keyed by the raw account id,
+// so that key is read when the composite key doesn't exist and legacy is set to true
+func readBalance(ctx contractapi.TransactionContextInterface, account string) (string, []byte, bool, error) {
+
+	balanceKey, err := ctx.GetStub().CreateCompositeKey(balancePrefix, []string{account})
+	if err != nil {
+		return "", nil, false, fmt.Errorf("failed to create the composite key for prefix %s: %v", balancePrefix, err)
+	}
+
+	balanceBytes, err := ctx.GetStub().GetState(balanceKey)
+	if err != nil {
+		return "", nil, false, err
+	}
+	if balanceBytes != nil {
+		return balanceKey, balanceBytes, false, nil
+	}
+
+	legacyBalanceBytes, err := ctx.GetStub().GetState(account)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	return balanceKey, legacyBalanceBytes, legacyBalanceBytes != nil, nil
+}
+
+// putBalance stores the balance under the composite key returned by readBalance,
+// and deletes the legacy key so the balance is only held in one place
+func putBalance(ctx contractapi.TransactionContextInterface, account string, balanceKey string, legacy bool, balance int) error {
+
+	err := ctx.GetStub().PutState(balanceKey, []byte(strconv.Itoa(balance)))
 	if err != nil {
 		return err
 	}
 
-	log.Printf("client %s balance updated from %d to %d", from, fromCurrentBalance, fromUpdatedBalance)
-	log.Printf("recipient %s balance updated from %d to %d", to, toCurrentBalance, toUpdatedBalance)
+	if legacy {
+		err = ctx.GetStub().DelState(account)
+		if err != nil {
+			return fmt.Errorf("failed to delete legacy balance of account %s: %v", account, err)
+		}
+	}
+
+	return nil
+}
+
+// checkInitialized returns true if the contract options have been set by Initialize
+func checkInitialized(ctx contractapi.TransactionContextInterface) (bool, error) {
+	tokenName, err := ctx.GetStub().GetState(nameKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to get token name: %v", err)
+	}
+
+	return tokenName != nil, nil
+}
+
+// requireInitialized returns an error unless the contract has been initialized
+// Dependant functions include every function that changes the world state
+func requireInitialized(ctx contractapi.TransactionContextInterface) error {
+	initialized, err := checkInitialized(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if contract is already initialized: %v", err)
+	}
+	if !initialized {
+		return fmt.Errorf("contract options need to be set before calling any function, call Initialize() to initialize contract")
+	}
 
 	return nil
 }
@@ -0,0 +1,812 @@
+package chaincode_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/token-erc-20/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+/*
+These unit tests use mocks to simulate chaincode-api & fabric interactions
+The mocks are generated using counterfeiter directives in the comments (starting with "go:generate counterfeiter")
+All files in mocks/* are generated by running following, in the directory with your directive:
+	`go generate`
+*/
+
+//go:generate counterfeiter -o mocks/transaction.go -fake-name TransactionContext . transactionContext
+type transactionContext interface {
+	contractapi.TransactionContextInterface
+}
+
+//go:generate counterfeiter -o mocks/chaincodestub.go -fake-name ChaincodeStub . chaincodeStub
+type chaincodeStub interface {
+	shim.ChaincodeStubInterface
+}
+
+//go:generate counterfeiter -o mocks/statequeryiterator.go -fake-name StateQueryIterator . stateQueryIterator
+type stateQueryIterator interface {
+	shim.StateQueryIteratorInterface
+}
+
+//go:generate counterfeiter -o mocks/clientIdentity.go -fake-name ClientIdentity . clientIdentity
+type clientIdentity interface {
+	cid.ClientIdentity
+}
+
+const myOrg1Msp = "Org1MSP"
+const myOrg1Clientid = "myOrg1Userid"
+const myOrg2Msp = "Org2MSP"
+const myOrg2Clientid = "myOrg2Userid"
+
+func TestInitialize(t *testing.T) {
+	transactionContext, _, clientIdentity := prepMocks(myOrg2Msp, myOrg2Clientid)
+	token := chaincode.SmartContract{}
+
+	err := token.Initialize(transactionContext, "Sample Token", "SMP", 2)
+	require.EqualError(t, err, "client is not authorized to initialize the contract")
+
+	clientIdentity.GetMSPIDReturns(myOrg1Msp, nil)
+	clientIdentity.GetIDReturns(myOrg1Clientid, nil)
+	err = token.Initialize(transactionContext, "", "SMP", 2)
+	require.EqualError(t, err, "token name and symbol must not be empty")
+
+	err = token.Initialize(transactionContext, "Sample Token", "SMP", -1)
+	require.EqualError(t, err, "decimals cannot be negative")
+
+	err = token.Initialize(transactionContext, "Sample Token", "SMP", 2)
+	require.NoError(t, err)
+
+	name, err := token.Name(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, "Sample Token", name)
+
+	symbol, err := token.Symbol(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, "SMP", symbol)
+
+	decimals, err := token.Decimals(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 2, decimals)
+
+	isAdmin, err := token.HasRole(transactionContext, chaincode.AdminRole, myOrg1Clientid)
+	require.NoError(t, err)
+	require.True(t, isAdmin)
+
+	err = token.Initialize(transactionContext, "Other Token", "OTH", 0)
+	require.EqualError(t, err, "contract has already been initialized")
+}
+
+func TestRequireInitialized(t *testing.T) {
+	transactionContext, _, _ := prepMocks(myOrg1Msp, myOrg1Clientid)
+	token := chaincode.SmartContract{}
+	notInitialized := "contract options need to be set before calling any function, call Initialize() to initialize contract"
+
+	err := token.Mint(transactionContext, 1000)
+	require.EqualError(t, err, notInitialized)
+
+	err = token.Burn(transactionContext, 1000)
+	require.EqualError(t, err, notInitialized)
+
+	err = token.Transfer(transactionContext, myOrg2Clientid, 10)
+	require.EqualError(t, err, notInitialized)
+
+	err = token.Approve(transactionContext, myOrg2Clientid, 10)
+	require.EqualError(t, err, notInitialized)
+
+	err = token.TransferFrom(transactionContext, myOrg2Clientid, myOrg1Clientid, 10)
+	require.EqualError(t, err, notInitialized)
+
+	err = token.GrantRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.EqualError(t, err, notInitialized)
+
+	err = token.RevokeRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.EqualError(t, err, notInitialized)
+}
+
+func TestGrantAndRevokeRole(t *testing.T) {
+	transactionContext, chaincodeStub, clientIdentity := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	err := token.GrantRole(transactionContext, "owner", myOrg2Clientid)
+	require.EqualError(t, err, "unknown role owner")
+
+	err = token.GrantRole(transactionContext, chaincode.MinterRole, myOrg2Clientid)
+	require.NoError(t, err)
+	eventName, _ := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "RoleGranted", eventName)
+
+	isMinter, err := token.HasRole(transactionContext, chaincode.MinterRole, myOrg2Clientid)
+	require.NoError(t, err)
+	require.True(t, isMinter)
+
+	err = token.GrantRole(transactionContext, chaincode.MinterRole, myOrg2Clientid)
+	require.EqualError(t, err, "account myOrg2Userid already has role minter")
+
+	// Only admins can change roles
+	clientIdentity.GetIDReturns(myOrg2Clientid, nil)
+	err = token.RevokeRole(transactionContext, chaincode.MinterRole, myOrg2Clientid)
+	require.EqualError(t, err, "client is not authorized to revoke roles: client myOrg2Userid does not have role admin")
+
+	clientIdentity.GetIDReturns(myOrg1Clientid, nil)
+	err = token.RevokeRole(transactionContext, chaincode.MinterRole, myOrg2Clientid)
+	require.NoError(t, err)
+	eventName, _ = chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "RoleRevoked", eventName)
+
+	isMinter, err = token.HasRole(transactionContext, chaincode.MinterRole, myOrg2Clientid)
+	require.NoError(t, err)
+	require.False(t, isMinter)
+
+	err = token.RevokeRole(transactionContext, chaincode.MinterRole, myOrg2Clientid)
+	require.EqualError(t, err, "account myOrg2Userid does not have role minter")
+}
+
+func TestMintRequiresMinterRole(t *testing.T) {
+	transactionContext, _, _ := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	err := token.Mint(transactionContext, 1000)
+	require.EqualError(t, err, "client is not authorized to mint new tokens: client myOrg1Userid does not have role minter")
+
+	err = token.GrantRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.NoError(t, err)
+
+	err = token.Mint(transactionContext, 1000)
+	require.NoError(t, err)
+
+	balance, err := token.BalanceOf(transactionContext, myOrg1Clientid)
+	require.NoError(t, err)
+	require.Equal(t, 1000, balance)
+}
+
+func TestBurnRequiresBurnerRole(t *testing.T) {
+	transactionContext, _, _ := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	err := token.GrantRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.NoError(t, err)
+	err = token.Mint(transactionContext, 1000)
+	require.NoError(t, err)
+
+	err = token.Burn(transactionContext, 400)
+	require.EqualError(t, err, "client is not authorized to burn tokens: client myOrg1Userid does not have role burner")
+
+	err = token.GrantRole(transactionContext, chaincode.BurnerRole, myOrg1Clientid)
+	require.NoError(t, err)
+
+	err = token.Burn(transactionContext, 400)
+	require.NoError(t, err)
+
+	totalSupply, err := token.TotalSupply(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 600, totalSupply)
+}
+
+func TestMintOverflow(t *testing.T) {
+	transactionContext, _, _ := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+	maxInt := int(^uint(0) >> 1)
+
+	err := token.GrantRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.NoError(t, err)
+
+	err = token.Mint(transactionContext, maxInt)
+	require.NoError(t, err)
+
+	err = token.Mint(transactionContext, 1)
+	require.True(t, errors.Is(err, chaincode.ErrOverflow), "expected overflow, got %v", err)
+
+	totalSupply, err := token.TotalSupply(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, maxInt, totalSupply)
+}
+
+func TestTransferRejectsCorruptBalance(t *testing.T) {
+	transactionContext, chaincodeStub, _ := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	balanceKey, err := chaincodeStub.CreateCompositeKey("balance", []string{myOrg1Clientid})
+	require.NoError(t, err)
+	err = chaincodeStub.PutState(balanceKey, []byte("not a number"))
+	require.NoError(t, err)
+
+	err = token.Transfer(transactionContext, myOrg2Clientid, 10)
+	require.True(t, errors.Is(err, chaincode.ErrCorruptAmount), "expected corrupt amount, got %v", err)
+
+	_, err = token.BalanceOf(transactionContext, myOrg1Clientid)
+	require.True(t, errors.Is(err, chaincode.ErrCorruptAmount), "expected corrupt amount, got %v", err)
+}
+
+func TestPause(t *testing.T) {
+	transactionContext, chaincodeStub, clientIdentity := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	err := token.GrantRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.NoError(t, err)
+	err = token.Mint(transactionContext, 1000)
+	require.NoError(t, err)
+
+	err = token.Pause(transactionContext)
+	require.EqualError(t, err, "client is not authorized to pause the contract: client myOrg1Userid does not have role pauser")
+
+	err = token.GrantRole(transactionContext, chaincode.PauserRole, myOrg1Clientid)
+	require.NoError(t, err)
+	err = token.Pause(transactionContext)
+	require.NoError(t, err)
+	eventName, _ := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "Paused", eventName)
+
+	paused, err := token.Paused(transactionContext)
+	require.NoError(t, err)
+	require.True(t, paused)
+
+	err = token.Mint(transactionContext, 1000)
+	require.EqualError(t, err, "failed to mint: contract is paused")
+
+	err = token.Transfer(transactionContext, myOrg2Clientid, 10)
+	require.EqualError(t, err, "failed to transfer: contract is paused")
+
+	err = token.Approve(transactionContext, myOrg2Clientid, 10)
+	require.NoError(t, err)
+	clientIdentity.GetIDReturns(myOrg2Clientid, nil)
+	err = token.TransferFrom(transactionContext, myOrg1Clientid, myOrg2Clientid, 10)
+	require.EqualError(t, err, "failed to transfer: contract is paused")
+
+	clientIdentity.GetIDReturns(myOrg1Clientid, nil)
+	err = token.Unpause(transactionContext)
+	require.NoError(t, err)
+	eventName, _ = chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "Unpaused", eventName)
+
+	err = token.Unpause(transactionContext)
+	require.EqualError(t, err, "contract is not paused")
+
+	err = token.Transfer(transactionContext, myOrg2Clientid, 10)
+	require.NoError(t, err)
+}
+
+func TestFreezeAccount(t *testing.T) {
+	transactionContext, chaincodeStub, clientIdentity := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	err := token.GrantRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.NoError(t, err)
+	err = token.Mint(transactionContext, 1000)
+	require.NoError(t, err)
+
+	err = token.FreezeAccount(transactionContext, myOrg2Clientid)
+	require.NoError(t, err)
+	eventName, _ := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "AccountFrozen", eventName)
+
+	err = token.FreezeAccount(transactionContext, myOrg2Clientid)
+	require.EqualError(t, err, "account myOrg2Userid is already frozen")
+
+	frozen, err := token.IsFrozen(transactionContext, myOrg2Clientid)
+	require.NoError(t, err)
+	require.True(t, frozen)
+
+	// Frozen accounts can neither receive nor spend tokens
+	err = token.Transfer(transactionContext, myOrg2Clientid, 10)
+	require.EqualError(t, err, "failed to transfer: account myOrg2Userid is frozen")
+
+	err = token.Approve(transactionContext, myOrg2Clientid, 10)
+	require.NoError(t, err)
+	clientIdentity.GetIDReturns(myOrg2Clientid, nil)
+	err = token.TransferFrom(transactionContext, myOrg1Clientid, "myOrg3Userid", 10)
+	require.EqualError(t, err, "failed to transfer: account myOrg2Userid is frozen")
+
+	err = token.UnfreezeAccount(transactionContext, myOrg2Clientid)
+	require.EqualError(t, err, "client is not authorized to unfreeze accounts: client myOrg2Userid does not have role admin")
+
+	clientIdentity.GetIDReturns(myOrg1Clientid, nil)
+	err = token.UnfreezeAccount(transactionContext, myOrg2Clientid)
+	require.NoError(t, err)
+	eventName, _ = chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "AccountUnfrozen", eventName)
+
+	err = token.Transfer(transactionContext, myOrg2Clientid, 10)
+	require.NoError(t, err)
+
+	// A frozen minter cannot mint
+	err = token.FreezeAccount(transactionContext, myOrg1Clientid)
+	require.NoError(t, err)
+	err = token.Mint(transactionContext, 1000)
+	require.EqualError(t, err, "failed to mint: account myOrg1Userid is frozen")
+}
+
+func TestGetHolders(t *testing.T) {
+	transactionContext, _, _ := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	err := token.GrantRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.NoError(t, err)
+	err = token.Mint(transactionContext, 1000)
+	require.NoError(t, err)
+	for _, recipient := range []string{"recipient1", "recipient2", "recipient3"} {
+		err = token.Transfer(transactionContext, recipient, 100)
+		require.NoError(t, err)
+	}
+
+	_, err = token.GetHolders(transactionContext, 0, "")
+	require.EqualError(t, err, "page size must be a positive integer")
+
+	page, err := token.GetHolders(transactionContext, 3, "")
+	require.NoError(t, err)
+	require.Equal(t, int32(3), page.FetchedRecordsCount)
+	require.Equal(t, []*chaincode.Holder{
+		{Account: myOrg1Clientid, Balance: 700},
+		{Account: "recipient1", Balance: 100},
+		{Account: "recipient2", Balance: 100},
+	}, page.Holders)
+
+	page, err = token.GetHolders(transactionContext, 3, page.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Holder{{Account: "recipient3", Balance: 100}}, page.Holders)
+}
+
+func TestSnapshot(t *testing.T) {
+	transactionContext, chaincodeStub, _ := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	err := token.GrantRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.NoError(t, err)
+	err = token.Mint(transactionContext, 1000)
+	require.NoError(t, err)
+	err = token.Transfer(transactionContext, myOrg2Clientid, 250)
+	require.NoError(t, err)
+
+	err = token.Snapshot(transactionContext, "q1")
+	require.NoError(t, err)
+	eventName, _ := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "Snapshot", eventName)
+
+	err = token.Snapshot(transactionContext, "q1")
+	require.EqualError(t, err, "snapshot q1 already exists")
+
+	// Balances that change after the snapshot do not affect it
+	err = token.Transfer(transactionContext, myOrg2Clientid, 250)
+	require.NoError(t, err)
+
+	balance, err := token.BalanceOfAt(transactionContext, myOrg1Clientid, "q1")
+	require.NoError(t, err)
+	require.Equal(t, 750, balance)
+
+	balance, err = token.BalanceOfAt(transactionContext, myOrg2Clientid, "q1")
+	require.NoError(t, err)
+	require.Equal(t, 250, balance)
+
+	balance, err = token.BalanceOfAt(transactionContext, "someoneElse", "q1")
+	require.NoError(t, err)
+	require.Equal(t, 0, balance)
+
+	_, err = token.BalanceOfAt(transactionContext, myOrg1Clientid, "q2")
+	require.EqualError(t, err, "the snapshot q2 does not exist")
+}
+
+func TestLegacyBalance(t *testing.T) {
+	transactionContext, chaincodeStub, _ := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	// Balances written by earlier versions of the contract are keyed by the raw client id
+	err := chaincodeStub.PutState(myOrg1Clientid, []byte("500"))
+	require.NoError(t, err)
+	err = chaincodeStub.PutState("legacyHolder", []byte("300"))
+	require.NoError(t, err)
+
+	balance, err := token.BalanceOf(transactionContext, myOrg1Clientid)
+	require.NoError(t, err)
+	require.Equal(t, 500, balance)
+
+	balance, err = token.ClientAccountBalance(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 500, balance)
+
+	// Transferring moves both balances to the composite keys
+	err = token.Transfer(transactionContext, "legacyHolder", 200)
+	require.NoError(t, err)
+
+	balance, err = token.BalanceOf(transactionContext, myOrg1Clientid)
+	require.NoError(t, err)
+	require.Equal(t, 300, balance)
+	balance, err = token.BalanceOf(transactionContext, "legacyHolder")
+	require.NoError(t, err)
+	require.Equal(t, 500, balance)
+
+	legacyBytes, err := chaincodeStub.GetState(myOrg1Clientid)
+	require.NoError(t, err)
+	require.Nil(t, legacyBytes)
+	legacyBytes, err = chaincodeStub.GetState("legacyHolder")
+	require.NoError(t, err)
+	require.Nil(t, legacyBytes)
+
+	// MigrateBalance lists an untouched legacy account among the holders
+	err = chaincodeStub.PutState("idleHolder", []byte("50"))
+	require.NoError(t, err)
+	err = token.MigrateBalance(transactionContext, "idleHolder")
+	require.NoError(t, err)
+	err = token.MigrateBalance(transactionContext, "idleHolder")
+	require.EqualError(t, err, "the account idleHolder has no legacy balance")
+
+	page, err := token.GetHolders(transactionContext, 10, "")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Holder{
+		{Account: "idleHolder", Balance: 50},
+		{Account: "legacyHolder", Balance: 500},
+		{Account: myOrg1Clientid, Balance: 300},
+	}, page.Holders)
+}
+
+func TestBatchTransfer(t *testing.T) {
+	transactionContext, chaincodeStub, _ := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	err := token.GrantRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.NoError(t, err)
+	err = token.Mint(transactionContext, 1000)
+	require.NoError(t, err)
+
+	err = token.BatchTransfer(transactionContext, []string{}, []int{})
+	require.EqualError(t, err, "batch must contain at least one recipient")
+
+	err = token.BatchTransfer(transactionContext, []string{"recipient1", "recipient2"}, []int{100})
+	require.EqualError(t, err, "number of recipients 2 does not match number of amounts 1")
+
+	err = token.BatchTransfer(transactionContext, []string{"recipient1", "recipient1"}, []int{100, 100})
+	require.EqualError(t, err, "recipient recipient1 appears more than once in the batch")
+
+	err = token.BatchTransfer(transactionContext, []string{"recipient1", myOrg1Clientid}, []int{100, 100})
+	require.EqualError(t, err, "failed to transfer to recipient myOrg1Userid: cannot transfer to and from same client account")
+
+	// No balance changes when the batch total exceeds the balance
+	err = token.BatchTransfer(transactionContext, []string{"recipient1", "recipient2"}, []int{600, 600})
+	require.EqualError(t, err, "failed to transfer: client account myOrg1Userid has insufficient funds")
+	balance, err := token.BalanceOf(transactionContext, myOrg1Clientid)
+	require.NoError(t, err)
+	require.Equal(t, 1000, balance)
+
+	err = token.BatchTransfer(transactionContext, []string{"recipient1", "recipient2", "recipient3"}, []int{100, 200, 300})
+	require.NoError(t, err)
+	eventName, _ := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "BatchTransfer", eventName)
+
+	balance, err = token.BalanceOf(transactionContext, myOrg1Clientid)
+	require.NoError(t, err)
+	require.Equal(t, 400, balance)
+	balance, err = token.BalanceOf(transactionContext, "recipient3")
+	require.NoError(t, err)
+	require.Equal(t, 300, balance)
+
+	err = token.SetMaxBatchSize(transactionContext, 2)
+	require.NoError(t, err)
+	err = token.BatchTransfer(transactionContext, []string{"recipient1", "recipient2", "recipient3"}, []int{1, 1, 1})
+	require.EqualError(t, err, "batch of 3 recipients exceeds the maximum batch size of 2")
+}
+
+func TestPermit(t *testing.T) {
+	transactionContext, chaincodeStub, clientIdentity := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+	chaincodeStub.GetChannelIDReturns("mychannel")
+	chaincodeStub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: 1000}, nil)
+
+	// The owner registers the certificate whose key signs the permits
+	privateKey, certificate := newTestCertificate(t)
+	clientIdentity.GetX509CertificateReturns(certificate, nil)
+	err := token.RegisterCertificate(transactionContext)
+	require.NoError(t, err)
+
+	nonce, err := token.Nonces(transactionContext, myOrg1Clientid)
+	require.NoError(t, err)
+	require.Equal(t, 0, nonce)
+
+	signature := signPermit(t, privateKey, "mychannel", myOrg1Clientid, myOrg2Clientid, 500, 0, 2000)
+
+	// Any client can relay the permit
+	clientIdentity.GetIDReturns(myOrg2Clientid, nil)
+
+	err = token.Permit(transactionContext, myOrg1Clientid, myOrg2Clientid, 500, 0, 999, signature)
+	require.EqualError(t, err, "permit expired at 999")
+
+	err = token.Permit(transactionContext, myOrg1Clientid, myOrg2Clientid, 500, 1, 2000, signature)
+	require.EqualError(t, err, "invalid nonce 1 for owner myOrg1Userid, expected 0")
+
+	err = token.Permit(transactionContext, myOrg1Clientid, myOrg2Clientid, 5000, 0, 2000, signature)
+	require.EqualError(t, err, "invalid signature for owner myOrg1Userid")
+
+	err = token.Permit(transactionContext, myOrg1Clientid, myOrg2Clientid, 500, 0, 2000, "not base64!")
+	require.EqualError(t, err, "failed to decode signature: illegal base64 data at input byte 3")
+
+	err = token.Permit(transactionContext, myOrg1Clientid, myOrg2Clientid, 500, 0, 2000, signature)
+	require.NoError(t, err)
+	eventName, _ := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "Approval", eventName)
+
+	allowance, err := token.Allowance(transactionContext, myOrg1Clientid, myOrg2Clientid)
+	require.NoError(t, err)
+	require.Equal(t, 500, allowance)
+
+	// The nonce is consumed, so the permit cannot be replayed
+	err = token.Permit(transactionContext, myOrg1Clientid, myOrg2Clientid, 500, 0, 2000, signature)
+	require.EqualError(t, err, "invalid nonce 0 for owner myOrg1Userid, expected 1")
+
+	err = token.Permit(transactionContext, myOrg2Clientid, myOrg1Clientid, 500, 0, 2000, signature)
+	require.EqualError(t, err, "owner myOrg2Userid has not registered a certificate")
+}
+
+func TestVesting(t *testing.T) {
+	transactionContext, chaincodeStub, clientIdentity := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	err := token.GrantRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.NoError(t, err)
+	err = token.Mint(transactionContext, 1000)
+	require.NoError(t, err)
+
+	err = token.CreateVestingSchedule(transactionContext, myOrg2Clientid, 400, 1000, 200, 100)
+	require.EqualError(t, err, "vesting cliff must be between 0 and the duration")
+
+	err = token.CreateVestingSchedule(transactionContext, myOrg2Clientid, 2000, 1000, 100, 1000)
+	require.EqualError(t, err, "failed to create vesting schedule: client account myOrg1Userid has insufficient funds")
+
+	// Lock 400 tokens from t=1000 with a cliff of 100 seconds, fully vested at t=2000
+	chaincodeStub.GetTxIDReturns("tx1")
+	err = token.CreateVestingSchedule(transactionContext, myOrg2Clientid, 400, 1000, 100, 1000)
+	require.NoError(t, err)
+	eventName, _ := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "VestingScheduleCreated", eventName)
+
+	balance, err := token.BalanceOf(transactionContext, myOrg1Clientid)
+	require.NoError(t, err)
+	require.Equal(t, 600, balance)
+
+	// Nothing can be released before the cliff, and locked tokens are not in the beneficiary's balance
+	clientIdentity.GetIDReturns(myOrg2Clientid, nil)
+	chaincodeStub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: 1050}, nil)
+	_, err = token.Release(transactionContext)
+	require.EqualError(t, err, "no tokens are due for release to myOrg2Userid")
+	err = token.Transfer(transactionContext, myOrg1Clientid, 1)
+	require.EqualError(t, err, "failed to transfer: client account myOrg2Userid has no balance")
+
+	// A quarter of the duration has elapsed
+	chaincodeStub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: 1250}, nil)
+	info, err := token.VestingInfo(transactionContext, myOrg2Clientid)
+	require.NoError(t, err)
+	require.Len(t, info, 1)
+	require.Equal(t, 100, info[0].Vested)
+	require.Equal(t, 100, info[0].Releasable)
+
+	released, err := token.Release(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 100, released)
+	eventName, _ = chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "TokensReleased", eventName)
+
+	// Only released tokens can be transferred
+	err = token.Transfer(transactionContext, myOrg1Clientid, 101)
+	require.EqualError(t, err, "failed to transfer: client account myOrg2Userid has insufficient funds")
+
+	chaincodeStub.GetTxTimestampReturns(&timestamp.Timestamp{Seconds: 5000}, nil)
+	released, err = token.Release(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 300, released)
+
+	balance, err = token.BalanceOf(transactionContext, myOrg2Clientid)
+	require.NoError(t, err)
+	require.Equal(t, 400, balance)
+
+	info, err = token.VestingInfo(transactionContext, myOrg2Clientid)
+	require.NoError(t, err)
+	require.Equal(t, 400, info[0].Schedule.Released)
+	require.Equal(t, 0, info[0].Releasable)
+}
+
+func TestTransferAndCall(t *testing.T) {
+	transactionContext, chaincodeStub, clientIdentity := prepInitializedMocks(t)
+	token := chaincode.SmartContract{}
+
+	err := token.GrantRole(transactionContext, chaincode.MinterRole, myOrg1Clientid)
+	require.NoError(t, err)
+	err = token.Mint(transactionContext, 1000)
+	require.NoError(t, err)
+
+	// The tokens move to the recipient account before the recipient chaincode is notified
+	chaincodeStub.InvokeChaincodeCalls(func(name string, args [][]byte, channel string) peer.Response {
+		balance, err := token.BalanceOf(transactionContext, "escrowAgent")
+		require.NoError(t, err)
+		require.Equal(t, 100, balance)
+		return peer.Response{Status: shim.OK}
+	})
+	err = token.TransferAndCall(transactionContext, "escrow", "escrowAgent", 100, "order-1")
+	require.NoError(t, err)
+
+	name, args, channel := chaincodeStub.InvokeChaincodeArgsForCall(chaincodeStub.InvokeChaincodeCallCount() - 1)
+	require.Equal(t, "escrow", name)
+	require.Equal(t, [][]byte{[]byte("OnTokenReceived"), []byte(myOrg1Clientid), []byte("escrowAgent"), []byte("100"), []byte("order-1")}, args)
+	require.Equal(t, "", channel)
+	eventName, _ := chaincodeStub.SetEventArgsForCall(chaincodeStub.SetEventCallCount() - 1)
+	require.Equal(t, "Transfer", eventName)
+
+	// The transaction fails when the recipient chaincode rejects the tokens
+	chaincodeStub.InvokeChaincodeCalls(nil)
+	chaincodeStub.InvokeChaincodeReturns(peer.Response{Status: shim.ERROR, Message: "unexpected tokens"})
+	err = token.TransferAndCall(transactionContext, "escrow", "escrowAgent", 100, "order-1")
+	require.EqualError(t, err, "recipient chaincode escrow rejected the tokens: unexpected tokens")
+
+	// Any successful response accepts the tokens
+	chaincodeStub.InvokeChaincodeReturns(peer.Response{Status: shim.OK, Payload: []byte("false")})
+	err = token.TransferAndCall(transactionContext, "escrow", "escrowAgent", 50, "order-2")
+	require.NoError(t, err)
+
+	// The recipient chaincode is not called when the transfer fails
+	callCount := chaincodeStub.InvokeChaincodeCallCount()
+	err = token.TransferAndCall(transactionContext, "escrow", "escrowAgent", 5000, "order-3")
+	require.Error(t, err)
+	require.Equal(t, callCount, chaincodeStub.InvokeChaincodeCallCount())
+
+	err = token.TransferAndCall(transactionContext, "", "escrowAgent", 100, "order-1")
+	require.EqualError(t, err, "recipient chaincode name must not be empty")
+
+	// The escrow agent can move the received tokens on. The mock stub keeps the writes of the rejected
+	// transaction, which the peer would discard, so the escrow agent holds 250 tokens
+	clientIdentity.GetIDReturns("escrowAgent", nil)
+	err = token.Transfer(transactionContext, myOrg2Clientid, 60)
+	require.NoError(t, err)
+
+	balance, err := token.BalanceOf(transactionContext, "escrowAgent")
+	require.NoError(t, err)
+	require.Equal(t, 190, balance)
+	balance, err = token.BalanceOf(transactionContext, myOrg2Clientid)
+	require.NoError(t, err)
+	require.Equal(t, 60, balance)
+}
+
+// newTestCertificate returns an ECDSA key and a self-signed certificate for it
+func newTestCertificate(t *testing.T) (*ecdsa.PrivateKey, *x509.Certificate) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "owner"},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Unix(1<<32, 0),
+	}
+	certificateBytes, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+
+	certificate, err := x509.ParseCertificate(certificateBytes)
+	require.NoError(t, err)
+
+	return privateKey, certificate
+}
+
+// signPermit signs the canonical permit payload the way an owner's wallet would
+func signPermit(t *testing.T, privateKey *ecdsa.PrivateKey, channelID string, owner string, spender string, value int, nonce int, deadline int64) string {
+	payload := fmt.Sprintf("Permit\nchannel:%s\nowner:%s\nspender:%s\nvalue:%d\nnonce:%d\ndeadline:%d", channelID, owner, spender, value, nonce, deadline)
+	digest := sha256.Sum256([]byte(payload))
+
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, digest[:])
+	require.NoError(t, err)
+	signature, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	require.NoError(t, err)
+
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+// prepInitializedMocks returns mocks for an Org1 client that has initialized the contract and holds the admin role
+func prepInitializedMocks(t *testing.T) (*mocks.TransactionContext, *mocks.ChaincodeStub, *mocks.ClientIdentity) {
+	transactionContext, chaincodeStub, clientIdentity := prepMocks(myOrg1Msp, myOrg1Clientid)
+	token := chaincode.SmartContract{}
+	err := token.Initialize(transactionContext, "Sample Token", "SMP", 2)
+	require.NoError(t, err)
+	return transactionContext, chaincodeStub, clientIdentity
+}
+
+func prepMocks(orgMSP, clientID string) (*mocks.TransactionContext, *mocks.ChaincodeStub, *mocks.ClientIdentity) {
+	chaincodeStub := &mocks.ChaincodeStub{}
+	transactionContext := &mocks.TransactionContext{}
+	transactionContext.GetStubReturns(chaincodeStub)
+
+	clientIdentity := &mocks.ClientIdentity{}
+	clientIdentity.GetMSPIDReturns(orgMSP, nil)
+	clientIdentity.GetIDReturns(clientID, nil)
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+
+	// Back the stub with an in-memory world state
+	worldState := map[string][]byte{}
+	chaincodeStub.GetStateStub = func(key string) ([]byte, error) {
+		return worldState[key], nil
+	}
+	chaincodeStub.PutStateStub = func(key string, value []byte) error {
+		worldState[key] = value
+		return nil
+	}
+	chaincodeStub.DelStateStub = func(key string) error {
+		delete(worldState, key)
+		return nil
+	}
+	chaincodeStub.CreateCompositeKeyStub = func(objectType string, attributes []string) (string, error) {
+		return fmt.Sprintf("\x00%s\x00%s\x00", objectType, strings.Join(attributes, "\x00")), nil
+	}
+	chaincodeStub.SplitCompositeKeyStub = func(compositeKey string) (string, []string, error) {
+		parts := strings.Split(strings.Trim(compositeKey, "\x00"), "\x00")
+		return parts[0], parts[1:], nil
+	}
+	chaincodeStub.GetStateByPartialCompositeKeyStub = func(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+		prefix := "\x00" + objectType + "\x00"
+		for _, attribute := range attributes {
+			prefix += attribute + "\x00"
+		}
+		return newStateQueryIterator(worldState, prefix, "", 0), nil
+	}
+	chaincodeStub.GetStateByPartialCompositeKeyWithPaginationStub = func(objectType string, attributes []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+		prefix := "\x00" + objectType + "\x00"
+		for _, attribute := range attributes {
+			prefix += attribute + "\x00"
+		}
+		iterator := newStateQueryIterator(worldState, prefix, bookmark, int(pageSize))
+		metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: int32(len(iterator.records))}
+		if len(iterator.records) > 0 {
+			metadata.Bookmark = iterator.records[len(iterator.records)-1].Key
+		}
+		return iterator, metadata, nil
+	}
+
+	return transactionContext, chaincodeStub, clientIdentity
+}
+
+// worldStateIterator iterates over the records of the in-memory world state matching a key prefix in key order
+type worldStateIterator struct {
+	*mocks.StateQueryIterator
+	records []*queryresult.KV
+}
+
+// newStateQueryIterator returns the records with the prefix after the bookmark key, limited to pageSize if positive
+func newStateQueryIterator(worldState map[string][]byte, prefix string, bookmark string, pageSize int) *worldStateIterator {
+	keys := []string{}
+	for key := range worldState {
+		if strings.HasPrefix(key, prefix) && key > bookmark {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if pageSize > 0 && len(keys) > pageSize {
+		keys = keys[:pageSize]
+	}
+
+	iterator := &worldStateIterator{StateQueryIterator: &mocks.StateQueryIterator{}}
+	for _, key := range keys {
+		iterator.records = append(iterator.records, &queryresult.KV{Key: key, Value: worldState[key]})
+	}
+	next := 0
+	iterator.HasNextStub = func() bool {
+		return next < len(iterator.records)
+	}
+	iterator.NextStub = func() (*queryresult.KV, error) {
+		next++
+		return iterator.records[next-1], nil
+	}
+	return iterator
+}
@@ -0,0 +1,312 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const vestingPrefix = "vesting"
+
+// VestingSchedule locks tokens for a beneficiary and unlocks them linearly over time
+// Start is a Unix time in seconds, while Cliff and Duration are numbers of seconds counted from Start
+type VestingSchedule struct {
+	ID          string `json:"id"`
+	Beneficiary string `json:"beneficiary"`
+	Funder      string `json:"funder"`
+	Total       int    `json:"total"`
+	Released    int    `json:"released"`
+	Start       int64  `json:"start"`
+	Cliff       int64  `json:"cliff"`
+	Duration    int64  `json:"duration"`
+}
+
+// VestingInfo describes a vesting schedule and the amounts vested at the time of the query
+type VestingInfo struct {
+	Schedule   *VestingSchedule `json:"schedule"`
+	Vested     int              `json:"vested"`
+	Releasable int              `json:"releasable"`
+}
+
+// vestingEvent provides an organized struct for emitting VestingScheduleCreated and TokensReleased events
+type vestingEvent struct {
+	Beneficiary string `json:"beneficiary"`
+	Value       int    `json:"value"`
+}
+
+// CreateVestingSchedule moves total tokens from the client account into a schedule that unlocks them for the beneficiary
+// Nothing unlocks before start+cliff, everything is unlocked at start+duration, and in between tokens unlock linearly from start
+// Locked tokens are held by the schedule rather than the beneficiary's account, so they cannot be spent with Transfer
+// This function triggers a VestingScheduleCreated event
+func (s *SmartContract) CreateVestingSchedule(ctx contractapi.TransactionContextInterface, beneficiary string, total int, start int64, cliff int64, duration int64) error {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Get ID of submitting client identity
+	funder, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if total <= 0 {
+		return fmt.Errorf("vesting total must be a positive integer")
+	}
+	if duration <= 0 {
+		return fmt.Errorf("vesting duration must be a positive number of seconds")
+	}
+	if cliff < 0 || cliff > duration {
+		return fmt.Errorf("vesting cliff must be between 0 and the duration")
+	}
+
+	err = checkTokenMovement(ctx, funder, beneficiary)
+	if err != nil {
+		return fmt.Errorf("failed to create vesting schedule: %v", err)
+	}
+
+	err = debitHelper(ctx, funder, total)
+	if err != nil {
+		return fmt.Errorf("failed to create vesting schedule: %w", err)
+	}
+
+	schedule := VestingSchedule{
+		ID:          ctx.GetStub().GetTxID(),
+		Beneficiary: beneficiary,
+		Funder:      funder,
+		Total:       total,
+		Start:       start,
+		Cliff:       cliff,
+		Duration:    duration,
+	}
+	err = putVestingSchedule(ctx, &schedule)
+	if err != nil {
+		return err
+	}
+
+	// Emit the VestingScheduleCreated event
+	err = setVestingEvent(ctx, "VestingScheduleCreated", beneficiary, total)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("client %s locked %d tokens for beneficiary %s in vesting schedule %s", funder, total, beneficiary, schedule.ID)
+
+	return nil
+}
+
+// Release credits the client account with the tokens vested so far in all of its vesting schedules
+// that have not been released yet
+// This function triggers a TokensReleased event
+func (s *SmartContract) Release(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	err := requireInitialized(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Get ID of submitting client identity
+	beneficiary, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	err = checkTokenMovement(ctx, beneficiary)
+	if err != nil {
+		return 0, fmt.Errorf("failed to release: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	schedules, err := vestingSchedules(ctx, beneficiary)
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, schedule := range schedules {
+		releasable, err := releasableAmount(schedule, now)
+		if err != nil {
+			return 0, err
+		}
+		if releasable == 0 {
+			continue
+		}
+
+		schedule.Released += releasable
+		err = putVestingSchedule(ctx, schedule)
+		if err != nil {
+			return 0, err
+		}
+
+		released, err = add(released, releasable)
+		if err != nil {
+			return 0, fmt.Errorf("failed to compute released amount: %w", err)
+		}
+	}
+
+	if released == 0 {
+		return 0, fmt.Errorf("no tokens are due for release to %s", beneficiary)
+	}
+
+	// Credit the total once, since reads do not see the transaction's own writes
+	err = creditHelper(ctx, beneficiary, released)
+	if err != nil {
+		return 0, fmt.Errorf("failed to release: %w", err)
+	}
+
+	// Emit the TokensReleased event
+	err = setVestingEvent(ctx, "TokensReleased", beneficiary, released)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("released %d vested tokens to %s", released, beneficiary)
+
+	return released, nil
+}
+
+// VestingInfo returns the vesting schedules of the beneficiary with the amounts vested and releasable at the time of the query
+func (s *SmartContract) VestingInfo(ctx contractapi.TransactionContextInterface, beneficiary string) ([]*VestingInfo, error) {
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	schedules, err := vestingSchedules(ctx, beneficiary)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []*VestingInfo{}
+	for _, schedule := range schedules {
+		vested, err := vestedAmount(schedule, now)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, &VestingInfo{
+			Schedule:   schedule,
+			Vested:     vested,
+			Releasable: vested - schedule.Released,
+		})
+	}
+
+	return infos, nil
+}
+
+// Helper Functions
+
+// vestedAmount returns the number of tokens of the schedule unlocked at the Unix time now
+func vestedAmount(schedule *VestingSchedule, now int64) (int, error) {
+	elapsed := now - schedule.Start
+	if elapsed < schedule.Cliff {
+		return 0, nil
+	}
+	if elapsed >= schedule.Duration {
+		return schedule.Total, nil
+	}
+
+	// Compute total * elapsed / duration with big integers, since the product can exceed an int
+	vested := new(big.Int).Mul(big.NewInt(int64(schedule.Total)), big.NewInt(elapsed))
+	vested.Quo(vested, big.NewInt(schedule.Duration))
+	if !vested.IsInt64() || vested.Int64() > int64(schedule.Total) {
+		return 0, fmt.Errorf("%w: vested amount of schedule %s", ErrOverflow, schedule.ID)
+	}
+
+	return int(vested.Int64()), nil
+}
+
+// releasableAmount returns the number of tokens of the schedule unlocked at the Unix time now and not yet released
+func releasableAmount(schedule *VestingSchedule, now int64) (int, error) {
+	vested, err := vestedAmount(schedule, now)
+	if err != nil {
+		return 0, err
+	}
+
+	releasable, err := sub(vested, schedule.Released)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute releasable amount of schedule %s: %w", schedule.ID, err)
+	}
+
+	return releasable, nil
+}
+
+// vestingSchedules reads all vesting schedules of the beneficiary from the world state
+func vestingSchedules(ctx contractapi.TransactionContextInterface, beneficiary string) ([]*VestingSchedule, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(vestingPrefix, []string{beneficiary})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vesting schedules of %s from world state: %v", beneficiary, err)
+	}
+	defer resultsIterator.Close()
+
+	var schedules []*VestingSchedule
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var schedule VestingSchedule
+		err = json.Unmarshal(queryResponse.Value, &schedule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal vesting schedule %s: %v", queryResponse.Key, err)
+		}
+		schedules = append(schedules, &schedule)
+	}
+
+	return schedules, nil
+}
+
+// putVestingSchedule writes the vesting schedule to the world state
+func putVestingSchedule(ctx contractapi.TransactionContextInterface, schedule *VestingSchedule) error {
+	vestingKey, err := ctx.GetStub().CreateCompositeKey(vestingPrefix, []string{schedule.Beneficiary, schedule.ID})
+	if err != nil {
+		return fmt.Errorf("failed to create the composite key for prefix %s: %v", vestingPrefix, err)
+	}
+
+	scheduleJSON, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(vestingKey, scheduleJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put vesting schedule %s: %v", schedule.ID, err)
+	}
+
+	return nil
+}
+
+// txTime returns the transaction timestamp as a Unix time in seconds
+// The transaction timestamp is chosen by the client and is the same on every endorser
+func txTime(ctx contractapi.TransactionContextInterface) (int64, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	return txTimestamp.GetSeconds(), nil
+}
+
+// setVestingEvent emits a VestingScheduleCreated or TokensReleased event
+func setVestingEvent(ctx contractapi.TransactionContextInterface, name string, beneficiary string, value int) error {
+	vestingEventJSON, err := json.Marshal(vestingEvent{beneficiary, value})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+	err = ctx.GetStub().SetEvent(name, vestingEventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
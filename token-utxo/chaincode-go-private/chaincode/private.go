@@ -0,0 +1,456 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const utxoPrefix = "utxo"
+const utxoCommitmentPrefix = "utxoCommitment"
+
+// maxInt is the largest value an int can hold
+const maxInt = int(^uint(0) >> 1)
+
+// minSaltLength is the minimum length of the salt of a private UTXO, so that its commitment can not be guessed
+const minSaltLength = 16
+
+// SmartContract provides functions for transferring tokens using confidential UTXO transactions
+// It is deployed as a separate chaincode from the public UTXO token, so that it can have an endorsement policy
+// that a single organization can satisfy, while the public UTXOs keep the default majority policy
+type SmartContract struct {
+	contractapi.Contract
+}
+
+// PrivateUTXO represents a confidential unspent transaction output
+// It is stored in the implicit private data collection of the owner's organization, using the same owner:utxoKey composite key as public UTXOs.
+// The public ledger only holds a commitment to it, the SHA-256 hash of its JSON encoding, under the utxo key.
+// The commitment key has a state-based endorsement policy that requires the owner's organization, so it can only be spent with its endorsement.
+// The salt is chosen by the client so that the commitment can not be reversed by guessing the owner and amount
+type PrivateUTXO struct {
+	Key    string `json:"utxo_key"`
+	Owner  string `json:"owner"`
+	Amount int    `json:"amount"`
+	Salt   string `json:"salt"`
+}
+
+// PrivateUTXOOutput describes a private UTXO to create, it is passed in the transient field so it stays off the ledger
+// OwnerOrg is the MSP ID of the owner's organization, whose implicit collection will hold the UTXO
+type PrivateUTXOOutput struct {
+	Owner    string `json:"owner"`
+	OwnerOrg string `json:"owner_org"`
+	Amount   int    `json:"amount"`
+	Salt     string `json:"salt"`
+}
+
+// MintPrivate creates a new private UTXO owned by the minter
+// The amount and salt are passed in the transient field under the "utxo_output" key, for example {"amount":5000,"salt":"..."}
+// Only the utxo key is returned, since the transaction response is recorded on the ledger.
+// No supply counter is kept, since it would reveal the amount of each mint on the public ledger
+func (s *SmartContract) MintPrivate(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	// Check minter authorization - this sample assumes Org1 is the central banker with privilege to mint new tokens
+	clientMSPID, err := getClientOrgID(ctx)
+	if err != nil {
+		return "", err
+	}
+	if clientMSPID != "Org1MSP" {
+		return "", fmt.Errorf("client is not authorized to mint new tokens")
+	}
+
+	// Get ID of submitting client identity
+	minter, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("error getting transient: %v", err)
+	}
+
+	// The amount must be retrieved from the transient field as it is private
+	utxoOutputJSON, ok := transientMap["utxo_output"]
+	if !ok {
+		return "", fmt.Errorf("utxo_output key not found in the transient map")
+	}
+
+	var utxoOutput PrivateUTXOOutput
+	err = json.Unmarshal(utxoOutputJSON, &utxoOutput)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal utxo_output: %v", err)
+	}
+	utxoOutput.Owner = minter
+	utxoOutput.OwnerOrg = clientMSPID
+
+	err = validatePrivateUTXOOutput(&utxoOutput)
+	if err != nil {
+		return "", err
+	}
+
+	utxo := PrivateUTXO{
+		Key:    ctx.GetStub().GetTxID() + ".0",
+		Owner:  minter,
+		Amount: utxoOutput.Amount,
+		Salt:   utxoOutput.Salt,
+	}
+
+	err = putPrivateUTXO(ctx, clientMSPID, &utxo)
+	if err != nil {
+		return "", err
+	}
+
+	log.Printf("private utxo minted: %s", utxo.Key)
+
+	return utxo.Key, nil
+}
+
+// TransferPrivate transfers private UTXOs containing tokens from client to recipient(s)
+// The outputs are passed in the transient field under the "utxo_outputs" key as a JSON array of PrivateUTXOOutput.
+// Each input is read from the client's implicit collection and checked against its commitment on the public ledger.
+// Since the amounts are only visible to the client's organization, the transaction is endorsed by a peer of the
+// client's organization alone, which checks that the total input amount equals the total output amount.
+// This chaincode is therefore deployed with an endorsement policy that a single organization can satisfy,
+// for example OR('Org1MSP.peer','Org2MSP.peer'), since the new commitments are validated against it. The spent
+// commitments are protected by their state-based endorsement policy, so each organization can only spend its own
+func (s *SmartContract) TransferPrivate(ctx contractapi.TransactionContextInterface, utxoInputKeys []string) ([]string, error) {
+
+	clientOrgID, err := getClientOrgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The client may only read private UTXOs from a peer of its own organization
+	err = verifyClientOrgMatchesPeerOrg(clientOrgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+
+	// Outputs must be retrieved from the transient field as they are private
+	utxoOutputsJSON, ok := transientMap["utxo_outputs"]
+	if !ok {
+		return nil, fmt.Errorf("utxo_outputs key not found in the transient map")
+	}
+
+	var utxoOutputs []PrivateUTXOOutput
+	err = json.Unmarshal(utxoOutputsJSON, &utxoOutputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal utxo_outputs: %v", err)
+	}
+
+	// Validate and summarize utxo inputs
+	collection := buildCollectionName(clientOrgID)
+	utxoInputs := make(map[string]*PrivateUTXO)
+	var totalInputAmount int
+	for _, utxoInputKey := range utxoInputKeys {
+		if utxoInputs[utxoInputKey] != nil {
+			return nil, fmt.Errorf("the same utxo input can not be spend twice")
+		}
+
+		utxoInput, err := readPrivateUTXO(ctx, collection, clientID, utxoInputKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if totalInputAmount > maxInt-utxoInput.Amount {
+			return nil, fmt.Errorf("total utxoInput amount overflows")
+		}
+		totalInputAmount += utxoInput.Amount
+		utxoInputs[utxoInputKey] = utxoInput
+	}
+
+	// Validate and summarize utxo outputs
+	var totalOutputAmount int
+	for i := range utxoOutputs {
+		err = validatePrivateUTXOOutput(&utxoOutputs[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if totalOutputAmount > maxInt-utxoOutputs[i].Amount {
+			return nil, fmt.Errorf("total utxoOutput amount overflows")
+		}
+		totalOutputAmount += utxoOutputs[i].Amount
+	}
+
+	// Validate total inputs equals total outputs
+	if totalInputAmount != totalOutputAmount {
+		return nil, fmt.Errorf("total utxoInput amount does not equal total utxoOutput amount")
+	}
+
+	// Since the transaction is valid, now delete utxo inputs and their commitments
+	for _, utxoInput := range utxoInputs {
+		err = deletePrivateUTXO(ctx, collection, utxoInput)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("private utxoInput deleted: %s", utxoInput.Key)
+	}
+
+	// Create utxo outputs in the implicit collection of each owner's organization
+	txID := ctx.GetStub().GetTxID()
+	var utxoOutputKeys []string
+	for i, utxoOutput := range utxoOutputs {
+		utxo := PrivateUTXO{
+			Key:    fmt.Sprintf("%s.%d", txID, i),
+			Owner:  utxoOutput.Owner,
+			Amount: utxoOutput.Amount,
+			Salt:   utxoOutput.Salt,
+		}
+
+		err = putPrivateUTXO(ctx, utxoOutput.OwnerOrg, &utxo)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("private utxoOutput created: %s", utxo.Key)
+
+		utxoOutputKeys = append(utxoOutputKeys, utxo.Key)
+	}
+
+	return utxoOutputKeys, nil
+}
+
+// ClientPrivateUTXOs returns all private UTXOs owned by the calling client
+// The query must be sent to a peer of the client's organization, since only it holds the client's private UTXOs
+func (s *SmartContract) ClientPrivateUTXOs(ctx contractapi.TransactionContextInterface) ([]*PrivateUTXO, error) {
+
+	clientOrgID, err := getClientOrgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyClientOrgMatchesPeerOrg(clientOrgID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	// private utxos have a composite key of owner:utxoKey, so we can query for all utxos matching owner:*
+	utxoResultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(buildCollectionName(clientOrgID), utxoPrefix, []string{clientID})
+	if err != nil {
+		return nil, err
+	}
+	defer utxoResultsIterator.Close()
+
+	var utxos []*PrivateUTXO
+	for utxoResultsIterator.HasNext() {
+		utxoRecord, err := utxoResultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var utxo PrivateUTXO
+		err = json.Unmarshal(utxoRecord.Value, &utxo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal private utxo %s: %v", utxoRecord.Key, err)
+		}
+		utxos = append(utxos, &utxo)
+	}
+
+	return utxos, nil
+}
+
+// Helper Functions
+
+// validatePrivateUTXOOutput checks the amount, owner and salt requested for a private utxo output
+func validatePrivateUTXOOutput(utxoOutput *PrivateUTXOOutput) error {
+
+	if utxoOutput.Amount <= 0 {
+		return fmt.Errorf("utxo output amount must be a positive integer")
+	}
+	if utxoOutput.Owner == "" {
+		return fmt.Errorf("utxo output must have an owner")
+	}
+	if utxoOutput.OwnerOrg == "" {
+		return fmt.Errorf("utxo output must have an owner organization")
+	}
+	if len(utxoOutput.Salt) < minSaltLength {
+		return fmt.Errorf("utxo output salt must be at least %d characters long", minSaltLength)
+	}
+
+	return nil
+}
+
+// readPrivateUTXO reads the client's private utxo from the collection and checks it against its commitment on the public ledger
+func readPrivateUTXO(ctx contractapi.TransactionContextInterface, collection string, clientID string, utxoKey string) (*PrivateUTXO, error) {
+
+	utxoCompositeKey, err := ctx.GetStub().CreateCompositeKey(utxoPrefix, []string{clientID, utxoKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	utxoJSON, err := ctx.GetStub().GetPrivateData(collection, utxoCompositeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private utxo %s from collection %s: %v", utxoKey, collection, err)
+	}
+	if utxoJSON == nil {
+		return nil, fmt.Errorf("private utxoInput %s not found for client %s", utxoKey, clientID)
+	}
+
+	commitmentKey, err := ctx.GetStub().CreateCompositeKey(utxoCommitmentPrefix, []string{utxoKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	commitment, err := ctx.GetStub().GetState(commitmentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read commitment of utxo %s from world state: %v", utxoKey, err)
+	}
+	if commitment == nil {
+		return nil, fmt.Errorf("commitment of utxo %s not found", utxoKey)
+	}
+
+	// verify that the private utxo matches the commitment on the public ledger
+	if string(commitment) != utxoCommitment(utxoJSON) {
+		return nil, fmt.Errorf("private utxo %s does not match its commitment %s", utxoKey, commitment)
+	}
+
+	var utxo PrivateUTXO
+	err = json.Unmarshal(utxoJSON, &utxo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal private utxo %s: %v", utxoKey, err)
+	}
+	if utxo.Owner != clientID || utxo.Key != utxoKey {
+		return nil, fmt.Errorf("private utxo %s is malformed", utxoKey)
+	}
+
+	return &utxo, nil
+}
+
+// putPrivateUTXO writes the utxo to the implicit collection of the owner's organization and its commitment to the public ledger
+func putPrivateUTXO(ctx contractapi.TransactionContextInterface, ownerOrgID string, utxo *PrivateUTXO) error {
+
+	utxoJSON, err := json.Marshal(utxo)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	utxoCompositeKey, err := ctx.GetStub().CreateCompositeKey(utxoPrefix, []string{utxo.Owner, utxo.Key})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	err = ctx.GetStub().PutPrivateData(buildCollectionName(ownerOrgID), utxoCompositeKey, utxoJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put private utxo %s: %v", utxo.Key, err)
+	}
+
+	commitmentKey, err := ctx.GetStub().CreateCompositeKey(utxoCommitmentPrefix, []string{utxo.Key})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(commitmentKey, []byte(utxoCommitment(utxoJSON)))
+	if err != nil {
+		return fmt.Errorf("failed to put commitment of utxo %s: %v", utxo.Key, err)
+	}
+
+	err = setCommitmentStateBasedEndorsement(ctx, commitmentKey, ownerOrgID)
+	if err != nil {
+		return fmt.Errorf("failed to set endorsement policy of utxo %s: %v", utxo.Key, err)
+	}
+
+	return nil
+}
+
+// setCommitmentStateBasedEndorsement requires the peers of the owner's organization to endorse any update to the commitment
+func setCommitmentStateBasedEndorsement(ctx contractapi.TransactionContextInterface, commitmentKey string, ownerOrgID string) error {
+
+	endorsementPolicy, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	err = endorsementPolicy.AddOrgs(statebased.RoleTypePeer, ownerOrgID)
+	if err != nil {
+		return fmt.Errorf("failed to add org to endorsement policy: %v", err)
+	}
+	policy, err := endorsementPolicy.Policy()
+	if err != nil {
+		return fmt.Errorf("failed to create endorsement policy bytes from org: %v", err)
+	}
+
+	return ctx.GetStub().SetStateValidationParameter(commitmentKey, policy)
+}
+
+// deletePrivateUTXO removes the utxo from the collection and its commitment from the public ledger
+func deletePrivateUTXO(ctx contractapi.TransactionContextInterface, collection string, utxo *PrivateUTXO) error {
+
+	utxoCompositeKey, err := ctx.GetStub().CreateCompositeKey(utxoPrefix, []string{utxo.Owner, utxo.Key})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	err = ctx.GetStub().DelPrivateData(collection, utxoCompositeKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete private utxo %s: %v", utxo.Key, err)
+	}
+
+	commitmentKey, err := ctx.GetStub().CreateCompositeKey(utxoCommitmentPrefix, []string{utxo.Key})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().DelState(commitmentKey)
+}
+
+// utxoCommitment returns the hex encoded SHA-256 hash of a JSON encoded private utxo
+// This is the same hash the peer records on the public ledger for the private data, as returned by GetPrivateDataHash
+func utxoCommitment(utxoJSON []byte) string {
+	hash := sha256.Sum256(utxoJSON)
+	return hex.EncodeToString(hash[:])
+}
+
+// getClientOrgID returns the MSP ID of the client's organization
+func getClientOrgID(ctx contractapi.TransactionContextInterface) (string, error) {
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get MSPID: %v", err)
+	}
+
+	return clientOrgID, nil
+}
+
+// verifyClientOrgMatchesPeerOrg checks the client org id matches the peer org id.
+func verifyClientOrgMatchesPeerOrg(clientOrgID string) error {
+	peerOrgID, err := shim.GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting peer's orgID: %v", err)
+	}
+
+	if clientOrgID != peerOrgID {
+		return fmt.Errorf("client from org %s is not authorized to read or write private data from an org %s peer",
+			clientOrgID,
+			peerOrgID,
+		)
+	}
+
+	return nil
+}
+
+// buildCollectionName returns the name of the implicit private data collection of an organization
+func buildCollectionName(clientOrgID string) string {
+	return fmt.Sprintf("_implicit_org_%s", clientOrgID)
+}
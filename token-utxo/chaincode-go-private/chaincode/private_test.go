@@ -0,0 +1,247 @@
+package chaincode
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestValidatePrivateUTXOOutput(t *testing.T) {
+	salt := "0123456789abcdef"
+
+	tests := []struct {
+		name    string
+		output  PrivateUTXOOutput
+		wantErr bool
+	}{
+		{"valid", PrivateUTXOOutput{Owner: "alice", OwnerOrg: "Org2MSP", Amount: 10, Salt: salt}, false},
+		{"zero amount", PrivateUTXOOutput{Owner: "alice", OwnerOrg: "Org2MSP", Salt: salt}, true},
+		{"no owner", PrivateUTXOOutput{OwnerOrg: "Org2MSP", Amount: 10, Salt: salt}, true},
+		{"no owner org", PrivateUTXOOutput{Owner: "alice", Amount: 10, Salt: salt}, true},
+		{"short salt", PrivateUTXOOutput{Owner: "alice", OwnerOrg: "Org2MSP", Amount: 10, Salt: "salt"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validatePrivateUTXOOutput(&test.output)
+			if test.wantErr && err == nil {
+				t.Fatalf("expected an error for output %+v", test.output)
+			}
+			if !test.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestUTXOCommitment(t *testing.T) {
+	commitment := func(utxo PrivateUTXO) string {
+		utxoJSON, err := json.Marshal(utxo)
+		if err != nil {
+			t.Fatalf("failed to marshal utxo: %v", err)
+		}
+		return utxoCommitment(utxoJSON)
+	}
+
+	utxo := PrivateUTXO{Key: "tx1.0", Owner: "alice", Amount: 10, Salt: "0123456789abcdef"}
+	if commitment(utxo) != commitment(utxo) {
+		t.Fatalf("commitment is not deterministic")
+	}
+	if len(commitment(utxo)) != 64 {
+		t.Fatalf("expected a hex encoded SHA-256 hash, got %s", commitment(utxo))
+	}
+
+	changedAmount := utxo
+	changedAmount.Amount = 11
+	changedSalt := utxo
+	changedSalt.Salt = "fedcba9876543210"
+	if commitment(changedAmount) == commitment(utxo) || commitment(changedSalt) == commitment(utxo) {
+		t.Fatalf("commitment does not bind the amount and salt")
+	}
+}
+
+func TestMintPrivate(t *testing.T) {
+	ctx, stub := newPrivateTransactionContext(t, "minter", "Org1MSP")
+	contract := SmartContract{}
+
+	stub.transient["utxo_output"] = []byte(`{"amount":5000,"salt":"0123456789abcdef"}`)
+	utxoKey, err := contract.MintPrivate(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if utxoKey != "tx1.0" {
+		t.Fatalf("expected utxo key tx1.0, got %s", utxoKey)
+	}
+
+	utxo, err := readPrivateUTXO(ctx, "_implicit_org_Org1MSP", "minter", utxoKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if utxo.Owner != "minter" || utxo.Amount != 5000 {
+		t.Fatalf("unexpected private utxo %+v", utxo)
+	}
+	assertCommitmentEndorsement(t, stub, utxoKey)
+
+	// the public ledger only holds the commitment, no supply counter reveals the minted amount
+	if len(stub.State) != 1 {
+		t.Fatalf("expected only the commitment on the public ledger, got %d keys", len(stub.State))
+	}
+
+	// only Org1 may mint
+	ctx, _ = newPrivateTransactionContext(t, "recipient", "Org2MSP")
+	if _, err = contract.MintPrivate(ctx); err == nil {
+		t.Fatalf("expected an error for a client of Org2")
+	}
+}
+
+func TestTransferPrivate(t *testing.T) {
+	ctx, stub := newPrivateTransactionContext(t, "minter", "Org1MSP")
+	contract := SmartContract{}
+
+	stub.transient["utxo_output"] = []byte(`{"amount":5000,"salt":"0123456789abcdef"}`)
+	utxoKey, err := contract.MintPrivate(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stub.MockTransactionStart("tx2")
+	stub.transient["utxo_outputs"] = []byte(`[
+		{"owner":"recipient","owner_org":"Org2MSP","amount":2000,"salt":"aaaaaaaaaaaaaaaa"},
+		{"owner":"minter","owner_org":"Org1MSP","amount":3000,"salt":"bbbbbbbbbbbbbbbb"}
+	]`)
+
+	// the outputs must hold the same number of tokens as the inputs
+	if _, err = contract.TransferPrivate(ctx, []string{utxoKey, utxoKey}); err == nil {
+		t.Fatalf("expected an error for an input spent twice in the same transfer")
+	}
+
+	utxoOutputKeys, err := contract.TransferPrivate(ctx, []string{utxoKey})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(utxoOutputKeys, ",") != "tx2.0,tx2.1" {
+		t.Fatalf("unexpected output keys %v", utxoOutputKeys)
+	}
+
+	// the input and its commitment are deleted, and the outputs are written to the owners' collections
+	if _, err = readPrivateUTXO(ctx, "_implicit_org_Org1MSP", "minter", utxoKey); err == nil {
+		t.Fatalf("expected the spent input to be deleted")
+	}
+	recipientUTXO, err := readPrivateUTXO(ctx, "_implicit_org_Org2MSP", "recipient", "tx2.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if recipientUTXO.Amount != 2000 {
+		t.Fatalf("unexpected recipient utxo %+v", recipientUTXO)
+	}
+	assertCommitmentEndorsement(t, stub, "tx2.0")
+
+	// the spent input can not be spent again
+	stub.MockTransactionStart("tx3")
+	stub.transient["utxo_outputs"] = []byte(`[{"owner":"minter","owner_org":"Org1MSP","amount":5000,"salt":"cccccccccccccccc"}]`)
+	if _, err = contract.TransferPrivate(ctx, []string{utxoKey}); err == nil {
+		t.Fatalf("expected an error for a double spend")
+	}
+
+	// the change can not be spent for more than it holds
+	if _, err = contract.TransferPrivate(ctx, []string{"tx2.1"}); err == nil {
+		t.Fatalf("expected an error for outputs that exceed the inputs")
+	}
+
+	// a private utxo that was altered in the collection no longer matches its commitment
+	changeKey, err := stub.CreateCompositeKey(utxoPrefix, []string{"minter", "tx2.1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stub.PvtState["_implicit_org_Org1MSP"][changeKey] = []byte(`{"utxo_key":"tx2.1","owner":"minter","amount":5000,"salt":"bbbbbbbbbbbbbbbb"}`)
+	if _, err = contract.TransferPrivate(ctx, []string{"tx2.1"}); err == nil {
+		t.Fatalf("expected an error for a private utxo that does not match its commitment")
+	}
+}
+
+func TestTransferPrivateRequiresClientOrgPeer(t *testing.T) {
+	ctx, stub := newPrivateTransactionContext(t, "recipient", "Org2MSP")
+	contract := SmartContract{}
+
+	os.Setenv("CORE_PEER_LOCALMSPID", "Org1MSP")
+	stub.transient["utxo_outputs"] = []byte(`[]`)
+	if _, err := contract.TransferPrivate(ctx, []string{}); err == nil {
+		t.Fatalf("expected an error for a client of Org2 on an Org1 peer")
+	}
+}
+
+// privateStub adds the transient map and private data deletes to the shim mock stub
+type privateStub struct {
+	*shimtest.MockStub
+	transient map[string][]byte
+}
+
+func (stub *privateStub) GetTransient() (map[string][]byte, error) {
+	return stub.transient, nil
+}
+
+func (stub *privateStub) DelPrivateData(collection string, key string) error {
+	delete(stub.PvtState[collection], key)
+	return nil
+}
+
+// testClientIdentity is a client identity with a fixed id and MSP ID
+type testClientIdentity struct {
+	id    string
+	mspID string
+}
+
+func (identity *testClientIdentity) GetID() (string, error) {
+	return identity.id, nil
+}
+
+func (identity *testClientIdentity) GetMSPID() (string, error) {
+	return identity.mspID, nil
+}
+
+func (identity *testClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (identity *testClientIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	return nil
+}
+
+func (identity *testClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+// newPrivateTransactionContext returns a transaction context for a client, sent to a peer of the client's organization
+func newPrivateTransactionContext(t *testing.T, clientID string, mspID string) (*contractapi.TransactionContext, *privateStub) {
+	os.Setenv("CORE_PEER_LOCALMSPID", mspID)
+	t.Cleanup(func() { os.Unsetenv("CORE_PEER_LOCALMSPID") })
+
+	stub := &privateStub{MockStub: shimtest.NewMockStub("token_utxo_private", nil), transient: map[string][]byte{}}
+	stub.MockTransactionStart("tx1")
+
+	ctx := &contractapi.TransactionContext{}
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(&testClientIdentity{id: clientID, mspID: mspID})
+
+	return ctx, stub
+}
+
+// assertCommitmentEndorsement checks the commitment of the utxo has a state-based endorsement policy
+func assertCommitmentEndorsement(t *testing.T, stub *privateStub, utxoKey string) {
+	commitmentKey, err := stub.CreateCompositeKey(utxoCommitmentPrefix, []string{utxoKey})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	policy, err := stub.GetStateValidationParameter(commitmentKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if policy == nil {
+		t.Fatalf("expected an endorsement policy on the commitment of utxo %s", utxoKey)
+	}
+}
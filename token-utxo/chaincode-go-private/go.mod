@@ -0,0 +1,9 @@
+module github.com/hyperledger/fabric-samples/token-utxo/chaincode-go-private
+
+go 1.14
+
+require (
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20200424173110-d7076418f212
+	github.com/hyperledger/fabric-contract-api-go v1.1.0
+	golang.org/x/tools v0.1.0 // indirect
+)
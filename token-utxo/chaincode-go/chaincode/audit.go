@@ -0,0 +1,263 @@
+package chaincode
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define key names for options
+const supplyKey = "supply"
+
+// maxInt is the largest value an int can hold
+const maxInt = int(^uint(0) >> 1)
+
+// OwnerTotal holds the number of tokens and UTXOs of an owner in the audited part of the UTXO set
+// Multi-owner UTXOs count towards the total of each of their owners
+type OwnerTotal struct {
+	Owner  string `json:"owner"`
+	Amount int    `json:"amount"`
+	UTXOs  int    `json:"utxos"`
+}
+
+// MalformedUTXO describes a UTXO record that failed the audit
+type MalformedUTXO struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+// AuditReport is one page of the audit of the UTXO set
+// AuditedSupply and MalformedCount accumulate over the pages read so far. Once Complete is true, Consistent reports
+// whether the UTXO set holds exactly the supply recorded by Mint and Burn and has no malformed records
+type AuditReport struct {
+	OwnerTotals         []*OwnerTotal    `json:"owner_totals"`
+	MalformedRecords    []*MalformedUTXO `json:"malformed_records"`
+	PageSupply          int              `json:"page_supply"`
+	AuditedSupply       int              `json:"audited_supply"`
+	MalformedCount      int              `json:"malformed_count"`
+	RecordedSupply      int              `json:"recorded_supply"`
+	Complete            bool             `json:"complete"`
+	Consistent          bool             `json:"consistent"`
+	FetchedRecordsCount int32            `json:"fetched_records_count"`
+	Bookmark            string           `json:"bookmark"`
+}
+
+// auditBookmark carries the ledger bookmark and the running totals of an audit from one page to the next
+type auditBookmark struct {
+	Bookmark       string `json:"bookmark"`
+	AuditedSupply  int    `json:"audited_supply"`
+	MalformedCount int    `json:"malformed_count"`
+}
+
+// AuditUTXOSet walks a page of the full UTXO set and reports the totals per owner, the supply and any malformed records
+// Pass an empty bookmark to start the audit, and the returned bookmark to audit the next page until Complete is true.
+// The returned bookmark carries the running totals, so the last page can compare the supply of the whole UTXO set with
+// the supply recorded by Mint and Burn. Paginated queries are only valid for read only transactions.
+// Private UTXOs are held by the separate token_utxo_private chaincode and are not audited
+func (s *SmartContract) AuditUTXOSet(ctx contractapi.TransactionContextInterface, pageSize int, bookmark string) (*AuditReport, error) {
+
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("page size must be a positive integer")
+	}
+
+	cursor, err := parseAuditBookmark(bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	recordedSupply, err := readSupply(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	utxoResultsIterator, responseMetadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(utxoPrefix, []string{}, int32(pageSize), cursor.Bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get utxos from world state: %v", err)
+	}
+	defer utxoResultsIterator.Close()
+
+	report := &AuditReport{
+		OwnerTotals:      []*OwnerTotal{},
+		MalformedRecords: []*MalformedUTXO{},
+		RecordedSupply:   recordedSupply,
+	}
+	ownerTotals := make(map[string]*OwnerTotal)
+	for utxoResultsIterator.HasNext() {
+		utxoRecord, err := utxoResultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		owner, utxoKey, amount, countsTowardsSupply, err := auditUTXORecord(ctx, utxoRecord.Key, utxoRecord.Value)
+		if err != nil {
+			report.MalformedRecords = append(report.MalformedRecords, &MalformedUTXO{Key: utxoKey, Reason: err.Error()})
+			continue
+		}
+
+		ownerTotal, ok := ownerTotals[owner]
+		if !ok {
+			ownerTotal = &OwnerTotal{Owner: owner}
+			ownerTotals[owner] = ownerTotal
+			report.OwnerTotals = append(report.OwnerTotals, ownerTotal)
+		}
+		ownerTotal.UTXOs++
+		if ownerTotal.Amount > maxInt-amount {
+			return nil, fmt.Errorf("total of owner %s overflows", owner)
+		}
+		ownerTotal.Amount += amount
+
+		if countsTowardsSupply {
+			if report.PageSupply > maxInt-amount {
+				return nil, fmt.Errorf("supply of the audited page overflows")
+			}
+			report.PageSupply += amount
+		}
+	}
+
+	if cursor.AuditedSupply > maxInt-report.PageSupply {
+		return nil, fmt.Errorf("audited supply overflows")
+	}
+	report.AuditedSupply = cursor.AuditedSupply + report.PageSupply
+	report.MalformedCount = cursor.MalformedCount + len(report.MalformedRecords)
+	report.FetchedRecordsCount = responseMetadata.FetchedRecordsCount
+
+	report.Complete = responseMetadata.Bookmark == "" || responseMetadata.FetchedRecordsCount < int32(pageSize)
+	if report.Complete {
+		report.Consistent = report.AuditedSupply == report.RecordedSupply && report.MalformedCount == 0
+		return report, nil
+	}
+
+	report.Bookmark, err = encodeAuditBookmark(auditBookmark{
+		Bookmark:       responseMetadata.Bookmark,
+		AuditedSupply:  report.AuditedSupply,
+		MalformedCount: report.MalformedCount,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// TotalSupply returns the number of tokens in public UTXOs, as recorded by Mint and Burn
+func (s *SmartContract) TotalSupply(ctx contractapi.TransactionContextInterface) (int, error) {
+	return readSupply(ctx)
+}
+
+// Helper Functions
+
+// auditUTXORecord checks a record of the utxo range and returns its owner, utxo key and amount
+// A multi-owner utxo has a record for each owner, only the record of its first owner counts towards the supply
+func auditUTXORecord(ctx contractapi.TransactionContextInterface, compositeKey string, value []byte) (string, string, int, bool, error) {
+
+	// composite key is expected to be owner:utxoKey
+	_, compositeKeyParts, err := ctx.GetStub().SplitCompositeKey(compositeKey)
+	if err != nil {
+		return "", compositeKey, 0, false, fmt.Errorf("failed to split composite key: %v", err)
+	}
+	if len(compositeKeyParts) != 2 {
+		return "", compositeKey, 0, false, fmt.Errorf("expected composite key with two parts (owner:utxoKey)")
+	}
+	owner, utxoKey := compositeKeyParts[0], compositeKeyParts[1]
+
+	amount, err := strconv.Atoi(string(value))
+	if err != nil {
+		return "", utxoKey, 0, false, fmt.Errorf("amount %q is not an integer", value)
+	}
+	if amount <= 0 {
+		return "", utxoKey, 0, false, fmt.Errorf("amount %d is not positive", amount)
+	}
+
+	record, err := readUTXOOwnerRecord(ctx, utxoKey)
+	if err != nil {
+		return "", utxoKey, 0, false, err
+	}
+	if record == nil {
+		// utxos created before the key to owner index existed have a single owner
+		return owner, utxoKey, amount, true, nil
+	}
+
+	// a utxo key held by an owner that the index does not list indicates a double spend
+	for _, indexedOwner := range record.Owners {
+		if indexedOwner == owner {
+			return owner, utxoKey, amount, owner == record.Owners[0], nil
+		}
+	}
+
+	return "", utxoKey, 0, false, fmt.Errorf("owner %s is not an owner of the utxo in the key to owner index", owner)
+}
+
+// readSupply reads the number of tokens in public UTXOs from the world state
+func readSupply(ctx contractapi.TransactionContextInterface) (int, error) {
+	supplyBytes, err := ctx.GetStub().GetState(supplyKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read supply from world state: %v", err)
+	}
+
+	// If no supply is recorded yet, no tokens have been minted
+	if supplyBytes == nil {
+		return 0, nil
+	}
+
+	supply, err := strconv.Atoi(string(supplyBytes))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse supply: %v", err)
+	}
+
+	return supply, nil
+}
+
+// updateSupply adds delta, which is negative when tokens are burned, to the supply recorded in the world state
+// Transfers do not change the supply, since their inputs and outputs hold the same number of tokens
+func updateSupply(ctx contractapi.TransactionContextInterface, delta int) error {
+	supply, err := readSupply(ctx)
+	if err != nil {
+		return err
+	}
+
+	if delta > 0 && supply > maxInt-delta {
+		return fmt.Errorf("supply overflows")
+	}
+	supply += delta
+	if supply < 0 {
+		return fmt.Errorf("supply can not become negative")
+	}
+
+	return ctx.GetStub().PutState(supplyKey, []byte(strconv.Itoa(supply)))
+}
+
+// parseAuditBookmark decodes the bookmark returned by AuditUTXOSet, an empty bookmark starts a new audit
+func parseAuditBookmark(bookmark string) (*auditBookmark, error) {
+	cursor := &auditBookmark{}
+	if bookmark == "" {
+		return cursor, nil
+	}
+
+	cursorJSON, err := base64.StdEncoding.DecodeString(bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode bookmark: %v", err)
+	}
+
+	err = json.Unmarshal(cursorJSON, cursor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bookmark: %v", err)
+	}
+	if cursor.AuditedSupply < 0 || cursor.MalformedCount < 0 {
+		return nil, fmt.Errorf("bookmark is malformed")
+	}
+
+	return cursor, nil
+}
+
+// encodeAuditBookmark encodes the ledger bookmark and running totals of an audit
+func encodeAuditBookmark(cursor auditBookmark) (string, error) {
+	cursorJSON, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(cursorJSON), nil
+}
@@ -0,0 +1,147 @@
+package chaincode
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Define objectType names for prefix
+const approvalPrefix = "utxoApproval"
+
+// ApproveSpend records the client's approval to spend a multi-owner UTXO that the client co-owns
+// Once the approvals of RequiredSignatures owners are recorded, counting the owner that submits the spend,
+// any owner can spend the UTXO in a Transfer or Burn. Approvals are removed when the UTXO is spent
+func (s *SmartContract) ApproveSpend(ctx contractapi.TransactionContextInterface, utxoKey string) error {
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	err = requireCoOwner(ctx, clientID, utxoKey)
+	if err != nil {
+		return err
+	}
+
+	approvalKey, err := ctx.GetStub().CreateCompositeKey(approvalPrefix, []string{utxoKey, clientID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(approvalKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to record approval of utxo %s: %v", utxoKey, err)
+	}
+
+	log.Printf("client %s approved spending utxo %s", clientID, utxoKey)
+
+	return nil
+}
+
+// RevokeSpendApproval removes the client's approval to spend a multi-owner UTXO
+func (s *SmartContract) RevokeSpendApproval(ctx contractapi.TransactionContextInterface, utxoKey string) error {
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	err = requireCoOwner(ctx, clientID, utxoKey)
+	if err != nil {
+		return err
+	}
+
+	err = deleteSpendApproval(ctx, utxoKey, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke approval of utxo %s: %v", utxoKey, err)
+	}
+
+	log.Printf("client %s revoked its approval to spend utxo %s", clientID, utxoKey)
+
+	return nil
+}
+
+// Helper Functions
+
+// checkSpendConditions checks that the client can spend the utxo at the Unix time now
+func checkSpendConditions(ctx contractapi.TransactionContextInterface, clientID string, utxo *UTXO, now int64) error {
+
+	if utxo.LockedUntil > now {
+		return fmt.Errorf("utxo %s is locked until %d", utxo.Key, utxo.LockedUntil)
+	}
+
+	if len(utxo.Owners) <= 1 {
+		return nil
+	}
+
+	// The submitting owner approves the spend by submitting it
+	approvals := 0
+	for _, owner := range utxo.Owners {
+		if owner == clientID {
+			approvals++
+			continue
+		}
+
+		approvalKey, err := ctx.GetStub().CreateCompositeKey(approvalPrefix, []string{utxo.Key, owner})
+		if err != nil {
+			return fmt.Errorf("failed to create composite key: %v", err)
+		}
+
+		approvalBytes, err := ctx.GetStub().GetState(approvalKey)
+		if err != nil {
+			return fmt.Errorf("failed to read approval of utxo %s from world state: %v", utxo.Key, err)
+		}
+		if approvalBytes != nil {
+			approvals++
+		}
+	}
+
+	if approvals < utxo.RequiredSignatures {
+		return fmt.Errorf("utxo %s needs approvals from %d of its owners, but has %d", utxo.Key, utxo.RequiredSignatures, approvals)
+	}
+
+	return nil
+}
+
+// canSpendAlone reports whether the owner can spend the utxo at the Unix time now without approvals from other owners
+func canSpendAlone(utxo *UTXO, now int64) bool {
+	return utxo.LockedUntil <= now && (len(utxo.Owners) <= 1 || utxo.RequiredSignatures <= 1)
+}
+
+// requireCoOwner checks that the utxo is a multi-owner utxo and that the client is one of its owners
+func requireCoOwner(ctx contractapi.TransactionContextInterface, clientID string, utxoKey string) error {
+
+	record, err := readUTXOOwnerRecord(ctx, utxoKey)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("utxo %s not found", utxoKey)
+	}
+	if len(record.Owners) <= 1 {
+		return fmt.Errorf("utxo %s is not a multi-owner utxo", utxoKey)
+	}
+
+	for _, owner := range record.Owners {
+		if owner == clientID {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("client %s is not an owner of utxo %s", clientID, utxoKey)
+}
+
+// deleteSpendApproval removes the owner's approval to spend the utxo
+func deleteSpendApproval(ctx contractapi.TransactionContextInterface, utxoKey string, owner string) error {
+
+	approvalKey, err := ctx.GetStub().CreateCompositeKey(approvalPrefix, []string{utxoKey, owner})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().DelState(approvalKey)
+}
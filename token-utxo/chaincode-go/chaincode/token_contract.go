@@ -1,23 +1,41 @@
 package chaincode
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
+// Define objectType names for prefix
+const utxoPrefix = "utxo"
+const utxoOwnerPrefix = "utxoOwner"
+
 // SmartContract provides functions for transferring tokens using UTXO transactions
 type SmartContract struct {
 	contractapi.Contract
 }
 
 // UTXO represents an unspent transaction output
+// Outputs may carry spend conditions: an output with several Owners needs approvals from RequiredSignatures of them
+// to be spent, and an output with LockedUntil set can not be spent before that Unix time in seconds
 type UTXO struct {
-	Key    string `json:"utxo_key"`
-	Owner  string `json:"owner"`
-	Amount int    `json:"amount"`
+	Key                string   `json:"utxo_key"`
+	Owner              string   `json:"owner"`
+	Amount             int      `json:"amount"`
+	Owners             []string `json:"owners,omitempty" metadata:"owners,optional"`
+	RequiredSignatures int      `json:"required_signatures,omitempty" metadata:"required_signatures,optional"`
+	LockedUntil        int64    `json:"locked_until,omitempty" metadata:"locked_until,optional"`
+}
+
+// utxoOwnerRecord is stored in the index from utxo key to owner, together with the spend conditions of the utxo
+type utxoOwnerRecord struct {
+	Owners             []string `json:"owners"`
+	RequiredSignatures int      `json:"required_signatures,omitempty"`
+	LockedUntil        int64    `json:"locked_until,omitempty"`
 }
 
 // Mint creates a new unspent transaction output (UTXO) owned by the minter
@@ -48,13 +66,16 @@ func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, amount
 	utxo.Amount = amount
 
 	// the utxo has a composite key of owner:utxoKey, this enables ClientUTXOs() function to query for an owner's utxos.
-	utxoCompositeKey, err := ctx.GetStub().CreateCompositeKey("utxo", []string{minter, utxo.Key})
-
-	err = ctx.GetStub().PutState(utxoCompositeKey, []byte(strconv.Itoa(amount)))
+	err = putUTXO(ctx, &utxo)
 	if err != nil {
 		return nil, err
 	}
 
+	err = updateSupply(ctx, amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update supply: %v", err)
+	}
+
 	log.Printf("utxo minted: %+v", utxo)
 
 	return &utxo, nil
@@ -69,103 +90,462 @@ func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, ut
 		return nil, fmt.Errorf("failed to get client id: %v", err)
 	}
 
+	return transferHelper(ctx, clientID, utxoInputKeys, utxoOutputs, false)
+}
+
+// TransferWithChange transfers UTXOs containing tokens from client to recipient(s) like Transfer,
+// but the total input amount may exceed the total output amount.
+// The difference is returned to the client in an additional 'change' UTXO output, so the client does not need to compute it
+func (s *SmartContract) TransferWithChange(ctx contractapi.TransactionContextInterface, utxoInputKeys []string, utxoOutputs []UTXO) ([]UTXO, error) {
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	return transferHelper(ctx, clientID, utxoInputKeys, utxoOutputs, true)
+}
+
+// TransferAmount transfers amount tokens from client to recipient without the client having to choose the UTXO inputs
+// The inputs are selected from the client's UTXOs, largest amount first and then by utxo key, so that every endorser selects the same inputs.
+// Only UTXOs that the client can spend alone right now are selected.
+// Any amount left over is returned to the client in a 'change' UTXO output
+func (s *SmartContract) TransferAmount(ctx contractapi.TransactionContextInterface, recipient string, amount int) ([]UTXO, error) {
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if amount <= 0 {
+		return nil, fmt.Errorf("transfer amount must be a positive integer")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	utxos, err := clientUTXOsHelper(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	var spendableUTXOs []*UTXO
+	for _, utxo := range utxos {
+		if canSpendAlone(utxo, now) {
+			spendableUTXOs = append(spendableUTXOs, utxo)
+		}
+	}
+
+	utxoInputKeys, err := selectUTXOs(spendableUTXOs, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	utxoOutputs := []UTXO{{Owner: recipient, Amount: amount}}
+
+	return transferHelper(ctx, clientID, utxoInputKeys, utxoOutputs, true)
+}
+
+// Burn spends the client's UTXOs without creating any outputs, removing their tokens from circulation
+// The UTXOs must satisfy their spend conditions like transfer inputs do. Burn returns the number of tokens burned
+func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, utxoKeys []string) (int, error) {
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	if len(utxoKeys) == 0 {
+		return 0, fmt.Errorf("at least one utxo must be burned")
+	}
+
+	utxoInputs, totalInputAmount, err := readUTXOInputs(ctx, clientID, utxoKeys)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, utxoInput := range utxoInputs {
+		err = deleteUTXO(ctx, utxoInput)
+		if err != nil {
+			return 0, err
+		}
+		log.Printf("utxo burned: %+v", utxoInput)
+	}
+
+	err = updateSupply(ctx, -totalInputAmount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update supply: %v", err)
+	}
+
+	return totalInputAmount, nil
+}
+
+// GetUTXO returns the UTXO with the given key, including its owner(s) and spend conditions
+func (s *SmartContract) GetUTXO(ctx contractapi.TransactionContextInterface, utxoKey string) (*UTXO, error) {
+
+	record, err := readUTXOOwnerRecord(ctx, utxoKey)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("utxo %s not found", utxoKey)
+	}
+
+	utxoCompositeKey, err := ctx.GetStub().CreateCompositeKey(utxoPrefix, []string{record.Owners[0], utxoKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	valueBytes, err := ctx.GetStub().GetState(utxoCompositeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read utxoCompositeKey %s from world state: %v", utxoCompositeKey, err)
+	}
+	if valueBytes == nil {
+		return nil, fmt.Errorf("utxo %s not found", utxoKey)
+	}
+
+	amount, err := strconv.Atoi(string(valueBytes))
+	if err != nil {
+		return nil, fmt.Errorf("utxo %s has a malformed amount: %v", utxoKey, err)
+	}
+
+	return newUTXO(utxoKey, amount, record), nil
+}
+
+// ClientUTXOs returns all UTXOs owned by the calling client
+func (s *SmartContract) ClientUTXOs(ctx contractapi.TransactionContextInterface) ([]*UTXO, error) {
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	return clientUTXOsHelper(ctx, clientID)
+}
+
+// ClientID returns the client id of the calling client
+// Users can use this function to get their own client id, which they can then give to others as the payment address
+func (s *SmartContract) ClientID(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	// Get ID of submitting client identity
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	return clientID, nil
+}
+
+// Helper Functions
+
+// transferHelper spends the client's UTXO inputs and creates the UTXO outputs
+// If createChange is true, the total input amount may exceed the total output amount and
+// the difference is returned to the client in an additional UTXO output
+func transferHelper(ctx contractapi.TransactionContextInterface, clientID string, utxoInputKeys []string, utxoOutputs []UTXO, createChange bool) ([]UTXO, error) {
+
 	// Validate and summarize utxo inputs
-	utxoInputs := make(map[string]*UTXO)
+	utxoInputs, totalInputAmount, err := readUTXOInputs(ctx, clientID, utxoInputKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate and summarize utxo outputs
+	var totalOutputAmount int
+	txID := ctx.GetStub().GetTxID()
+	for i := range utxoOutputs {
+
+		err = validateUTXOOutput(&utxoOutputs[i])
+		if err != nil {
+			return nil, err
+		}
+
+		utxoOutputs[i].Key = fmt.Sprintf("%s.%d", txID, i)
+
+		// an overflowing total could make outputs worth more than the inputs look balanced
+		if totalOutputAmount > maxInt-utxoOutputs[i].Amount {
+			return nil, fmt.Errorf("total utxoOutput amount overflows")
+		}
+		totalOutputAmount += utxoOutputs[i].Amount
+	}
+
+	// Return the difference to the client as the 'change' output
+	if createChange && totalInputAmount > totalOutputAmount {
+		changeOutput := UTXO{
+			Key:    fmt.Sprintf("%s.%d", txID, len(utxoOutputs)),
+			Owner:  clientID,
+			Amount: totalInputAmount - totalOutputAmount,
+		}
+		utxoOutputs = append(utxoOutputs, changeOutput)
+		totalOutputAmount += changeOutput.Amount
+	}
+
+	// Validate total inputs equals total outputs
+	if totalInputAmount != totalOutputAmount {
+		if createChange {
+			return nil, fmt.Errorf("total utxoInput amount %d is less than total utxoOutput amount %d", totalInputAmount, totalOutputAmount)
+		}
+		return nil, fmt.Errorf("total utxoInput amount %d does not equal total utxoOutput amount %d", totalInputAmount, totalOutputAmount)
+	}
+
+	// Since the transaction is valid, now delete utxo inputs from owner's state
+	for _, utxoInput := range utxoInputs {
+		err = deleteUTXO(ctx, utxoInput)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("utxoInput deleted: %+v", utxoInput)
+	}
+
+	// Create utxo outputs using a composite key based on the owner and utxo key
+	for i := range utxoOutputs {
+		err = putUTXO(ctx, &utxoOutputs[i])
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("utxoOutput created: %+v", utxoOutputs[i])
+	}
+
+	return utxoOutputs, nil
+}
+
+// readUTXOInputs reads the client's UTXOs with the given keys and checks that the client may spend them
+// It returns the UTXOs and their total amount
+func readUTXOInputs(ctx contractapi.TransactionContextInterface, clientID string, utxoInputKeys []string) ([]*UTXO, int, error) {
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	seen := make(map[string]bool)
+	var utxoInputs []*UTXO
 	var totalInputAmount int
 	for _, utxoInputKey := range utxoInputKeys {
-		if utxoInputs[utxoInputKey] != nil {
-			return nil, fmt.Errorf("the same utxo input can not be spend twice")
+		if seen[utxoInputKey] {
+			return nil, 0, fmt.Errorf("the same utxo input can not be spend twice")
 		}
+		seen[utxoInputKey] = true
 
-		utxoInputCompositeKey, err := ctx.GetStub().CreateCompositeKey("utxo", []string{clientID, utxoInputKey})
+		utxoInputCompositeKey, err := ctx.GetStub().CreateCompositeKey(utxoPrefix, []string{clientID, utxoInputKey})
 		if err != nil {
-			return nil, fmt.Errorf("failed to create composite key: %v", err)
+			return nil, 0, fmt.Errorf("failed to create composite key: %v", err)
 		}
 
 		// validate that client has a utxo matching the input key
 		valueBytes, err := ctx.GetStub().GetState(utxoInputCompositeKey)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read utxoInputCompositeKey %s from world state: %v", utxoInputCompositeKey, err)
+			return nil, 0, fmt.Errorf("failed to read utxoInputCompositeKey %s from world state: %v", utxoInputCompositeKey, err)
 		}
 
 		if valueBytes == nil {
-			return nil, fmt.Errorf("utxoInput %s not found for client %s", utxoInputKey, clientID)
+			return nil, 0, fmt.Errorf("utxoInput %s not found for client %s", utxoInputKey, clientID)
+		}
+
+		amount, err := strconv.Atoi(string(valueBytes))
+		if err != nil {
+			return nil, 0, fmt.Errorf("utxoInput %s has a malformed amount: %v", utxoInputKey, err)
+		}
+
+		record, err := readUTXOOwnerRecord(ctx, utxoInputKey)
+		if err != nil {
+			return nil, 0, err
+		}
+		if record == nil {
+			// utxos created before the key to owner index existed have no spend conditions
+			record = &utxoOwnerRecord{Owners: []string{clientID}}
 		}
 
-		amount, _ := strconv.Atoi(string(valueBytes)) // Error handling not needed since Itoa() was used when setting the utxo amount, guaranteeing it was an integer.
+		utxoInput := newUTXO(utxoInputKey, amount, record)
 
-		utxoInput := &UTXO{
-			Key:    utxoInputKey,
-			Owner:  clientID,
-			Amount: amount,
+		err = checkSpendConditions(ctx, clientID, utxoInput, now)
+		if err != nil {
+			return nil, 0, err
 		}
 
+		// an overflowing total could make inputs look worth less than they are
+		if totalInputAmount > maxInt-amount {
+			return nil, 0, fmt.Errorf("total utxoInput amount overflows")
+		}
 		totalInputAmount += amount
-		utxoInputs[utxoInputKey] = utxoInput
+		utxoInputs = append(utxoInputs, utxoInput)
 	}
 
-	// Validate and summarize utxo outputs
-	var totalOutputAmount int
-	txID := ctx.GetStub().GetTxID()
-	for i, utxoOutput := range utxoOutputs {
+	return utxoInputs, totalInputAmount, nil
+}
 
-		if utxoOutput.Amount <= 0 {
-			return nil, fmt.Errorf("utxo output amount must be a positive integer")
-		}
+// validateUTXOOutput checks the amount and spend conditions requested for a utxo output
+func validateUTXOOutput(utxoOutput *UTXO) error {
 
-		utxoOutputs[i].Key = fmt.Sprintf("%s.%d", txID, i)
+	if utxoOutput.Amount <= 0 {
+		return fmt.Errorf("utxo output amount must be a positive integer")
+	}
 
-		totalOutputAmount += utxoOutput.Amount
+	if utxoOutput.LockedUntil < 0 {
+		return fmt.Errorf("utxo output lock time must not be negative")
 	}
 
-	// Validate total inputs equals total outputs
-	if totalInputAmount != totalOutputAmount {
-		return nil, fmt.Errorf("total utxoInput amount %d does not equal total utxoOutput amount %d", totalInputAmount, totalOutputAmount)
+	if len(utxoOutput.Owners) == 0 {
+		if utxoOutput.Owner == "" {
+			return fmt.Errorf("utxo output must have an owner")
+		}
+		if utxoOutput.RequiredSignatures > 1 {
+			return fmt.Errorf("utxo output with a single owner can not require %d signatures", utxoOutput.RequiredSignatures)
+		}
+		utxoOutput.RequiredSignatures = 0
+		return nil
 	}
 
-	// Since the transaction is valid, now delete utxo inputs from owner's state
-	for _, utxoInput := range utxoInputs {
+	// multi-owner output
+	if utxoOutput.Owner != "" {
+		return fmt.Errorf("utxo output must set either owner or owners, not both")
+	}
+	seen := make(map[string]bool)
+	for _, owner := range utxoOutput.Owners {
+		if owner == "" {
+			return fmt.Errorf("utxo output owners must not be empty")
+		}
+		if seen[owner] {
+			return fmt.Errorf("owner %s appears more than once in utxo output owners", owner)
+		}
+		seen[owner] = true
+	}
+	if utxoOutput.RequiredSignatures < 1 || utxoOutput.RequiredSignatures > len(utxoOutput.Owners) {
+		return fmt.Errorf("utxo output required signatures must be between 1 and the number of owners %d", len(utxoOutput.Owners))
+	}
+
+	return nil
+}
+
+// putUTXO writes the utxo under the composite key owner:utxoKey of each of its owners,
+// and records its owners and spend conditions in the index from utxo key to owner
+func putUTXO(ctx contractapi.TransactionContextInterface, utxo *UTXO) error {
+
+	record := utxoOwnerRecord{
+		Owners:             utxoOwners(utxo),
+		RequiredSignatures: utxo.RequiredSignatures,
+		LockedUntil:        utxo.LockedUntil,
+	}
 
-		utxoInputCompositeKey, err := ctx.GetStub().CreateCompositeKey("utxo", []string{utxoInput.Owner, utxoInput.Key})
+	for _, owner := range record.Owners {
+		utxoCompositeKey, err := ctx.GetStub().CreateCompositeKey(utxoPrefix, []string{owner, utxo.Key})
 		if err != nil {
-			return nil, fmt.Errorf("failed to create composite key: %v", err)
+			return fmt.Errorf("failed to create composite key: %v", err)
 		}
 
-		err = ctx.GetStub().DelState(utxoInputCompositeKey)
+		err = ctx.GetStub().PutState(utxoCompositeKey, []byte(strconv.Itoa(utxo.Amount)))
 		if err != nil {
-			return nil, err
+			return err
 		}
-		log.Printf("utxoInput deleted: %+v", utxoInput)
 	}
 
-	// Create utxo outputs using a composite key based on the owner and utxo key
-	for _, utxoOutput := range utxoOutputs {
-		utxoOutputCompositeKey, err := ctx.GetStub().CreateCompositeKey("utxo", []string{utxoOutput.Owner, utxoOutput.Key})
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	utxoOwnerKey, err := ctx.GetStub().CreateCompositeKey(utxoOwnerPrefix, []string{utxo.Key})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(utxoOwnerKey, recordJSON)
+}
+
+// deleteUTXO removes the utxo from the state of each of its owners, its index entry and any spend approvals
+func deleteUTXO(ctx contractapi.TransactionContextInterface, utxo *UTXO) error {
+
+	for _, owner := range utxoOwners(utxo) {
+		utxoCompositeKey, err := ctx.GetStub().CreateCompositeKey(utxoPrefix, []string{owner, utxo.Key})
 		if err != nil {
-			return nil, fmt.Errorf("failed to create composite key: %v", err)
+			return fmt.Errorf("failed to create composite key: %v", err)
 		}
 
-		err = ctx.GetStub().PutState(utxoOutputCompositeKey, []byte(strconv.Itoa(utxoOutput.Amount)))
+		err = ctx.GetStub().DelState(utxoCompositeKey)
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		if len(utxo.Owners) > 1 {
+			err = deleteSpendApproval(ctx, utxo.Key, owner)
+			if err != nil {
+				return err
+			}
 		}
-		log.Printf("utxoOutput created: %+v", utxoOutput)
 	}
 
-	return utxoOutputs, nil
+	utxoOwnerKey, err := ctx.GetStub().CreateCompositeKey(utxoOwnerPrefix, []string{utxo.Key})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().DelState(utxoOwnerKey)
 }
 
-// ClientUTXOs returns all UTXOs owned by the calling client
-func (s *SmartContract) ClientUTXOs(ctx contractapi.TransactionContextInterface) ([]*UTXO, error) {
+// readUTXOOwnerRecord reads the owners and spend conditions of a utxo from the index from utxo key to owner
+// It returns nil if the index has no entry for the utxo key
+func readUTXOOwnerRecord(ctx contractapi.TransactionContextInterface, utxoKey string) (*utxoOwnerRecord, error) {
 
-	// Get ID of submitting client identity
-	clientID, err := ctx.GetClientIdentity().GetID()
+	utxoOwnerKey, err := ctx.GetStub().CreateCompositeKey(utxoOwnerPrefix, []string{utxoKey})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get client id: %v", err)
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	recordBytes, err := ctx.GetStub().GetState(utxoOwnerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read owner of utxo %s from world state: %v", utxoKey, err)
+	}
+	if recordBytes == nil {
+		return nil, nil
+	}
+
+	var record utxoOwnerRecord
+	err = json.Unmarshal(recordBytes, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal owner of utxo %s: %v", utxoKey, err)
 	}
+	if len(record.Owners) == 0 {
+		return nil, fmt.Errorf("utxo %s has no owner", utxoKey)
+	}
+
+	return &record, nil
+}
+
+// newUTXO builds a UTXO from its key, amount and index entry
+// Single owner utxos report their owner in Owner, multi-owner utxos report their owners in Owners
+func newUTXO(utxoKey string, amount int, record *utxoOwnerRecord) *UTXO {
+	utxo := &UTXO{
+		Key:                utxoKey,
+		Amount:             amount,
+		RequiredSignatures: record.RequiredSignatures,
+		LockedUntil:        record.LockedUntil,
+	}
+	if len(record.Owners) == 1 {
+		utxo.Owner = record.Owners[0]
+	} else {
+		utxo.Owners = record.Owners
+	}
+	return utxo
+}
+
+// utxoOwners returns the owners of a single owner or multi-owner utxo
+func utxoOwners(utxo *UTXO) []string {
+	if len(utxo.Owners) > 0 {
+		return utxo.Owners
+	}
+	return []string{utxo.Owner}
+}
+
+// clientUTXOsHelper returns all UTXOs owned by the given client
+func clientUTXOsHelper(ctx contractapi.TransactionContextInterface, clientID string) ([]*UTXO, error) {
 
 	// since utxos have a composite key of owner:utxoKey, we can query for all utxos matching owner:*
-	utxoResultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey("utxo", []string{clientID})
+	utxoResultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(utxoPrefix, []string{clientID})
 	if err != nil {
 		return nil, err
 	}
@@ -194,28 +574,62 @@ func (s *SmartContract) ClientUTXOs(ctx contractapi.TransactionContextInterface)
 			return nil, fmt.Errorf("utxo %s has no value", utxoKey)
 		}
 
-		amount, _ := strconv.Atoi(string(utxoRecord.Value)) // Error handling not needed since Itoa() was used when setting the utxo amount, guaranteeing it was an integer.
+		amount, err := strconv.Atoi(string(utxoRecord.Value))
+		if err != nil {
+			return nil, fmt.Errorf("utxo %s has a malformed amount: %v", utxoKey, err)
+		}
 
-		utxo := &UTXO{
-			Key:    utxoKey,
-			Owner:  clientID,
-			Amount: amount,
+		record, err := readUTXOOwnerRecord(ctx, utxoKey)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			record = &utxoOwnerRecord{Owners: []string{clientID}}
 		}
 
-		utxos = append(utxos, utxo)
+		utxos = append(utxos, newUTXO(utxoKey, amount, record))
 	}
 	return utxos, nil
 }
 
-// ClientID returns the client id of the calling client
-// Users can use this function to get their own client id, which they can then give to others as the payment address
-func (s *SmartContract) ClientID(ctx contractapi.TransactionContextInterface) (string, error) {
+// selectUTXOs selects UTXO inputs worth at least amount tokens
+// UTXOs are taken largest amount first, using the utxo key to break ties, so the selection only depends on the UTXO set
+// and every endorser selects the same inputs. Taking the largest UTXOs first keeps the number of inputs small
+func selectUTXOs(utxos []*UTXO, amount int) ([]string, error) {
 
-	// Get ID of submitting client identity
-	clientID, err := ctx.GetClientIdentity().GetID()
+	candidates := make([]*UTXO, len(utxos))
+	copy(candidates, utxos)
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Amount != candidates[j].Amount {
+			return candidates[i].Amount > candidates[j].Amount
+		}
+		return candidates[i].Key < candidates[j].Key
+	})
+
+	var selectedKeys []string
+	var selectedAmount int
+	for _, utxo := range candidates {
+		if selectedAmount >= amount {
+			break
+		}
+		selectedKeys = append(selectedKeys, utxo.Key)
+		selectedAmount += utxo.Amount
+	}
+
+	if selectedAmount < amount {
+		return nil, fmt.Errorf("insufficient funds, client UTXOs total %d tokens but %d were requested", selectedAmount, amount)
+	}
+
+	return selectedKeys, nil
+}
+
+// txTime returns the transaction timestamp as a Unix time in seconds
+// The transaction timestamp is chosen by the client and is the same on every endorser
+func txTime(ctx contractapi.TransactionContextInterface) (int64, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
 	if err != nil {
-		return "", fmt.Errorf("failed to get client id: %v", err)
+		return 0, fmt.Errorf("failed to get transaction timestamp: %v", err)
 	}
 
-	return clientID, nil
+	return txTimestamp.GetSeconds(), nil
 }
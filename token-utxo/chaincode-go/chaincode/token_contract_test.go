@@ -0,0 +1,542 @@
+package chaincode
+
+import (
+	"crypto/x509"
+	"reflect"
+	"strconv"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+func TestSelectUTXOs(t *testing.T) {
+	utxos := []*UTXO{
+		{Key: "tx3.0", Amount: 50},
+		{Key: "tx1.0", Amount: 100},
+		{Key: "tx2.1", Amount: 20},
+		{Key: "tx2.0", Amount: 50},
+	}
+
+	tests := []struct {
+		name     string
+		amount   int
+		expected []string
+		wantErr  bool
+	}{
+		{"single largest utxo covers amount", 80, []string{"tx1.0"}, false},
+		{"exact amount", 100, []string{"tx1.0"}, false},
+		{"ties are broken by key", 120, []string{"tx1.0", "tx2.0"}, false},
+		{"all utxos", 220, []string{"tx1.0", "tx2.0", "tx3.0", "tx2.1"}, false},
+		{"insufficient funds", 221, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			keys, err := selectUTXOs(utxos, test.amount)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got keys %v", keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(keys, test.expected) {
+				t.Fatalf("expected keys %v, got %v", test.expected, keys)
+			}
+		})
+	}
+
+	// the input order must not change the selection
+	reversed := []*UTXO{utxos[3], utxos[2], utxos[1], utxos[0]}
+	keys, err := selectUTXOs(reversed, 120)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"tx1.0", "tx2.0"}) {
+		t.Fatalf("selection depends on input order, got %v", keys)
+	}
+}
+
+func TestValidateUTXOOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  UTXO
+		wantErr bool
+	}{
+		{"single owner", UTXO{Owner: "alice", Amount: 10}, false},
+		{"time-locked", UTXO{Owner: "alice", Amount: 10, LockedUntil: 1700000000}, false},
+		{"2-of-3 owners", UTXO{Owners: []string{"alice", "bob", "carol"}, RequiredSignatures: 2, Amount: 10}, false},
+		{"zero amount", UTXO{Owner: "alice"}, true},
+		{"no owner", UTXO{Amount: 10}, true},
+		{"negative lock time", UTXO{Owner: "alice", Amount: 10, LockedUntil: -1}, true},
+		{"owner and owners", UTXO{Owner: "alice", Owners: []string{"alice", "bob"}, RequiredSignatures: 1, Amount: 10}, true},
+		{"duplicate owners", UTXO{Owners: []string{"alice", "alice"}, RequiredSignatures: 1, Amount: 10}, true},
+		{"too many signatures", UTXO{Owners: []string{"alice", "bob"}, RequiredSignatures: 3, Amount: 10}, true},
+		{"no signatures", UTXO{Owners: []string{"alice", "bob"}, Amount: 10}, true},
+		{"single owner with signatures", UTXO{Owner: "alice", RequiredSignatures: 2, Amount: 10}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateUTXOOutput(&test.output)
+			if test.wantErr && err == nil {
+				t.Fatalf("expected an error for output %+v", test.output)
+			}
+			if !test.wantErr && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCanSpendAlone(t *testing.T) {
+	now := int64(1700000000)
+
+	tests := []struct {
+		name     string
+		utxo     UTXO
+		expected bool
+	}{
+		{"plain", UTXO{Owner: "alice", Amount: 10}, true},
+		{"unlocked", UTXO{Owner: "alice", Amount: 10, LockedUntil: now}, true},
+		{"locked", UTXO{Owner: "alice", Amount: 10, LockedUntil: now + 1}, false},
+		{"1-of-2 owners", UTXO{Owners: []string{"alice", "bob"}, RequiredSignatures: 1, Amount: 10}, true},
+		{"2-of-2 owners", UTXO{Owners: []string{"alice", "bob"}, RequiredSignatures: 2, Amount: 10}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if canSpendAlone(&test.utxo, now) != test.expected {
+				t.Fatalf("expected canSpendAlone to be %v for %+v", test.expected, test.utxo)
+			}
+		})
+	}
+}
+
+func TestAuditBookmark(t *testing.T) {
+	cursor, err := parseAuditBookmark("")
+	if err != nil || *cursor != (auditBookmark{}) {
+		t.Fatalf("expected an empty bookmark to start a new audit, got %+v, %v", cursor, err)
+	}
+
+	bookmark, err := encodeAuditBookmark(auditBookmark{Bookmark: "next", AuditedSupply: 500, MalformedCount: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cursor, err = parseAuditBookmark(bookmark)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *cursor != (auditBookmark{Bookmark: "next", AuditedSupply: 500, MalformedCount: 1}) {
+		t.Fatalf("bookmark did not round trip, got %+v", cursor)
+	}
+
+	if _, err = parseAuditBookmark("not a bookmark"); err == nil {
+		t.Fatalf("expected an error for a malformed bookmark")
+	}
+}
+
+func TestAuditUTXOSet(t *testing.T) {
+	ctx, mockStub := newTestTransactionContext("minter", "Org1MSP")
+	stub := &paginatedStub{MockStub: mockStub}
+	ctx.SetStub(stub)
+	contract := SmartContract{}
+
+	if _, err := contract.Mint(ctx, 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	startTestTransaction(mockStub, "tx2", 1700000000)
+	utxoOutputs := []UTXO{
+		{Owners: []string{"alice", "bob"}, RequiredSignatures: 2, Amount: 60},
+		{Owner: "carol", Amount: 40},
+	}
+	if _, err := contract.Transfer(ctx, []string{"tx1.0"}, utxoOutputs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	putRawUTXO := func(owner string, utxoKey string, value string) {
+		utxoCompositeKey, err := stub.CreateCompositeKey(utxoPrefix, []string{owner, utxoKey})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err = stub.PutState(utxoCompositeKey, []byte(value)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// audit the UTXO set two records at a time until it is complete
+	audit := func() (*AuditReport, map[string]OwnerTotal, []string) {
+		totals := make(map[string]OwnerTotal)
+		var malformedKeys []string
+		bookmark := ""
+		for pages := 1; ; pages++ {
+			if pages > 10 {
+				t.Fatalf("audit did not complete")
+			}
+			report, err := contract.AuditUTXOSet(ctx, 2, bookmark)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, ownerTotal := range report.OwnerTotals {
+				total := totals[ownerTotal.Owner]
+				total.Amount += ownerTotal.Amount
+				total.UTXOs += ownerTotal.UTXOs
+				totals[ownerTotal.Owner] = total
+			}
+			for _, malformed := range report.MalformedRecords {
+				malformedKeys = append(malformedKeys, malformed.Key)
+			}
+			if report.Complete {
+				return report, totals, malformedKeys
+			}
+			bookmark = report.Bookmark
+		}
+	}
+
+	// the multi-owner utxo counts towards each owner, but only once towards the supply
+	report, totals, malformedKeys := audit()
+	if report.AuditedSupply != 100 || report.RecordedSupply != 100 || report.MalformedCount != 0 || !report.Consistent {
+		t.Fatalf("expected a consistent audit of 100 tokens, got %+v", report)
+	}
+	expectedTotals := map[string]OwnerTotal{
+		"alice": {Amount: 60, UTXOs: 1},
+		"bob":   {Amount: 60, UTXOs: 1},
+		"carol": {Amount: 40, UTXOs: 1},
+	}
+	if !reflect.DeepEqual(totals, expectedTotals) || len(malformedKeys) != 0 {
+		t.Fatalf("expected owner totals %+v, got %+v and malformed records %v", expectedTotals, totals, malformedKeys)
+	}
+
+	// a negative amount, and a multi-owner utxo held by an owner the index does not list, are malformed
+	putRawUTXO("dave", "tx2.0", "60")
+	putRawUTXO("mallory", "tx9.0", "-5")
+	report, totals, malformedKeys = audit()
+	if report.AuditedSupply != 100 || report.MalformedCount != 2 || report.Consistent {
+		t.Fatalf("expected an inconsistent audit with 2 malformed records, got %+v", report)
+	}
+	if !reflect.DeepEqual(totals, expectedTotals) || !reflect.DeepEqual(malformedKeys, []string{"tx2.0", "tx9.0"}) {
+		t.Fatalf("unexpected owner totals %+v and malformed records %v", totals, malformedKeys)
+	}
+
+	if _, err := contract.AuditUTXOSet(ctx, 0, ""); err == nil {
+		t.Fatalf("expected an error for a page size of 0")
+	}
+}
+
+func TestBurn(t *testing.T) {
+	ctx, stub := newTestTransactionContext("minter", "Org1MSP")
+	contract := SmartContract{}
+
+	if _, err := contract.Mint(ctx, 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	startTestTransaction(stub, "tx2", 1700000000)
+	if _, err := contract.Burn(ctx, []string{}); err == nil {
+		t.Fatalf("expected an error for burning no utxos")
+	}
+
+	// only the owner can burn the utxo
+	ctx.SetClientIdentity(&testClientIdentity{id: "recipient", mspID: "Org2MSP"})
+	if _, err := contract.Burn(ctx, []string{"tx1.0"}); err == nil {
+		t.Fatalf("expected an error for burning a utxo of another client")
+	}
+
+	ctx.SetClientIdentity(&testClientIdentity{id: "minter", mspID: "Org1MSP"})
+	burned, err := contract.Burn(ctx, []string{"tx1.0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if burned != 100 {
+		t.Fatalf("expected 100 tokens to be burned, got %d", burned)
+	}
+
+	if _, err = contract.GetUTXO(ctx, "tx1.0"); err == nil {
+		t.Fatalf("expected the burned utxo to be deleted")
+	}
+	supply, err := contract.TotalSupply(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if supply != 0 {
+		t.Fatalf("expected the burned tokens to leave the supply, got %d", supply)
+	}
+
+	startTestTransaction(stub, "tx3", 1700000000)
+	if _, err = contract.Burn(ctx, []string{"tx1.0"}); err == nil {
+		t.Fatalf("expected an error for burning a utxo twice")
+	}
+}
+
+func TestTransferWithChange(t *testing.T) {
+	ctx, stub := newTestTransactionContext("minter", "Org1MSP")
+	contract := SmartContract{}
+
+	if _, err := contract.Mint(ctx, 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	startTestTransaction(stub, "tx2", 1700000000)
+	if _, err := contract.TransferWithChange(ctx, []string{"tx1.0"}, []UTXO{{Owner: "recipient", Amount: 101}}); err == nil {
+		t.Fatalf("expected an error for outputs that exceed the inputs")
+	}
+
+	utxoOutputs, err := contract.TransferWithChange(ctx, []string{"tx1.0"}, []UTXO{{Owner: "recipient", Amount: 30}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []UTXO{
+		{Key: "tx2.0", Owner: "recipient", Amount: 30},
+		{Key: "tx2.1", Owner: "minter", Amount: 70},
+	}
+	if !reflect.DeepEqual(utxoOutputs, expected) {
+		t.Fatalf("expected outputs %+v, got %+v", expected, utxoOutputs)
+	}
+
+	change, err := contract.GetUTXO(ctx, "tx2.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(*change, expected[1]) {
+		t.Fatalf("expected change %+v, got %+v", expected[1], change)
+	}
+	if _, err = contract.GetUTXO(ctx, "tx1.0"); err == nil {
+		t.Fatalf("expected the spent input to be deleted")
+	}
+
+	// an exact transfer creates no change output
+	startTestTransaction(stub, "tx3", 1700000000)
+	utxoOutputs, err = contract.TransferWithChange(ctx, []string{"tx2.1"}, []UTXO{{Owner: "recipient", Amount: 70}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(utxoOutputs) != 1 {
+		t.Fatalf("expected no change output, got %+v", utxoOutputs)
+	}
+}
+
+func TestSpendApprovals(t *testing.T) {
+	ctx, stub := newTestTransactionContext("minter", "Org1MSP")
+	contract := SmartContract{}
+
+	if _, err := contract.Mint(ctx, 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	startTestTransaction(stub, "tx2", 1700000000)
+	owners := []string{"alice", "bob", "carol"}
+	if _, err := contract.Transfer(ctx, []string{"tx1.0"}, []UTXO{{Owners: owners, RequiredSignatures: 2, Amount: 100}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	utxo, err := contract.GetUTXO(ctx, "tx2.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(utxo.Owners, owners) || utxo.RequiredSignatures != 2 {
+		t.Fatalf("unexpected multi-owner utxo %+v", utxo)
+	}
+
+	// only co-owners can approve a spend
+	ctx.SetClientIdentity(&testClientIdentity{id: "minter", mspID: "Org1MSP"})
+	if err = contract.ApproveSpend(ctx, "tx2.0"); err == nil {
+		t.Fatalf("expected an error for an approval by a client that is not an owner")
+	}
+
+	// bob alone does not meet the 2 required signatures
+	startTestTransaction(stub, "tx3", 1700000000)
+	ctx.SetClientIdentity(&testClientIdentity{id: "bob", mspID: "Org1MSP"})
+	if _, err = contract.Transfer(ctx, []string{"tx2.0"}, []UTXO{{Owner: "bob", Amount: 100}}); err == nil {
+		t.Fatalf("expected an error for a spend without enough approvals")
+	}
+
+	// a revoked approval does not count
+	ctx.SetClientIdentity(&testClientIdentity{id: "alice", mspID: "Org1MSP"})
+	if err = contract.ApproveSpend(ctx, "tx2.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = contract.RevokeSpendApproval(ctx, "tx2.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx.SetClientIdentity(&testClientIdentity{id: "bob", mspID: "Org1MSP"})
+	if _, err = contract.Transfer(ctx, []string{"tx2.0"}, []UTXO{{Owner: "bob", Amount: 100}}); err == nil {
+		t.Fatalf("expected an error for a spend with a revoked approval")
+	}
+
+	ctx.SetClientIdentity(&testClientIdentity{id: "alice", mspID: "Org1MSP"})
+	if err = contract.ApproveSpend(ctx, "tx2.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx.SetClientIdentity(&testClientIdentity{id: "bob", mspID: "Org1MSP"})
+	if _, err = contract.Transfer(ctx, []string{"tx2.0"}, []UTXO{{Owner: "bob", Amount: 100}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the utxo is removed from every owner together with its approvals
+	for _, owner := range owners {
+		utxoCompositeKey, err := stub.CreateCompositeKey(utxoPrefix, []string{owner, "tx2.0"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		approvalKey, err := stub.CreateCompositeKey(approvalPrefix, []string{"tx2.0", owner})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stub.State[utxoCompositeKey] != nil || stub.State[approvalKey] != nil {
+			t.Fatalf("expected the spent utxo and its approvals to be deleted for owner %s", owner)
+		}
+	}
+}
+
+func TestLockedUntil(t *testing.T) {
+	ctx, stub := newTestTransactionContext("minter", "Org1MSP")
+	contract := SmartContract{}
+
+	if _, err := contract.Mint(ctx, 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	startTestTransaction(stub, "tx2", 1700000000)
+	if _, err := contract.Transfer(ctx, []string{"tx1.0"}, []UTXO{{Owner: "recipient", Amount: 100, LockedUntil: 1700003600}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	utxo, err := contract.GetUTXO(ctx, "tx2.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if utxo.LockedUntil != 1700003600 {
+		t.Fatalf("expected the utxo to be locked until 1700003600, got %+v", utxo)
+	}
+
+	ctx.SetClientIdentity(&testClientIdentity{id: "recipient", mspID: "Org2MSP"})
+	startTestTransaction(stub, "tx3", 1700003599)
+	if _, err = contract.Transfer(ctx, []string{"tx2.0"}, []UTXO{{Owner: "minter", Amount: 100}}); err == nil {
+		t.Fatalf("expected an error for spending a locked utxo")
+	}
+	if _, err = contract.TransferAmount(ctx, "minter", 100); err == nil {
+		t.Fatalf("expected TransferAmount to skip a locked utxo")
+	}
+
+	startTestTransaction(stub, "tx4", 1700003600)
+	if _, err = contract.Transfer(ctx, []string{"tx2.0"}, []UTXO{{Owner: "minter", Amount: 100}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReadUTXOInputsMalformed(t *testing.T) {
+	ctx, stub := newTestTransactionContext("minter", "Org1MSP")
+	contract := SmartContract{}
+
+	putRawUTXO := func(utxoKey string, value string) {
+		utxoCompositeKey, err := stub.CreateCompositeKey(utxoPrefix, []string{"minter", utxoKey})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err = stub.PutState(utxoCompositeKey, []byte(value)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	putRawUTXO("tx0.0", "not a number")
+	putRawUTXO("tx0.1", strconv.Itoa(maxInt))
+	putRawUTXO("tx0.2", "1")
+
+	startTestTransaction(stub, "tx2", 1700000000)
+	if _, err := contract.Burn(ctx, []string{"tx0.0"}); err == nil {
+		t.Fatalf("expected an error for a utxo with a malformed amount")
+	}
+	if _, err := contract.Burn(ctx, []string{"tx0.1", "tx0.2"}); err == nil {
+		t.Fatalf("expected an error for inputs whose total overflows")
+	}
+	if _, err := contract.ClientUTXOs(ctx); err == nil {
+		t.Fatalf("expected an error for listing a utxo with a malformed amount")
+	}
+}
+
+// startTestTransaction starts a new transaction on the stub with the given Unix time in seconds
+func startTestTransaction(stub *shimtest.MockStub, txID string, now int64) {
+	stub.MockTransactionStart(txID)
+	stub.TxTimestamp = &timestamp.Timestamp{Seconds: now}
+}
+
+// testClientIdentity is a client identity with a fixed id and MSP ID
+type testClientIdentity struct {
+	id    string
+	mspID string
+}
+
+func (identity *testClientIdentity) GetID() (string, error) {
+	return identity.id, nil
+}
+
+func (identity *testClientIdentity) GetMSPID() (string, error) {
+	return identity.mspID, nil
+}
+
+func (identity *testClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (identity *testClientIdentity) AssertAttributeValue(attrName, attrValue string) error {
+	return nil
+}
+
+func (identity *testClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, nil
+}
+
+// newTestTransactionContext returns a transaction context for a client on a shim mock stub
+func newTestTransactionContext(clientID string, mspID string) (*contractapi.TransactionContext, *shimtest.MockStub) {
+	stub := shimtest.NewMockStub("token_utxo", nil)
+	stub.MockTransactionStart("tx1")
+
+	ctx := &contractapi.TransactionContext{}
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(&testClientIdentity{id: clientID, mspID: mspID})
+
+	return ctx, stub
+}
+
+// paginatedStub adds paginated partial composite key queries to the shim mock stub
+// The bookmark is the composite key of the first record of the next page
+type paginatedStub struct {
+	*shimtest.MockStub
+}
+
+func (stub *paginatedStub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	partialCompositeKey, err := stub.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	startKey, endKey := partialCompositeKey, partialCompositeKey+string(utf8.MaxRune)
+	if bookmark != "" {
+		startKey = bookmark
+	}
+
+	// find the end of the page, which is the start of the next one
+	iterator := shimtest.NewMockStateRangeQueryIterator(stub.MockStub, startKey, endKey)
+	var fetched int32
+	nextBookmark := ""
+	for iterator.HasNext() {
+		record, err := iterator.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if fetched == pageSize {
+			nextBookmark = record.Key
+			endKey = record.Key
+			break
+		}
+		fetched++
+	}
+
+	metadata := &peer.QueryResponseMetadata{FetchedRecordsCount: fetched, Bookmark: nextBookmark}
+	return shimtest.NewMockStateRangeQueryIterator(stub.MockStub, startKey, endKey), metadata, nil
+}
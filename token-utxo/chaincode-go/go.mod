@@ -3,6 +3,9 @@ module github.com/hyperledger/fabric-samples/token-utxo/chaincode-go
 go 1.14
 
 require (
+	github.com/golang/protobuf v1.3.2
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20200424173110-d7076418f212
 	github.com/hyperledger/fabric-contract-api-go v1.1.0
+	github.com/hyperledger/fabric-protos-go v0.0.0-20200424173316-dd554ba3746e
 	golang.org/x/tools v0.1.0 // indirect
 )